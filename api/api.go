@@ -2,6 +2,9 @@ package api
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/machine"
 	"github.com/the-lightning-land/sweetd/network"
 	"github.com/the-lightning-land/sweetd/nodeman"
 	"github.com/the-lightning-land/sweetd/state"
@@ -9,6 +12,7 @@ import (
 	"github.com/the-lightning-land/sweetd/updater"
 	"net/http"
 	"regexp"
+	"time"
 )
 
 var localhostOriginPattern = regexp.MustCompile(`^https?://localhost(:\d+)?$`)
@@ -41,7 +45,14 @@ func NewHandler(config *Config) http.Handler {
 
 	router.Handle("/dispenser", api.handleGetDispenser()).Methods(http.MethodGet, http.MethodOptions)
 	router.Handle("/dispenser", api.handlePatchDispenser()).Methods(http.MethodPatch)
-	router.Handle("/dispenser/events", api.handleGetDispenser()).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/dispenser/events", api.handleGetDispenserEvents()).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/dispenser/selftest", api.handleGetSelfTest()).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/dispenser/selftest", api.handlePostSelfTest()).Methods(http.MethodPost)
+
+	router.Handle("/dispenses", api.handleGetDispenses()).Methods(http.MethodGet, http.MethodOptions)
+
+	router.Handle("/sales", api.handleGetSales()).Methods(http.MethodGet, http.MethodOptions)
+	router.Handle("/sales/export", api.handleExportSales()).Methods(http.MethodGet, http.MethodOptions)
 
 	router.Handle("/updates", api.handlePostUpdate()).Methods(http.MethodPost, http.MethodOptions)
 	router.Handle("/updates/{id}", api.handleGetUpdate()).Methods(http.MethodGet, http.MethodOptions)
@@ -53,6 +64,7 @@ func NewHandler(config *Config) http.Handler {
 	router.Handle("/nodes/{id}", api.getNodes()).Methods(http.MethodGet, http.MethodOptions)
 	router.Handle("/nodes/{id}", api.patchNode()).Methods(http.MethodPatch)
 	router.Handle("/nodes/{id}", api.deleteNode()).Methods(http.MethodDelete)
+	router.Handle("/nodes/{id}/status", api.getNodeStatus()).Methods(http.MethodGet, http.MethodOptions)
 
 	router.Handle("/networks", api.handlePostUpdate()).Methods(http.MethodPost, http.MethodOptions)
 	router.Handle("/networks/{id}", api.handlePostUpdate()).Methods(http.MethodPatch, http.MethodOptions)
@@ -93,6 +105,7 @@ type LightningNode interface {
 type Dispenser interface {
 	GetNodes() []nodeman.LightningNode
 	GetNode(id string) nodeman.LightningNode
+	GetNodeStatus(id string) lightning.NodeStatus
 	AddNode(config nodeman.NodeConfig) (nodeman.LightningNode, error)
 	RemoveNode(id string) error
 	EnableNode(id string) error
@@ -106,14 +119,71 @@ type Dispenser interface {
 	GetName() string
 	ShouldDispenseOnTouch() bool
 	ShouldBuzzOnDispense() bool
+	ShouldHoldInvoices() bool
+	IsInMaintenance() bool
+	IsInDemoMode() bool
+	GetPrice() int64
+	GetMemo() string
+	GetDispenseDuration() time.Duration
+	GetPriceTiers() []sweetdb.PriceTier
+	GetMaxDispenseDuration() time.Duration
+	GetSchedule(name string) []sweetdb.ScheduleWindow
+	IsScheduleActive(name string) bool
+	IsOpen() bool
+	GetGramsPerSecond() float64
+	GetHopperCapacity() float64
+	GetLowStockThreshold() float64
+	GetMotorRuntime() time.Duration
+	GetRefilled() time.Time
+	GetRemaining() float64
+	GetFillLevel() float64
+	IsInventoryTracked() bool
+	IsLowStock() bool
+	IsEmpty() bool
+	Refilled() error
+	GetCompartments() []sweetdb.Compartment
+	SetCompartments(compartments []sweetdb.Compartment) error
+	GetCompartmentRemaining(compartment int) float64
+	GetCompartmentFillLevel(compartment int) float64
+	GetCompartmentMotorRuntime(compartment int) time.Duration
+	GetCompartmentRefilled(compartment int) time.Time
+	IsCompartmentLowStock(compartment int) bool
+	IsCompartmentEmpty(compartment int) bool
+	RefilledCompartment(compartment int) error
+	GetMotorLimits() sweetdb.MotorLimits
+	GetMotorDrive() sweetdb.MotorDrive
+	GetMotorFault() *machine.Fault
+	SetMotorLimits(limits sweetdb.MotorLimits) error
+	SetMotorDrive(drive sweetdb.MotorDrive) error
+	ResetMotorFault()
+	GetBuzzerPatterns() map[string]machine.Pattern
+	SetBuzzerPattern(name string, pattern machine.Pattern) error
+	PreviewBuzzerPattern(pattern machine.Pattern) error
 	SetName(name string) error
 	SetDispenseOnTouch(dispenseOnTouch bool) error
 	SetBuzzOnDispense(buzzOnDispense bool) error
+	SetHoldInvoices(holdInvoices bool) error
+	SetMaintenance(maintenance bool) error
+	SetDemoMode(demoMode bool) error
+	SetPrice(price int64) error
+	SetMemo(memo string) error
+	SetDispenseDuration(duration time.Duration) error
+	SetPriceTiers(tiers []sweetdb.PriceTier) error
+	SetMaxDispenseDuration(duration time.Duration) error
+	SetSchedule(name string, windows []sweetdb.ScheduleWindow) error
+	SetGramsPerSecond(gramsPerSecond float64) error
+	SetHopperCapacity(grams float64) error
+	SetLowStockThreshold(grams float64) error
+	GetDispenses() ([]*sweetdb.Dispense, error)
+	GetSales(from time.Time, to time.Time) ([]*sweetdb.Sale, error)
 	ConnectToWifi(connection network.Connection) error
+	RunSelfTest() *machine.SelfTestReport
+	GetSelfTestReport() *machine.SelfTestReport
 	Reboot() error
+	FactoryReset() error
 	ShutDown() error
 	Stop()
-	// SubscribeDispenses() *dispenser.DispenseClient
+	SubscribeEvents() *events.Client
 	StartUpdate(url string) (*updater.Update, error)
 	GetUpdate(id string) (*updater.Update, error)
 	GetCurrentUpdate() (*updater.Update, error)
@@ -3,22 +3,109 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/the-lightning-land/sweetd/machine"
 	"github.com/the-lightning-land/sweetd/state"
+	"github.com/the-lightning-land/sweetd/sweetdb"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type dispenserUpdateResponse struct {
 	Id string `json:"id"`
 }
 
+type priceTier struct {
+	Price    int64 `json:"price"`
+	Duration int64 `json:"duration"`
+}
+
+type scheduleWindow struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type inventoryResponse struct {
+	Tracked           bool      `json:"tracked"`
+	GramsPerSecond    float64   `json:"gramsPerSecond"`
+	Capacity          float64   `json:"capacity"`
+	LowStockThreshold float64   `json:"lowStockThreshold"`
+	Remaining         float64   `json:"remaining"`
+	FillLevel         float64   `json:"fillLevel"`
+	LowStock          bool      `json:"lowStock"`
+	Empty             bool      `json:"empty"`
+	MotorRuntime      int64     `json:"motorRuntime"`
+	Refilled          time.Time `json:"refilled"`
+}
+
+type compartment struct {
+	Id      int    `json:"id"`
+	Product string `json:"product"`
+	Price   int64  `json:"price"`
+}
+
+type compartmentResponse struct {
+	compartment
+	Remaining    float64   `json:"remaining"`
+	FillLevel    float64   `json:"fillLevel"`
+	LowStock     bool      `json:"lowStock"`
+	Empty        bool      `json:"empty"`
+	MotorRuntime int64     `json:"motorRuntime"`
+	Refilled     time.Time `json:"refilled"`
+}
+
+type motorLimits struct {
+	MaxRuntime int64   `json:"maxRuntime"`
+	Cooldown   int64   `json:"cooldown"`
+	DutyCycle  float64 `json:"dutyCycle"`
+	DutyWindow int64   `json:"dutyWindow"`
+}
+
+type motorDrive struct {
+	Speed    float64 `json:"speed"`
+	RampUp   int64   `json:"rampUp"`
+	RampDown int64   `json:"rampDown"`
+}
+
+type motorFaultResponse struct {
+	Reason      string    `json:"reason"`
+	Compartment int       `json:"compartment"`
+	Time        time.Time `json:"time"`
+}
+
+type motorResponse struct {
+	Drive  *motorDrive         `json:"drive"`
+	Limits *motorLimits        `json:"limits"`
+	Fault  *motorFaultResponse `json:"fault"`
+}
+
 type dispenserResponse struct {
-	Name            string                   `json:"name"`
-	Api             string                   `json:"api"`
-	Pos             string                   `json:"pos"`
-	Version         string                   `json:"version"`
-	State           string                   `json:"state"`
-	DispenseOnTouch bool                     `json:"dispenseOnTouch"`
-	Update          *dispenserUpdateResponse `json:"update"`
+	Name             string                   `json:"name"`
+	Api              string                   `json:"api"`
+	Pos              string                   `json:"pos"`
+	Version          string                   `json:"version"`
+	State            string                   `json:"state"`
+	DispenseOnTouch  bool                     `json:"dispenseOnTouch"`
+	HoldInvoices     bool                     `json:"holdInvoices"`
+	Maintenance      bool                     `json:"maintenance"`
+	DemoMode         bool                     `json:"demoMode"`
+	Price            int64                    `json:"price"`
+	Memo             string                   `json:"memo"`
+	DispenseDuration int64                    `json:"dispenseDuration"`
+	PriceTiers       []priceTier              `json:"priceTiers"`
+	MaxDispense      int64                    `json:"maxDispenseDuration"`
+	Open             bool                     `json:"open"`
+	Quiet            bool                     `json:"quiet"`
+	Promo            bool                     `json:"promo"`
+	OpeningHours     []scheduleWindow         `json:"openingHours"`
+	QuietHours       []scheduleWindow         `json:"quietHours"`
+	PromoHours       []scheduleWindow         `json:"promoHours"`
+	Inventory        *inventoryResponse       `json:"inventory"`
+	Compartments     []compartmentResponse    `json:"compartments"`
+	Motor            *motorResponse           `json:"motor"`
+	BuzzerPatterns   map[string][]int64       `json:"buzzerPatterns"`
+	Update           *dispenserUpdateResponse `json:"update"`
 }
 
 type patchDispenserOp struct {
@@ -29,6 +116,194 @@ type patchDispenserOp struct {
 
 type patchDispenserRequest []patchDispenserOp
 
+func newPriceTiers(tiers []sweetdb.PriceTier) []priceTier {
+	priceTiers := []priceTier{}
+
+	for _, tier := range tiers {
+		priceTiers = append(priceTiers, priceTier{
+			Price:    tier.Price,
+			Duration: int64(tier.Duration / time.Millisecond),
+		})
+	}
+
+	return priceTiers
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func newScheduleWindows(windows []sweetdb.ScheduleWindow) []scheduleWindow {
+	scheduleWindows := []scheduleWindow{}
+
+	for _, window := range windows {
+		days := []string{}
+		for _, day := range window.Days {
+			days = append(days, strings.ToLower(day.String()))
+		}
+
+		scheduleWindows = append(scheduleWindows, scheduleWindow{
+			Days:  days,
+			Start: fmt.Sprintf("%02d:%02d", window.Start/60, window.Start%60),
+			End:   fmt.Sprintf("%02d:%02d", window.End/60, window.End%60),
+		})
+	}
+
+	return scheduleWindows
+}
+
+// parseMinutes parses a time of day in HH:MM format into minutes after midnight
+func parseMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %s", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseScheduleWindows(windows []scheduleWindow) ([]sweetdb.ScheduleWindow, error) {
+	scheduleWindows := []sweetdb.ScheduleWindow{}
+
+	for _, window := range windows {
+		days := []time.Weekday{}
+		for _, name := range window.Days {
+			day, ok := weekdays[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown day %s", name)
+			}
+
+			days = append(days, day)
+		}
+
+		start, err := parseMinutes(window.Start)
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := parseMinutes(window.End)
+		if err != nil {
+			return nil, err
+		}
+
+		scheduleWindows = append(scheduleWindows, sweetdb.ScheduleWindow{
+			Days:  days,
+			Start: start,
+			End:   end,
+		})
+	}
+
+	return scheduleWindows, nil
+}
+
+func (a *Handler) getInventory() *inventoryResponse {
+	return &inventoryResponse{
+		Tracked:           a.dispenser.IsInventoryTracked(),
+		GramsPerSecond:    a.dispenser.GetGramsPerSecond(),
+		Capacity:          a.dispenser.GetHopperCapacity(),
+		LowStockThreshold: a.dispenser.GetLowStockThreshold(),
+		Remaining:         a.dispenser.GetRemaining(),
+		FillLevel:         a.dispenser.GetFillLevel(),
+		LowStock:          a.dispenser.IsLowStock(),
+		Empty:             a.dispenser.IsEmpty(),
+		MotorRuntime:      int64(a.dispenser.GetMotorRuntime() / time.Millisecond),
+		Refilled:          a.dispenser.GetRefilled(),
+	}
+}
+
+func (a *Handler) getCompartments() []compartmentResponse {
+	compartments := []compartmentResponse{}
+
+	for _, c := range a.dispenser.GetCompartments() {
+		compartments = append(compartments, compartmentResponse{
+			compartment: compartment{
+				Id:      c.ID,
+				Product: c.Product,
+				Price:   c.Price,
+			},
+			Remaining:    a.dispenser.GetCompartmentRemaining(c.ID),
+			FillLevel:    a.dispenser.GetCompartmentFillLevel(c.ID),
+			LowStock:     a.dispenser.IsCompartmentLowStock(c.ID),
+			Empty:        a.dispenser.IsCompartmentEmpty(c.ID),
+			MotorRuntime: int64(a.dispenser.GetCompartmentMotorRuntime(c.ID) / time.Millisecond),
+			Refilled:     a.dispenser.GetCompartmentRefilled(c.ID),
+		})
+	}
+
+	return compartments
+}
+
+func newMotorLimits(limits sweetdb.MotorLimits) *motorLimits {
+	return &motorLimits{
+		MaxRuntime: int64(limits.MaxRuntime / time.Millisecond),
+		Cooldown:   int64(limits.Cooldown / time.Millisecond),
+		DutyCycle:  limits.DutyCycle,
+		DutyWindow: int64(limits.DutyWindow / time.Millisecond),
+	}
+}
+
+func newMotorDrive(drive sweetdb.MotorDrive) *motorDrive {
+	return &motorDrive{
+		Speed:    drive.Speed,
+		RampUp:   int64(drive.RampUp / time.Millisecond),
+		RampDown: int64(drive.RampDown / time.Millisecond),
+	}
+}
+
+func (a *Handler) getMotor() *motorResponse {
+	var faultRes *motorFaultResponse
+
+	if fault := a.dispenser.GetMotorFault(); fault != nil {
+		faultRes = &motorFaultResponse{
+			Reason:      fault.Reason,
+			Compartment: fault.Compartment,
+			Time:        fault.Time,
+		}
+	}
+
+	return &motorResponse{
+		Drive:  newMotorDrive(a.dispenser.GetMotorDrive()),
+		Limits: newMotorLimits(a.dispenser.GetMotorLimits()),
+		Fault:  faultRes,
+	}
+}
+
+func newPattern(pattern machine.Pattern) []int64 {
+	steps := []int64{}
+
+	for _, step := range pattern {
+		steps = append(steps, int64(step/time.Millisecond))
+	}
+
+	return steps
+}
+
+func newBuzzerPatterns(patterns map[string]machine.Pattern) map[string][]int64 {
+	buzzerPatterns := make(map[string][]int64)
+
+	for name, pattern := range patterns {
+		buzzerPatterns[name] = newPattern(pattern)
+	}
+
+	return buzzerPatterns
+}
+
+func parsePattern(steps []int64) machine.Pattern {
+	pattern := machine.Pattern{}
+
+	for _, step := range steps {
+		pattern = append(pattern, time.Duration(step)*time.Millisecond)
+	}
+
+	return pattern
+}
+
 func (a *Handler) getDispenser() *dispenserResponse {
 	var currentUpdateRes *dispenserUpdateResponse
 	currentUpdate, err := a.dispenser.GetCurrentUpdate()
@@ -43,12 +318,30 @@ func (a *Handler) getDispenser() *dispenserResponse {
 	}
 
 	return &dispenserResponse{
-		Name:            a.dispenser.GetName(),
-		Api:             a.dispenser.GetApiOnionID(),
-		Pos:             a.dispenser.GetPosOnionID(),
-		State:           state.String(a.dispenser.GetState()),
-		DispenseOnTouch: a.dispenser.ShouldDispenseOnTouch(),
-		Update:          currentUpdateRes,
+		Name:             a.dispenser.GetName(),
+		Api:              a.dispenser.GetApiOnionID(),
+		Pos:              a.dispenser.GetPosOnionID(),
+		State:            state.String(a.dispenser.GetState()),
+		DispenseOnTouch:  a.dispenser.ShouldDispenseOnTouch(),
+		HoldInvoices:     a.dispenser.ShouldHoldInvoices(),
+		Maintenance:      a.dispenser.IsInMaintenance(),
+		DemoMode:         a.dispenser.IsInDemoMode(),
+		Price:            a.dispenser.GetPrice(),
+		Memo:             a.dispenser.GetMemo(),
+		DispenseDuration: int64(a.dispenser.GetDispenseDuration() / time.Millisecond),
+		PriceTiers:       newPriceTiers(a.dispenser.GetPriceTiers()),
+		MaxDispense:      int64(a.dispenser.GetMaxDispenseDuration() / time.Millisecond),
+		Open:             a.dispenser.IsOpen(),
+		Quiet:            a.dispenser.IsScheduleActive(sweetdb.ScheduleQuietHours),
+		Promo:            a.dispenser.IsScheduleActive(sweetdb.SchedulePromoHours),
+		OpeningHours:     newScheduleWindows(a.dispenser.GetSchedule(sweetdb.ScheduleOpeningHours)),
+		QuietHours:       newScheduleWindows(a.dispenser.GetSchedule(sweetdb.ScheduleQuietHours)),
+		PromoHours:       newScheduleWindows(a.dispenser.GetSchedule(sweetdb.SchedulePromoHours)),
+		Inventory:        a.getInventory(),
+		Compartments:     a.getCompartments(),
+		Motor:            a.getMotor(),
+		BuzzerPatterns:   newBuzzerPatterns(a.dispenser.GetBuzzerPatterns()),
+		Update:           currentUpdateRes,
 	}
 }
 
@@ -87,6 +380,45 @@ func (a *Handler) handlePatchDispenser() http.HandlerFunc {
 						a.jsonError(w, fmt.Sprintf("%s value not a boolean, but %T", op.Name, op.Value), http.StatusBadRequest)
 						return
 					}
+				} else if op.Name == "holdInvoices" {
+					if value, ok := op.Value.(bool); ok {
+						err := a.dispenser.SetHoldInvoices(value)
+						if err != nil {
+							a.jsonError(w, "Could not set hold invoices", http.StatusInternalServerError)
+							return
+						}
+
+						res.HoldInvoices = value
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not a boolean, but %T", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == "demoMode" {
+					if value, ok := op.Value.(bool); ok {
+						err := a.dispenser.SetDemoMode(value)
+						if err != nil {
+							a.jsonError(w, "Could not set demo mode", http.StatusInternalServerError)
+							return
+						}
+
+						res.DemoMode = value
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not a boolean, but %T", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == "maintenance" {
+					if value, ok := op.Value.(bool); ok {
+						err := a.dispenser.SetMaintenance(value)
+						if err != nil {
+							a.jsonError(w, "Could not set maintenance", http.StatusInternalServerError)
+							return
+						}
+
+						res.Maintenance = value
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not a boolean, but %T", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
 				} else if op.Name == "name" {
 					if value, ok := op.Value.(string); ok {
 						err := a.dispenser.SetName(value)
@@ -100,10 +432,253 @@ func (a *Handler) handlePatchDispenser() http.HandlerFunc {
 						a.jsonError(w, fmt.Sprintf("%s value not a string, but %T", op.Name, op.Value), http.StatusInternalServerError)
 						return
 					}
+				} else if op.Name == "price" {
+					if value, ok := op.Value.(float64); ok && value == float64(int64(value)) {
+						err := a.dispenser.SetPrice(int64(value))
+						if err != nil {
+							a.jsonError(w, fmt.Sprintf("Could not set price: %v", err), http.StatusBadRequest)
+							return
+						}
+
+						res.Price = int64(value)
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not an integer, but %v", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == "memo" {
+					if value, ok := op.Value.(string); ok {
+						err := a.dispenser.SetMemo(value)
+						if err != nil {
+							a.jsonError(w, "Could not set memo", http.StatusInternalServerError)
+							return
+						}
+
+						res.Memo = a.dispenser.GetMemo()
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not a string, but %T", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == "dispenseDuration" {
+					if value, ok := op.Value.(float64); ok && value == float64(int64(value)) {
+						err := a.dispenser.SetDispenseDuration(time.Duration(value) * time.Millisecond)
+						if err != nil {
+							a.jsonError(w, fmt.Sprintf("Could not set dispense duration: %v", err), http.StatusBadRequest)
+							return
+						}
+
+						res.DispenseDuration = int64(value)
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not an integer, but %v", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == "priceTiers" {
+					value := []priceTier{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a list of tiers: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					tiers := []sweetdb.PriceTier{}
+					for _, tier := range value {
+						tiers = append(tiers, sweetdb.PriceTier{
+							Price:    tier.Price,
+							Duration: time.Duration(tier.Duration) * time.Millisecond,
+						})
+					}
+
+					err := a.dispenser.SetPriceTiers(tiers)
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set price tiers: %v", err), http.StatusBadRequest)
+						return
+					}
+
+					res.PriceTiers = newPriceTiers(a.dispenser.GetPriceTiers())
+				} else if op.Name == "maxDispenseDuration" {
+					if value, ok := op.Value.(float64); ok && value == float64(int64(value)) {
+						err := a.dispenser.SetMaxDispenseDuration(time.Duration(value) * time.Millisecond)
+						if err != nil {
+							a.jsonError(w, fmt.Sprintf("Could not set max dispense duration: %v", err), http.StatusBadRequest)
+							return
+						}
+
+						res.MaxDispense = int64(value)
+					} else {
+						a.jsonError(w, fmt.Sprintf("%s value not an integer, but %v", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+				} else if op.Name == sweetdb.ScheduleOpeningHours || op.Name == sweetdb.ScheduleQuietHours || op.Name == sweetdb.SchedulePromoHours {
+					value := []scheduleWindow{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a list of windows: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					windows, err := parseScheduleWindows(value)
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value invalid: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					err = a.dispenser.SetSchedule(op.Name, windows)
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set %s: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					current := a.getDispenser()
+					res.Open = current.Open
+					res.Quiet = current.Quiet
+					res.Promo = current.Promo
+					res.OpeningHours = current.OpeningHours
+					res.QuietHours = current.QuietHours
+					res.PromoHours = current.PromoHours
+				} else if op.Name == "gramsPerSecond" || op.Name == "hopperCapacity" || op.Name == "lowStockThreshold" {
+					value, ok := op.Value.(float64)
+					if !ok {
+						a.jsonError(w, fmt.Sprintf("%s value not a number, but %T", op.Name, op.Value), http.StatusBadRequest)
+						return
+					}
+
+					switch op.Name {
+					case "gramsPerSecond":
+						err = a.dispenser.SetGramsPerSecond(value)
+					case "hopperCapacity":
+						err = a.dispenser.SetHopperCapacity(value)
+					case "lowStockThreshold":
+						err = a.dispenser.SetLowStockThreshold(value)
+					}
+
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set %s: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					res.Inventory = a.getInventory()
+					res.Compartments = a.getCompartments()
+				} else if op.Name == "compartments" {
+					value := []compartment{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a list of compartments: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					compartments := []sweetdb.Compartment{}
+					for _, c := range value {
+						compartments = append(compartments, sweetdb.Compartment{
+							ID:      c.Id,
+							Product: c.Product,
+							Price:   c.Price,
+						})
+					}
+
+					err := a.dispenser.SetCompartments(compartments)
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set compartments: %v", err), http.StatusBadRequest)
+						return
+					}
+
+					res.Compartments = a.getCompartments()
+				} else if op.Name == "buzzerPatterns" {
+					value := map[string][]int64{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a map of patterns: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					for name, steps := range value {
+						err := a.dispenser.SetBuzzerPattern(name, parsePattern(steps))
+						if err != nil {
+							a.jsonError(w, fmt.Sprintf("Could not set buzzer pattern: %v", err), http.StatusBadRequest)
+							return
+						}
+					}
+
+					res.BuzzerPatterns = newBuzzerPatterns(a.dispenser.GetBuzzerPatterns())
+				} else if op.Name == "motorDrive" {
+					value := motorDrive{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a motor drive: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					err := a.dispenser.SetMotorDrive(sweetdb.MotorDrive{
+						Speed:    value.Speed,
+						RampUp:   time.Duration(value.RampUp) * time.Millisecond,
+						RampDown: time.Duration(value.RampDown) * time.Millisecond,
+					})
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set motor drive: %v", err), http.StatusBadRequest)
+						return
+					}
+
+					res.Motor = a.getMotor()
+				} else if op.Name == "motorLimits" {
+					value := motorLimits{}
+					if err := remarshal(op.Value, &value); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not motor limits: %v", op.Name, err), http.StatusBadRequest)
+						return
+					}
+
+					err := a.dispenser.SetMotorLimits(sweetdb.MotorLimits{
+						MaxRuntime: time.Duration(value.MaxRuntime) * time.Millisecond,
+						Cooldown:   time.Duration(value.Cooldown) * time.Millisecond,
+						DutyCycle:  value.DutyCycle,
+						DutyWindow: time.Duration(value.DutyWindow) * time.Millisecond,
+					})
+					if err != nil {
+						a.jsonError(w, fmt.Sprintf("Could not set motor limits: %v", err), http.StatusBadRequest)
+						return
+					}
+
+					res.Motor = a.getMotor()
 				} else {
 					a.jsonError(w, fmt.Sprintf("unknown field %s", op.Name), http.StatusBadRequest)
 					return
 				}
+			} else if op.Op == "previewBuzzerPattern" {
+				// preview either a saved pattern by its name or the given steps
+				pattern := a.dispenser.GetBuzzerPatterns()[op.Name]
+
+				if op.Value != nil {
+					steps := []int64{}
+					if err := remarshal(op.Value, &steps); err != nil {
+						a.jsonError(w, fmt.Sprintf("%s value not a list of durations: %v", op.Op, err), http.StatusBadRequest)
+						return
+					}
+
+					pattern = parsePattern(steps)
+				}
+
+				err := a.dispenser.PreviewBuzzerPattern(pattern)
+				if err != nil {
+					a.jsonError(w, fmt.Sprintf("Could not preview buzzer pattern: %v", err), http.StatusBadRequest)
+					return
+				}
+			} else if op.Op == "resetFault" {
+				a.dispenser.ResetMotorFault()
+
+				res.Motor = a.getMotor()
+			} else if op.Op == "refilled" {
+				// refill a single compartment if one is given, otherwise all
+				if op.Value != nil {
+					value, ok := op.Value.(float64)
+					if !ok || value != float64(int(value)) {
+						a.jsonError(w, fmt.Sprintf("%s value not a compartment, but %v", op.Op, op.Value), http.StatusBadRequest)
+						return
+					}
+
+					err = a.dispenser.RefilledCompartment(int(value))
+				} else {
+					err = a.dispenser.Refilled()
+				}
+
+				if err != nil {
+					a.jsonError(w, fmt.Sprintf("Could not refill: %v", err), http.StatusInternalServerError)
+					return
+				}
+
+				res.Inventory = a.getInventory()
+				res.Compartments = a.getCompartments()
 			} else if op.Op == "reboot" {
 				res.State = state.String(state.StateStopping)
 
@@ -115,6 +690,17 @@ func (a *Handler) handlePatchDispenser() http.HandlerFunc {
 						return
 					}
 				}()
+			} else if op.Op == "factoryReset" {
+				res.State = state.String(state.StateStopping)
+
+				go func() {
+					<-shutdownChan
+					err := a.dispenser.FactoryReset()
+					if err != nil {
+						a.log.Errorf("unable to factory reset: %v", err)
+						return
+					}
+				}()
 			} else if op.Op == "shutdown" {
 				res.State = state.String(state.StateStopping)
 
@@ -137,3 +723,13 @@ func (a *Handler) handlePatchDispenser() http.HandlerFunc {
 		close(shutdownChan)
 	}
 }
+
+// remarshal converts a generically decoded JSON value into the given type
+func remarshal(in interface{}, out interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, out)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+type dispenseResponse struct {
+	RHash       string    `json:"rHash"`
+	AmtPaidMSat int64     `json:"amtPaidMsat"`
+	Duration    int64     `json:"duration"`
+	State       string    `json:"state"`
+	Enqueued    time.Time `json:"enqueued"`
+	Completed   time.Time `json:"completed"`
+	Compartment int       `json:"compartment"`
+	Hold        bool      `json:"hold"`
+}
+
+type getDispensesResponse []*dispenseResponse
+
+func (a *Handler) handleGetDispenses() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispenses, err := a.dispenser.GetDispenses()
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		state := r.URL.Query().Get("state")
+
+		results := getDispensesResponse{}
+
+		for _, dispense := range dispenses {
+			if state != "" && dispense.State != state {
+				continue
+			}
+
+			results = append(results, &dispenseResponse{
+				RHash:       dispense.RHash,
+				AmtPaidMSat: dispense.AmtPaidMSat,
+				Duration:    int64(dispense.Duration / time.Millisecond),
+				State:       dispense.State,
+				Enqueued:    dispense.Enqueued,
+				Completed:   dispense.Completed,
+				Compartment: dispense.Compartment,
+				Hold:        dispense.Hold,
+			})
+		}
+
+		a.jsonResponse(w, &results, http.StatusOK)
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"net/http"
+	"time"
+)
+
+const (
+	eventTypeDispense = "dispense"
+	eventTypeTouch    = "touch"
+	eventTypeSettings = "settings"
+	eventTypeSchedule = "schedule"
+	eventTypeLowStock = "lowStock"
+	eventTypeRefilled = "refilled"
+	eventTypeFault    = "fault"
+	eventTypeGesture  = "gesture"
+	eventTypeSelfTest = "selfTest"
+
+	eventTypeDispenseInterrupted = "dispenseInterrupted"
+)
+
+type eventResponse struct {
+	Type      string      `json:"type"`
+	Time      time.Time   `json:"time"`
+	On        *bool       `json:"on,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Remaining *float64    `json:"remaining,omitempty"`
+	FillLevel *float64    `json:"fillLevel,omitempty"`
+	Duration  *int64      `json:"duration,omitempty"`
+
+	// RHash and AmtPaidMSat are set for events of a single payment
+	RHash       string `json:"rHash,omitempty"`
+	AmtPaidMSat *int64 `json:"amtPaidMsat,omitempty"`
+
+	// Compartment is set for events of a single compartment
+	Compartment *int `json:"compartment,omitempty"`
+}
+
+// newEventResponse converts a dispenser event into its api representation.
+// It returns nil for events that are not exposed.
+func newEventResponse(event events.Event) *eventResponse {
+	switch event := event.(type) {
+	case events.DispenseEvent:
+		return &eventResponse{
+			Type:        eventTypeDispense,
+			Time:        time.Now(),
+			On:          &event.On,
+			Compartment: &event.Compartment,
+		}
+	case events.TouchEvent:
+		return &eventResponse{
+			Type: eventTypeTouch,
+			Time: time.Now(),
+			On:   &event.On,
+		}
+	case events.GestureEvent:
+		duration := int64(event.Duration / time.Millisecond)
+
+		return &eventResponse{
+			Type:     eventTypeGesture,
+			Time:     time.Now(),
+			Name:     event.Gesture,
+			Duration: &duration,
+		}
+	case events.ScheduleEvent:
+		return &eventResponse{
+			Type: eventTypeSchedule,
+			Time: time.Now(),
+			Name: event.Name,
+			On:   &event.Active,
+		}
+	case events.LowStockEvent:
+		return &eventResponse{
+			Type:        eventTypeLowStock,
+			Time:        time.Now(),
+			Remaining:   &event.Remaining,
+			FillLevel:   &event.FillLevel,
+			Compartment: &event.Compartment,
+		}
+	case events.RefilledEvent:
+		fillLevel := 1.0
+
+		return &eventResponse{
+			Type:        eventTypeRefilled,
+			Time:        time.Now(),
+			Remaining:   &event.Capacity,
+			FillLevel:   &fillLevel,
+			Compartment: &event.Compartment,
+		}
+	case events.FaultEvent:
+		return &eventResponse{
+			Type:        eventTypeFault,
+			Time:        time.Now(),
+			On:          &event.Active,
+			Name:        event.Reason,
+			Compartment: &event.Compartment,
+		}
+	case events.DispenseInterruptedEvent:
+		return &eventResponse{
+			Type:        eventTypeDispenseInterrupted,
+			Time:        time.Now(),
+			RHash:       event.RHash,
+			AmtPaidMSat: &event.AmtPaidMSat,
+			Compartment: &event.Compartment,
+		}
+	case events.SelfTestEvent:
+		return &eventResponse{
+			Type: eventTypeSelfTest,
+			Time: time.Now(),
+			On:   &event.Passed,
+		}
+	case events.SettingsEvent:
+		return &eventResponse{
+			Type:  eventTypeSettings,
+			Time:  time.Now(),
+			Name:  event.Name,
+			Value: settingValue(event.Value),
+		}
+	default:
+		return nil
+	}
+}
+
+// settingValue converts setting values into the units used by the api
+func settingValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case time.Duration:
+		return int64(value / time.Millisecond)
+	case []sweetdb.PriceTier:
+		return newPriceTiers(value)
+	case []sweetdb.ScheduleWindow:
+		return newScheduleWindows(value)
+	case sweetdb.MotorLimits:
+		return newMotorLimits(value)
+	case sweetdb.MotorDrive:
+		return newMotorDrive(value)
+	case map[string]machine.Pattern:
+		return newBuzzerPatterns(value)
+	default:
+		return value
+	}
+}
+
+func (a *Handler) handleGetDispenserEvents() http.HandlerFunc {
+	upgrader := &websocket.Upgrader{}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := a.dispenser.SubscribeEvents()
+
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			client.Cancel()
+			a.log.Errorf("unable to upgrade: %v", err)
+			return
+		}
+
+		// read pump
+		go func() {
+			defer c.Close()
+			defer client.Cancel()
+
+			c.SetReadLimit(512)
+			c.SetReadDeadline(time.Now().Add(60 * time.Second))
+			c.SetPongHandler(func(string) error {
+				c.SetReadDeadline(time.Now().Add(60 * time.Second))
+				return nil
+			})
+
+			for {
+				_, _, err := c.ReadMessage()
+				if err != nil {
+					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+						a.log.Errorf("unexpected websocket closure: %v", err)
+					}
+					break
+				}
+			}
+		}()
+
+		// write pump
+		go func() {
+			defer c.Close()
+			defer client.Cancel()
+
+			ticker := time.NewTicker(54 * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case event, ok := <-client.Events:
+					c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+					if !ok {
+						c.WriteMessage(websocket.CloseMessage, []byte{})
+						return
+					}
+
+					res := newEventResponse(event)
+					if res == nil {
+						continue
+					}
+
+					err := c.WriteJSON(res)
+					if err != nil {
+						return
+					}
+				case <-ticker.C:
+					c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+					if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+}
@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/the-lightning-land/sweetd/lightning"
 	"github.com/the-lightning-land/sweetd/nodeman"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 const (
 	postNodesTypeRemoteLnd = "remote-lnd"
 	postNodesTypeLocal     = "local"
+	postNodesTypeCln       = "cln"
 )
 
 type postNodesRequest struct {
@@ -24,18 +27,25 @@ type postNodesRemoteLndRequest struct {
 	Uri      string `json:"uri"`
 	Macaroon string `json:"macaroon"`
 	Cert     string `json:"cert"`
+	Rest     bool   `json:"rest"`
 }
 
 type postNodesLocalRequest struct {
 	Name string `json:"name"`
 }
 
+type postNodesClnRequest struct {
+	Name       string `json:"name"`
+	SocketPath string `json:"socketPath"`
+}
+
 type postNodesRemoteLndResponse struct {
 	ID      string `json:"id"`
 	Type    string `json:"type"`
 	Uri     string `json:"uri"`
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
+	Rest    bool   `json:"rest"`
 }
 
 type postNodesLocalResponse struct {
@@ -45,19 +55,75 @@ type postNodesLocalResponse struct {
 	Enabled bool   `json:"enabled"`
 }
 
+type postNodesClnResponse struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	SocketPath string `json:"socketPath"`
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+}
+
 type getNodesRemoteLndResponse struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Uri     string `json:"uri"`
-	Name    string `json:"name"`
-	Enabled bool   `json:"enabled"`
+	ID      string              `json:"id"`
+	Type    string              `json:"type"`
+	Uri     string              `json:"uri"`
+	Name    string              `json:"name"`
+	Enabled bool                `json:"enabled"`
+	Rest    bool                `json:"rest"`
+	Status  *nodeStatusResponse `json:"status"`
 }
 
 type getNodesLocalLndResponse struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Enabled bool   `json:"enabled"`
+	ID      string              `json:"id"`
+	Type    string              `json:"type"`
+	Name    string              `json:"name"`
+	Enabled bool                `json:"enabled"`
+	Status  *nodeStatusResponse `json:"status"`
+}
+
+type getNodesClnResponse struct {
+	ID         string              `json:"id"`
+	Type       string              `json:"type"`
+	SocketPath string              `json:"socketPath"`
+	Name       string              `json:"name"`
+	Enabled    bool                `json:"enabled"`
+	Status     *nodeStatusResponse `json:"status"`
+}
+
+type nodeStatusResponse struct {
+	Reachable      bool       `json:"reachable"`
+	SyncedToChain  bool       `json:"syncedToChain"`
+	BlockHeight    uint32     `json:"blockHeight"`
+	ActiveChannels uint32     `json:"activeChannels"`
+	InboundMSat    int64      `json:"inboundMsat"`
+	BalanceMSat    int64      `json:"balanceMsat"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastErrorAt    *time.Time `json:"lastErrorAt,omitempty"`
+	Checked        *time.Time `json:"checked,omitempty"`
+	Connection     string     `json:"connection"`
+}
+
+func newNodeStatusResponse(status lightning.NodeStatus) *nodeStatusResponse {
+	res := &nodeStatusResponse{
+		Reachable:      status.Reachable,
+		SyncedToChain:  status.SyncedToChain,
+		BlockHeight:    status.BlockHeight,
+		ActiveChannels: status.ActiveChannels,
+		InboundMSat:    status.InboundMSat,
+		BalanceMSat:    status.BalanceMSat,
+		LastError:      status.LastError,
+		Connection:     status.ConnectionState,
+	}
+
+	if !status.LastErrorAt.IsZero() {
+		res.LastErrorAt = &status.LastErrorAt
+	}
+
+	if !status.Checked.IsZero() {
+		res.Checked = &status.Checked
+	}
+
+	return res
 }
 
 type getNodesResponse []interface{}
@@ -102,21 +168,29 @@ func (a *Handler) postNodes() http.HandlerFunc {
 				Uri:      req.Uri,
 				Macaroon: macaroonBytes,
 				Cert:     []byte(req.Cert),
+				Rest:     req.Rest,
 			})
 			if err != nil {
 				a.jsonError(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			remoteLndNode := node.(*nodeman.RemoteLndNode)
-
-			a.jsonResponse(w, &postNodesRemoteLndResponse{
-				ID:      remoteLndNode.ID(),
+			res := &postNodesRemoteLndResponse{
+				ID:      node.ID(),
 				Type:    postNodesTypeRemoteLnd,
-				Uri:     remoteLndNode.Uri,
-				Name:    remoteLndNode.Name(),
-				Enabled: remoteLndNode.Enabled(),
-			}, http.StatusOK)
+				Name:    node.Name(),
+				Enabled: node.Enabled(),
+				Rest:    req.Rest,
+			}
+
+			switch node := node.(type) {
+			case *nodeman.RemoteLndNode:
+				res.Uri = node.Uri
+			case *nodeman.RemoteLndRestNode:
+				res.Uri = node.Uri
+			}
+
+			a.jsonResponse(w, res, http.StatusOK)
 		case postNodesTypeLocal:
 			req := postNodesLocalRequest{}
 			err := json.Unmarshal(body, &req)
@@ -141,6 +215,37 @@ func (a *Handler) postNodes() http.HandlerFunc {
 				Name:    localNode.Name(),
 				Enabled: localNode.Enabled(),
 			}, http.StatusOK)
+		case postNodesTypeCln:
+			req := postNodesClnRequest{}
+			err := json.Unmarshal(body, &req)
+			if err != nil {
+				a.jsonError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if req.SocketPath == "" {
+				a.jsonError(w, "socket path is required", http.StatusBadRequest)
+				return
+			}
+
+			node, err := a.dispenser.AddNode(&nodeman.ClnNodeConfig{
+				Name:       req.Name,
+				SocketPath: req.SocketPath,
+			})
+			if err != nil {
+				a.jsonError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			clnNode := node.(*nodeman.ClnNode)
+
+			a.jsonResponse(w, &postNodesClnResponse{
+				ID:         clnNode.ID(),
+				Type:       postNodesTypeCln,
+				SocketPath: clnNode.SocketPath,
+				Name:       clnNode.Name(),
+				Enabled:    clnNode.Enabled(),
+			}, http.StatusOK)
 		default:
 			a.jsonError(w, fmt.Sprintf("unknown type \"%s\"", req.Type), http.StatusBadRequest)
 		}
@@ -162,6 +267,17 @@ func (a *Handler) getNodes() http.HandlerFunc {
 					Uri:     node.Uri,
 					Name:    node.Name(),
 					Enabled: node.Enabled(),
+					Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
+				})
+			case *nodeman.RemoteLndRestNode:
+				results = append(results, &getNodesRemoteLndResponse{
+					ID:      node.ID(),
+					Type:    postNodesTypeRemoteLnd,
+					Uri:     node.Uri,
+					Name:    node.Name(),
+					Enabled: node.Enabled(),
+					Rest:    true,
+					Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
 				})
 			case *nodeman.LocalNode:
 				results = append(results, &getNodesLocalLndResponse{
@@ -169,6 +285,16 @@ func (a *Handler) getNodes() http.HandlerFunc {
 					Type:    postNodesTypeLocal,
 					Name:    node.Name(),
 					Enabled: node.Enabled(),
+					Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
+				})
+			case *nodeman.ClnNode:
+				results = append(results, &getNodesClnResponse{
+					ID:         node.ID(),
+					Type:       postNodesTypeCln,
+					SocketPath: node.SocketPath,
+					Name:       node.Name(),
+					Enabled:    node.Enabled(),
+					Status:     newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
 				})
 			default:
 				a.log.Warnf("got unknown type of node %T", node)
@@ -179,6 +305,20 @@ func (a *Handler) getNodes() http.HandlerFunc {
 	}
 }
 
+func (a *Handler) getNodeStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		if a.dispenser.GetNode(id) == nil {
+			a.jsonError(w, fmt.Sprintf("node %s not found", id), http.StatusNotFound)
+			return
+		}
+
+		a.jsonResponse(w, newNodeStatusResponse(a.dispenser.GetNodeStatus(id)), http.StatusOK)
+	}
+}
+
 func (a *Handler) deleteNode() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -242,6 +382,18 @@ func (a *Handler) patchNode() http.HandlerFunc {
 				Uri:     node.Uri,
 				Name:    node.Name(),
 				Enabled: node.Enabled(),
+				Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
+			}, http.StatusOK)
+			return
+		case *nodeman.RemoteLndRestNode:
+			a.jsonResponse(w, &getNodesRemoteLndResponse{
+				ID:      node.ID(),
+				Type:    postNodesTypeRemoteLnd,
+				Uri:     node.Uri,
+				Name:    node.Name(),
+				Enabled: node.Enabled(),
+				Rest:    true,
+				Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
 			}, http.StatusOK)
 			return
 		case *nodeman.LocalNode:
@@ -250,6 +402,17 @@ func (a *Handler) patchNode() http.HandlerFunc {
 				Type:    postNodesTypeLocal,
 				Name:    node.Name(),
 				Enabled: node.Enabled(),
+				Status:  newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
+			}, http.StatusOK)
+			return
+		case *nodeman.ClnNode:
+			a.jsonResponse(w, &getNodesClnResponse{
+				ID:         node.ID(),
+				Type:       postNodesTypeCln,
+				SocketPath: node.SocketPath,
+				Name:       node.Name(),
+				Enabled:    node.Enabled(),
+				Status:     newNodeStatusResponse(a.dispenser.GetNodeStatus(node.ID())),
 			}, http.StatusOK)
 			return
 		default:
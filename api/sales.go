@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSalesLimit = 50
+	maxSalesLimit     = 500
+)
+
+type saleResponse struct {
+	RHash       string    `json:"rHash"`
+	AmtPaidMSat int64     `json:"amtPaidMsat"`
+	NodeId      string    `json:"nodeId"`
+	Settled     time.Time `json:"settled"`
+	Duration    int64     `json:"duration"`
+	Outcome     string    `json:"outcome"`
+	Compartment int       `json:"compartment"`
+	Product     string    `json:"product"`
+}
+
+type getSalesResponse []*saleResponse
+
+func newSaleResponse(sale *sweetdb.Sale) *saleResponse {
+	return &saleResponse{
+		RHash:       sale.RHash,
+		AmtPaidMSat: sale.AmtPaidMSat,
+		NodeId:      sale.NodeId,
+		Settled:     sale.Settled,
+		Duration:    int64(sale.Duration / time.Millisecond),
+		Outcome:     sale.Outcome,
+		Compartment: sale.Compartment,
+		Product:     sale.Product,
+	}
+}
+
+// parseTimeRange reads the optional from and to query parameters
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from time: %v", err)
+		}
+	}
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to time: %v", err)
+		}
+	}
+
+	return from, to, nil
+}
+
+// parseIntParam reads an optional non-negative integer query parameter
+func parseIntParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s %s", name, value)
+	}
+
+	return i, nil
+}
+
+func (a *Handler) handleGetSales() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseTimeRange(r)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		offset, err := parseIntParam(r, "offset", 0)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := parseIntParam(r, "limit", defaultSalesLimit)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if limit > maxSalesLimit {
+			limit = maxSalesLimit
+		}
+
+		sales, err := a.dispenser.GetSales(from, to)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		results := getSalesResponse{}
+
+		for i := offset; i < len(sales) && i < offset+limit; i++ {
+			results = append(results, newSaleResponse(sales[i]))
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(sales)))
+
+		a.jsonResponse(w, &results, http.StatusOK)
+	}
+}
+
+func (a *Handler) handleExportSales() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseTimeRange(r)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+
+		if format != "csv" && format != "json" {
+			a.jsonError(w, fmt.Sprintf("unknown format %s", format), http.StatusBadRequest)
+			return
+		}
+
+		sales, err := a.dispenser.GetSales(from, to)
+		if err != nil {
+			a.jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sales.%s\"", format))
+
+		if format == "json" {
+			results := getSalesResponse{}
+
+			for _, sale := range sales {
+				results = append(results, newSaleResponse(sale))
+			}
+
+			a.jsonResponse(w, &results, http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+
+		writer := csv.NewWriter(w)
+
+		err = writer.Write([]string{"r_hash", "amt_paid_msat", "node_id", "settled", "duration_ms", "outcome", "compartment", "product"})
+		if err != nil {
+			a.log.Errorf("Could not write CSV: %v", err)
+			return
+		}
+
+		for _, sale := range sales {
+			err := writer.Write([]string{
+				sale.RHash,
+				strconv.FormatInt(sale.AmtPaidMSat, 10),
+				sale.NodeId,
+				sale.Settled.Format(time.RFC3339),
+				strconv.FormatInt(int64(sale.Duration/time.Millisecond), 10),
+				sale.Outcome,
+				strconv.Itoa(sale.Compartment),
+				sale.Product,
+			})
+			if err != nil {
+				a.log.Errorf("Could not write CSV: %v", err)
+				return
+			}
+		}
+
+		writer.Flush()
+
+		if err := writer.Error(); err != nil {
+			a.log.Errorf("Could not write CSV: %v", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"github.com/the-lightning-land/sweetd/machine"
+	"net/http"
+	"time"
+)
+
+type selfTestCheckResponse struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message"`
+}
+
+type selfTestResponse struct {
+	Started  time.Time                `json:"started"`
+	Finished time.Time                `json:"finished"`
+	Passed   bool                     `json:"passed"`
+	Checks   []*selfTestCheckResponse `json:"checks"`
+}
+
+func newSelfTestResponse(report *machine.SelfTestReport) *selfTestResponse {
+	res := &selfTestResponse{
+		Started:  report.Started,
+		Finished: report.Finished,
+		Passed:   report.Passed,
+		Checks:   []*selfTestCheckResponse{},
+	}
+
+	for _, check := range report.Checks {
+		res.Checks = append(res.Checks, &selfTestCheckResponse{
+			Name:     check.Name,
+			Passed:   check.Passed,
+			Verified: check.Verified,
+			Message:  check.Message,
+		})
+	}
+
+	return res
+}
+
+func (a *Handler) handleGetSelfTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := a.dispenser.GetSelfTestReport()
+		if report == nil {
+			a.jsonError(w, "No self test was run yet", http.StatusNotFound)
+			return
+		}
+
+		a.jsonResponse(w, newSelfTestResponse(report), http.StatusOK)
+	}
+}
+
+func (a *Handler) handlePostSelfTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := a.dispenser.RunSelfTest()
+
+		a.jsonResponse(w, newSelfTestResponse(report), http.StatusOK)
+	}
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"github.com/jessevdk/go-flags"
+	"github.com/the-lightning-land/sweetd/machine"
+	"time"
 )
 
 type raspberryConfig struct {
-	TouchPin  string `long:"touchpin" description:"BCM number of the touch input pin."`
-	MotorPin  string `long:"motorpin" description:"BCM number of the motor output pin."`
-	BuzzerPin string `long:"buzzerpin" description:"BCM number of the buzzer output pin."`
+	Profile       string        `long:"profile" description:"Path to a hardware profile describing every input and output. Replaces the pin flags."`
+	TouchPin      string        `long:"touchpin" description:"BCM number of the touch input pin."`
+	TouchDebounce time.Duration `long:"touchdebounce" description:"Least time the touch input has to be high before a touch is reported."`
+	ButtonPin     string        `long:"buttonpin" description:"BCM number of an optional service button input pin."`
+	MotorPin      string        `long:"motorpin" description:"BCM number of the motor output pin."`
+	BuzzerPin     string        `long:"buzzerpin" description:"BCM number of the buzzer output pin."`
+	LedPin        string        `long:"ledpin" description:"BCM number of an optional status LED output pin."`
+	LedRedPin     string        `long:"ledredpin" description:"BCM number of an optional red status LED output pin."`
+	LedGreenPin   string        `long:"ledgreenpin" description:"BCM number of an optional green status LED output pin."`
+	LedBluePin    string        `long:"ledbluepin" description:"BCM number of an optional blue status LED output pin."`
 }
 
-type mockConfig struct {
-	Listen string `long:"listen" description:"Add an interface/port to listen for mock touches."`
+type simulatorConfig struct {
+	Listen       string `long:"listen" description:"Add an interface/port to serve the simulator panel on."`
+	Compartments int    `long:"compartments" description:"Number of compartments with a motor of their own, at least one."`
+	Replay       string `long:"replay" description:"Replay a recording of hardware events once the dispenser started."`
 }
 
 type torConfig struct {
@@ -33,9 +44,12 @@ type pairingConfig struct {
 type config struct {
 	ShowVersion bool             `short:"v" long:"version" description:"Display version information and exit."`
 	Debug       bool             `long:"debug" description:"Start in debug mode."`
-	Machine     string           `long:"machine" description:"The machine controller to use." choice:"raspberry" choice:"mock"`
+	Machine     string           `long:"machine" description:"The machine controller to use." choice:"raspberry" choice:"simulator" choice:"mock"`
+	SelfTest    bool             `long:"selftest" description:"Run a self test of the machine at boot."`
+	Record      string           `long:"record" description:"Record touches, motor and buzzer toggles and payments to the given file."`
 	Raspberry   *raspberryConfig `group:"Raspberry" namespace:"raspberry"`
-	Mock        *mockConfig      `group:"Mock" namespace:"mock"`
+	Simulator   *simulatorConfig `group:"Simulator" namespace:"simulator"`
+	Mock        *simulatorConfig `group:"Mock" namespace:"mock" description:"Deprecated, use the simulator instead."`
 	Net         *networkConfig   `group:"Network" namespace:"network"`
 	Pairing     *pairingConfig   `group:"Pairing" namespace:"pairing"`
 	DataDir     string           `long:"datadir" description:"The directory to store sweetd's data within.'"`
@@ -49,9 +63,10 @@ func loadConfig() (*config, error) {
 		Machine: "raspberry",
 		Debug:   false,
 		Raspberry: &raspberryConfig{
-			TouchPin:  "25",
-			MotorPin:  "23",
-			BuzzerPin: "24",
+			TouchPin:      "25",
+			TouchDebounce: machine.DefaultTouchDebounce,
+			MotorPin:      "23",
+			BuzzerPin:     "24",
 		},
 		Net:     nil,
 		Pairing: nil,
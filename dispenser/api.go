@@ -1,13 +1,21 @@
 package dispenser
 
 import (
+	"context"
 	"github.com/go-errors/errors"
 	"net"
 	"net/http"
 	"sync"
+	"time"
 )
 
-func (d *Dispenser) runApi(wg sync.WaitGroup) error {
+const (
+	// serverShutdownTimeout is how long running requests may take to
+	// finish when the dispenser is stopped
+	serverShutdownTimeout = 10 * time.Second
+)
+
+func (d *Dispenser) runApi(wg *sync.WaitGroup) error {
 	listener, err := net.Listen("tcp", ":9000")
 	if err != nil {
 		return errors.Errorf("unable to listen: %v", err)
@@ -16,14 +24,14 @@ func (d *Dispenser) runApi(wg sync.WaitGroup) error {
 	// point the onion service to the listener
 	d.apiOnionService.SetListener(listener)
 
-	go func() {
-		wg.Add(1)
+	server := &http.Server{Handler: d.apiHandler}
 
-		go func() {
-			wg.Add(1)
+	wg.Add(2)
 
-			err := http.Serve(listener, d.apiHandler)
-			if err != nil {
+	go func() {
+		go func() {
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
 				d.log.Errorf("unable to serve: %v", err)
 			}
 
@@ -54,11 +62,13 @@ func (d *Dispenser) runApi(wg sync.WaitGroup) error {
 			}
 		}
 
-		if listener != nil {
-			err = listener.Close()
-			if err != nil {
-				d.log.Errorf("could not close api listener: %v", err)
-			}
+		// closes the listener and lets running requests finish, as they may
+		// still send events
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		err = server.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			d.log.Errorf("could not shut down api server: %v", err)
 		}
 
 		networkClient.Cancel()
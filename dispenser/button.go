@@ -0,0 +1,120 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+	"sync"
+	"time"
+)
+
+const (
+	// factoryResetConfirmTimeout is how long a factory reset requested with
+	// the service button awaits confirmation by a short press
+	factoryResetConfirmTimeout = 10 * time.Second
+)
+
+// handleButton is run as a goroutine and acts on service button presses
+func (d *Dispenser) handleButton(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	buttonClient := d.machine.SubscribeButton()
+	defer buttonClient.Cancel()
+
+	for {
+		select {
+		case press := <-buttonClient.Presses:
+			d.log.Infof("Service button %v press", press)
+
+			d.handleButtonPress(press)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *Dispenser) handleButtonPress(press machine.ButtonPress) {
+	switch press {
+	case machine.ButtonPressShort:
+		if d.isFactoryResetArmed() {
+			d.factoryResetArmed = time.Time{}
+
+			err := d.FactoryReset()
+			if err != nil {
+				d.log.Errorf("Could not factory reset: %v", err)
+				d.playSound(SoundError)
+			}
+
+			return
+		}
+
+		err := d.pairing.Advertise()
+		if err != nil {
+			d.log.Errorf("unable to advertise: %v", err)
+			d.playSound(SoundError)
+			return
+		}
+
+		d.pairingMode = true
+		d.playSound(SoundPairing)
+	case machine.ButtonPressLong:
+		err := d.SetMaintenance(!d.maintenance)
+		if err != nil {
+			d.log.Errorf("Could not toggle maintenance: %v", err)
+		}
+	case machine.ButtonPressVeryLong:
+		d.log.Warnf("Factory reset requested, confirm with a short press within %v", factoryResetConfirmTimeout)
+
+		d.factoryResetArmed = time.Now()
+
+		// warn about the pending reset regardless of quiet hours
+		d.machine.PlayPattern(d.GetBuzzerPattern(SoundError), true)
+	}
+}
+
+// isFactoryResetArmed tells if a requested factory reset awaits confirmation
+func (d *Dispenser) isFactoryResetArmed() bool {
+	return !d.factoryResetArmed.IsZero() && time.Since(d.factoryResetArmed) < factoryResetConfirmTimeout
+}
+
+// IsInMaintenance tells if sales are refused while the dispenser is serviced
+func (d *Dispenser) IsInMaintenance() bool {
+	return d.maintenance
+}
+
+// SetMaintenance enters or leaves maintenance mode. Payments are refused
+// and queued dispenses wait until maintenance is over.
+func (d *Dispenser) SetMaintenance(maintenance bool) error {
+	if d.maintenance == maintenance {
+		return nil
+	}
+
+	if maintenance {
+		d.log.Infof("Entering maintenance mode")
+	} else {
+		d.log.Infof("Leaving maintenance mode")
+	}
+
+	d.maintenance = maintenance
+
+	if !maintenance {
+		d.releaseMotor()
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "maintenance", Value: maintenance})
+
+	return nil
+}
+
+// FactoryReset wipes all configuration, keeping the records of payments,
+// and reboots the dispenser
+func (d *Dispenser) FactoryReset() error {
+	d.log.Warnf("Resetting to factory settings")
+
+	err := d.db.Wipe()
+	if err != nil {
+		return errors.Errorf("Could not wipe database: %v", err)
+	}
+
+	return d.Reboot()
+}
@@ -1,14 +1,68 @@
 package dispenser
 
-type DispenseClient struct {
-	Dispenser  chan *Dispenser
-	Dispenses  chan DispenseState
-	Id         uint32
-	cancelChan chan struct{}
-	dispenser  *Dispenser
+import "github.com/the-lightning-land/sweetd/events"
+
+// SubscribeEvents subscribes to all events of the dispenser. Events are
+// dropped for subscribers that do not keep up with receiving them. Each
+// subscriber first receives the dispenses interrupted by the previous
+// shutdown.
+func (d *Dispenser) SubscribeEvents() *events.Client {
+	eventsChan := make(chan events.Event, 16)
+
+	d.nextClient.Lock()
+	id := d.nextClient.id
+	d.nextClient.id++
+	d.eventsClients[id] = eventsChan
+
+	for _, event := range d.interruptedEvents {
+		select {
+		case eventsChan <- event:
+		default:
+			d.log.Warnf("dropped event %T for slow subscriber %d", event, id)
+		}
+	}
+
+	d.nextClient.Unlock()
+
+	return &events.Client{
+		Events: eventsChan,
+		Cancel: func() {
+			d.unsubscribeEvents(id)
+		},
+	}
+}
+
+func (d *Dispenser) unsubscribeEvents(id uint32) {
+	d.nextClient.Lock()
+	defer d.nextClient.Unlock()
+
+	if eventsChan, ok := d.eventsClients[id]; ok {
+		delete(d.eventsClients, id)
+		close(eventsChan)
+	}
+}
+
+// notifyEventsClients passes an event on to all subscribers
+func (d *Dispenser) notifyEventsClients(event events.Event) {
+	d.nextClient.Lock()
+	defer d.nextClient.Unlock()
+
+	for id, eventsChan := range d.eventsClients {
+		select {
+		case eventsChan <- event:
+		default:
+			d.log.Warnf("dropped event %T for slow subscriber %d", event, id)
+		}
+	}
 }
 
-func (c *DispenseClient) Cancel() {
-	delete(c.dispenser.dispenseClients, c.Id)
-	close(c.cancelChan)
+// cancelEventsClients closes all subscriptions
+func (d *Dispenser) cancelEventsClients() {
+	d.nextClient.Lock()
+	defer d.nextClient.Unlock()
+
+	for id, eventsChan := range d.eventsClients {
+		delete(d.eventsClients, id)
+		close(eventsChan)
+	}
 }
@@ -0,0 +1,142 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+)
+
+// restoreCompartments loads the products that are mapped to compartments
+func (d *Dispenser) restoreCompartments() {
+	compartments, err := d.db.GetCompartments()
+	if err != nil {
+		d.log.Errorf("could not get compartments: %v", err)
+	}
+
+	d.compartments = compartments
+}
+
+// defaultCompartment is dispensed from by touches and by payments that did
+// not ask for a product
+func (d *Dispenser) defaultCompartment() int {
+	compartments := d.machine.Compartments()
+	if len(compartments) == 0 {
+		return machine.DefaultCompartment
+	}
+
+	return compartments[0]
+}
+
+// hasCompartment tells if the machine has a motor for the compartment
+func (d *Dispenser) hasCompartment(id int) bool {
+	for _, compartment := range d.machine.Compartments() {
+		if compartment == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCompartment returns the product mapping of a compartment of the machine
+func (d *Dispenser) GetCompartment(id int) sweetdb.Compartment {
+	for _, compartment := range d.compartments {
+		if compartment.ID == id {
+			return compartment
+		}
+	}
+
+	return sweetdb.Compartment{ID: id}
+}
+
+// GetCompartments returns the product mapping of every compartment of the
+// machine, including those that were never configured
+func (d *Dispenser) GetCompartments() []sweetdb.Compartment {
+	compartments := []sweetdb.Compartment{}
+
+	for _, id := range d.machine.Compartments() {
+		compartments = append(compartments, d.GetCompartment(id))
+	}
+
+	return compartments
+}
+
+func (d *Dispenser) SetCompartments(compartments []sweetdb.Compartment) error {
+	d.log.Infof("Setting compartments")
+
+	seen := make(map[int]bool)
+
+	for _, compartment := range compartments {
+		if !d.hasCompartment(compartment.ID) {
+			return errors.Errorf("Machine has no compartment %d", compartment.ID)
+		}
+
+		if seen[compartment.ID] {
+			return errors.Errorf("Compartment %d is set more than once", compartment.ID)
+		}
+
+		seen[compartment.ID] = true
+
+		if compartment.Price < 0 {
+			return errors.Errorf("Compartment price must not be negative, got %d", compartment.Price)
+		}
+	}
+
+	err := d.db.SetCompartments(compartments)
+	if err != nil {
+		return errors.Errorf("Failed setting compartments: %v", err)
+	}
+
+	d.compartments = compartments
+
+	d.sendEvent(events.SettingsEvent{Name: "compartments", Value: compartments})
+
+	return nil
+}
+
+// ResolveCompartment finds the compartment to dispense from for a product
+// or an explicitly chosen compartment. Among compartments holding the same
+// product, the first one that is not empty is chosen. Without either, the
+// default compartment is used.
+func (d *Dispenser) ResolveCompartment(product string, compartment *int) (int, error) {
+	if compartment != nil {
+		if !d.hasCompartment(*compartment) {
+			return 0, errors.Errorf("Unknown compartment %d", *compartment)
+		}
+
+		if product != "" && d.GetCompartment(*compartment).Product != product {
+			return 0, errors.Errorf("Compartment %d does not hold %s", *compartment, product)
+		}
+
+		return *compartment, nil
+	}
+
+	if product == "" {
+		return d.defaultCompartment(), nil
+	}
+
+	found := false
+	resolved := 0
+
+	for _, c := range d.GetCompartments() {
+		if c.Product != product {
+			continue
+		}
+
+		if !d.IsCompartmentEmpty(c.ID) {
+			return c.ID, nil
+		}
+
+		if !found {
+			found = true
+			resolved = c.ID
+		}
+	}
+
+	if !found {
+		return 0, errors.Errorf("Unknown product %s", product)
+	}
+
+	return resolved, nil
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/the-lightning-land/sweetd/api"
 	"github.com/the-lightning-land/sweetd/app"
-	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/events"
 	"github.com/the-lightning-land/sweetd/machine"
 	"github.com/the-lightning-land/sweetd/network"
 	"github.com/the-lightning-land/sweetd/nodeman"
@@ -24,11 +24,26 @@ import (
 	"time"
 )
 
-type DispenseState int
-
 const (
-	DispenseStateOn DispenseState = iota
-	DispenseStateOff
+	// defaultPrice is the price in satoshis that is used as long as
+	// no price has been configured
+	defaultPrice = 8
+
+	// defaultMemo is the invoice memo template that is used as long as
+	// no memo has been configured
+	defaultMemo = "Candy for {price} satoshis"
+
+	// defaultDispenseDuration is the time the motor runs for a single
+	// payment as long as no dispense duration has been configured
+	defaultDispenseDuration = 1500 * time.Millisecond
+
+	// defaultMaxDispenseDuration caps the time the motor runs for a
+	// single payment as long as no cap has been configured
+	defaultMaxDispenseDuration = 10 * time.Second
+
+	// freeSampleDuration is the time the motor runs for a free sample
+	// in demo mode
+	freeSampleDuration = 500 * time.Millisecond
 )
 
 type nextClient struct {
@@ -46,12 +61,34 @@ type Config struct {
 	Network  network.Network
 	Nodeman  *nodeman.Nodeman
 	Pairing  pairing.Controller
+
+	// SelfTestOnBoot runs a self test of the machine during startup
+	SelfTestOnBoot bool
+
+	// Recorder optionally records the payments that lead to dispenses
+	Recorder *machine.Recorder
 }
 
 type Dispenser struct {
 	// machine handles the touch sensor and physical dispensing and buzzing
 	machine machine.Machine
 
+	// safety enforces limits on the motor of the machine
+	safety *machine.SafeMachine
+
+	// motorDrive is the speed and ramps the motor is driven with
+	motorDrive sweetdb.MotorDrive
+
+	// motorFaults signals whenever the safety layer stopped the motor
+	motorFaults chan struct{}
+
+	// motorReleased signals whenever a motor fault was reset or maintenance
+	// is over, so that waiting dispenses continue
+	motorReleased chan struct{}
+
+	// recorder records payments next to the hardware events, if enabled
+	recorder *machine.Recorder
+
 	// network manages network connections
 	network network.Network
 
@@ -67,6 +104,87 @@ type Dispenser struct {
 	// buzzOnDispense indicates if the dispenser should buzz during dispensing
 	buzzOnDispense bool
 
+	// holdInvoices indicates if payments are held until dispensing succeeded
+	holdInvoices bool
+
+	// holdWatches are the payment hashes of hold invoices being watched
+	holdWatches      map[string]bool
+	holdWatchesMutex sync.Mutex
+
+	// demoMode indicates if a long press on the touch sensor dispenses a
+	// free sample
+	demoMode bool
+
+	// price is the amount of satoshis a single dispense costs
+	price int64
+
+	// memo is the template for memos of created invoices
+	memo string
+
+	// dispenseDuration is the time the motor runs for a single payment
+	dispenseDuration time.Duration
+
+	// priceTiers map paid amounts to dispense durations
+	priceTiers []sweetdb.PriceTier
+
+	// maxDispenseDuration caps the time the motor runs for a single payment
+	maxDispenseDuration time.Duration
+
+	// gramsPerSecond is the calibrated quantity the motor dispenses per second
+	gramsPerSecond float64
+
+	// hopperCapacity is the quantity in grams of a full hopper
+	hopperCapacity float64
+
+	// lowStockThreshold is the quantity in grams below which stock is low
+	lowStockThreshold float64
+
+	// inventories hold the stock of every compartment
+	inventories map[int]*compartmentInventory
+
+	// inventoryMutex guards the inventories
+	inventoryMutex sync.Mutex
+
+	// compartments map the compartments of the machine to products
+	compartments []sweetdb.Compartment
+
+	// buzzerPatterns are the configured patterns played for events
+	buzzerPatterns map[string]machine.Pattern
+
+	// buzzerPatternsMutex guards buzzer patterns
+	buzzerPatternsMutex sync.RWMutex
+
+	// schedules holds the time windows of all schedules
+	schedules map[string][]sweetdb.ScheduleWindow
+
+	// activeSchedules tells which schedules apply at the moment
+	activeSchedules map[string]bool
+
+	// schedulesMutex guards schedules and active schedules
+	schedulesMutex sync.RWMutex
+
+	// networkConnected indicates if the network is connected
+	networkConnected bool
+
+	// selfTestOnBoot indicates if the machine is tested during startup
+	selfTestOnBoot bool
+
+	// selfTestReport is the outcome of the last self test
+	selfTestReport *machine.SelfTestReport
+
+	// selfTestMutex guards the self test report
+	selfTestMutex sync.Mutex
+
+	// pairingMode indicates if the dispenser advertises itself for pairing
+	pairingMode bool
+
+	// maintenance indicates if the dispenser refuses sales while it is serviced
+	maintenance bool
+
+	// factoryResetArmed is when a factory reset was requested with the
+	// service button, or zero if none awaits confirmation
+	factoryResetArmed time.Time
+
 	// apiOnionService
 	apiOnionService *onion.Service
 
@@ -76,18 +194,22 @@ type Dispenser struct {
 	// done can be closed when the dispenser should be shutdown
 	done chan struct{}
 
-	// dispenses signals whenever
-	dispenses chan DispenseState
+	// events signals whenever something happens on the dispenser
+	events chan events.Event
 
-	// payments
-	payments chan *lightning.Invoice
+	// queued signals whenever new dispenses were added to the dispense queue
+	queued chan struct{}
 
-	// subscribers to dispense events
-	dispenseClients map[uint32]*DispenseClient
+	// subscribers to dispenser events
+	eventsClients map[uint32]chan events.Event
 
-	// next dispense event client information
+	// next events client information, also guarding the subscribers
 	nextClient nextClient
 
+	// interruptedEvents tell every new subscriber about dispenses that
+	// were interrupted by the previous shutdown, guarded by nextClient
+	interruptedEvents []events.Event
+
 	// updater handles system updates
 	updater updater.Updater
 
@@ -120,11 +242,20 @@ func NewDispenser(config *Config) *Dispenser {
 	dispenser := &Dispenser{
 		nodeman:         config.Nodeman,
 		pairing:         config.Pairing,
-		machine:         config.Machine,
+		selfTestOnBoot:  config.SelfTestOnBoot,
+		motorFaults:     make(chan struct{}, 1),
+		motorReleased:   make(chan struct{}, 1),
+		recorder:        config.Recorder,
+		motorDrive:      defaultMotorDrive,
 		network:         config.Network,
 		db:              config.DB,
-		payments:        make(chan *lightning.Invoice),
-		dispenseClients: make(map[uint32]*DispenseClient),
+		queued:          make(chan struct{}, 1),
+		eventsClients:   make(map[uint32]chan events.Event),
+		inventories:     make(map[int]*compartmentInventory),
+		buzzerPatterns:  make(map[string]machine.Pattern),
+		schedules:       make(map[string][]sweetdb.ScheduleWindow),
+		activeSchedules: make(map[string]bool),
+		holdWatches:     make(map[string]bool),
 		updater:         config.Updater,
 		sweetLog:        config.SweetLog,
 		log:             config.Logger,
@@ -140,6 +271,15 @@ func NewDispenser(config *Config) *Dispenser {
 		}),
 	}
 
+	// the motor is only ever driven through the safety layer
+	dispenser.safety = machine.NewSafeMachine(&machine.SafeMachineConfig{
+		Machine: config.Machine,
+		Limits:  newSafetyLimits(defaultMotorLimits),
+		OnFault: dispenser.handleMotorFault,
+	})
+
+	dispenser.machine = dispenser.safety
+
 	dispenser.posHandler = pos.NewHandler(&pos.Config{
 		Logger:    config.Logger.WithField("system", "pos"),
 		Dispenser: dispenser,
@@ -186,6 +326,88 @@ func (d *Dispenser) restoreConfigs() {
 
 	d.buzzOnDispense = buzzOnDispense
 
+	holdInvoices, err := d.db.GetHoldInvoices()
+	if err != nil {
+		d.log.Errorf("could not get hold invoices: %v", err)
+	}
+
+	d.holdInvoices = holdInvoices
+
+	demoMode, err := d.db.GetDemoMode()
+	if err != nil {
+		d.log.Errorf("could not get demo mode: %v", err)
+	}
+
+	d.demoMode = demoMode
+
+	price, err := d.db.GetPrice()
+	if err != nil {
+		d.log.Errorf("could not get price: %v", err)
+	}
+
+	d.price = price
+
+	memo, err := d.db.GetMemo()
+	if err != nil {
+		d.log.Errorf("could not get memo: %v", err)
+	}
+
+	d.memo = memo
+
+	dispenseDuration, err := d.db.GetDispenseDuration()
+	if err != nil {
+		d.log.Errorf("could not get dispense duration: %v", err)
+	}
+
+	d.dispenseDuration = dispenseDuration
+
+	priceTiers, err := d.db.GetPriceTiers()
+	if err != nil {
+		d.log.Errorf("could not get price tiers: %v", err)
+	}
+
+	d.priceTiers = sortPriceTiers(priceTiers)
+
+	maxDispenseDuration, err := d.db.GetMaxDispenseDuration()
+	if err != nil {
+		d.log.Errorf("could not get max dispense duration: %v", err)
+	}
+
+	d.maxDispenseDuration = maxDispenseDuration
+
+	gramsPerSecond, err := d.db.GetGramsPerSecond()
+	if err != nil {
+		d.log.Errorf("could not get grams per second: %v", err)
+	}
+
+	d.gramsPerSecond = gramsPerSecond
+
+	hopperCapacity, err := d.db.GetHopperCapacity()
+	if err != nil {
+		d.log.Errorf("could not get hopper capacity: %v", err)
+	}
+
+	d.hopperCapacity = hopperCapacity
+
+	lowStockThreshold, err := d.db.GetLowStockThreshold()
+	if err != nil {
+		d.log.Errorf("could not get low stock threshold: %v", err)
+	}
+
+	d.lowStockThreshold = lowStockThreshold
+
+	d.restoreInventory()
+
+	d.restoreCompartments()
+
+	d.restoreMotorLimits()
+
+	d.restoreMotorDrive()
+
+	d.restoreBuzzerPatterns()
+
+	d.restoreSchedules()
+
 	posPrivateKey, err := d.db.GetPosPrivateKey()
 	if err != nil {
 		d.log.Warnf("Could not read PoS private key: %v", err)
@@ -234,34 +456,51 @@ func (d *Dispenser) restoreConfigs() {
 }
 
 // handleDispenses is run as a goroutine and handles dispenses
-func (d *Dispenser) handleDispenses(wg sync.WaitGroup) {
-	wg.Add(1)
-
+func (d *Dispenser) handleDispenses(wg *sync.WaitGroup) {
 	d.log.Infof("started handling dispenses")
 
 	touchesClient := d.machine.SubscribeTouches()
+	gesturesClient := machine.SubscribeGestures(d.machine, machine.DefaultGestureConfig)
 	done := false
 
+	// sampleEnd fires when a running free sample should stop
+	var sampleEnd <-chan time.Time
+
 	for !done {
 		select {
 		case on := <-touchesClient.Touches:
 			// react on direct touch events of the machine
 			d.log.Infof("Touch event %v", on)
 
-			if d.dispenseOnTouch && on {
+			d.sendEvent(events.TouchEvent{On: on})
+
+			if d.ShouldDispenseOnTouchNow() && on {
 				d.ToggleDispense(true)
-			} else {
+			} else if sampleEnd == nil {
 				d.ToggleDispense(false)
 			}
 
-		case <-d.payments:
-			// react on incoming payments
-			dispense := 1500 * time.Millisecond
-
-			d.log.Debugf("Dispensing for a duration of %v", dispense)
+		case gesture := <-gesturesClient.Gestures:
+			d.log.Infof("Gesture event %v", gesture.Type)
+
+			d.sendEvent(events.GestureEvent{Gesture: gesture.Type.String(), Duration: gesture.Duration})
+
+			switch gesture.Type {
+			case machine.GestureDoubleTap:
+				d.playSound(SoundPrice)
+			case machine.GestureLongPress:
+				if d.shouldDispenseSample() && sampleEnd == nil {
+					err := d.toggleDispense(true)
+					if err != nil {
+						d.log.Warnf("Could not dispense free sample: %v", err)
+					} else {
+						sampleEnd = time.After(freeSampleDuration)
+					}
+				}
+			}
 
-			d.ToggleDispense(true)
-			time.Sleep(dispense)
+		case <-sampleEnd:
+			sampleEnd = nil
 			d.ToggleDispense(false)
 
 		case <-d.done:
@@ -270,6 +509,7 @@ func (d *Dispenser) handleDispenses(wg sync.WaitGroup) {
 		}
 	}
 
+	gesturesClient.Cancel()
 	touchesClient.Cancel()
 
 	d.log.Infof("stopped handling dispenses")
@@ -277,19 +517,15 @@ func (d *Dispenser) handleDispenses(wg sync.WaitGroup) {
 	wg.Done()
 }
 
-// notifyDispenseSubscribers is run as a goroutine and notifies all dispense
-// subscribers when the dispense state changes
-func (d *Dispenser) notifyDispenseSubscribers(wg sync.WaitGroup) {
-	wg.Add(1)
-
+// notifyEventsSubscribers is run as a goroutine and notifies all event
+// subscribers when something happens on the dispenser
+func (d *Dispenser) notifyEventsSubscribers(wg *sync.WaitGroup) {
 	done := false
 
 	for !done {
 		select {
-		case on := <-d.dispenses:
-			for _, client := range d.dispenseClients {
-				client.Dispenses <- on
-			}
+		case event := <-d.events:
+			d.notifyEventsClients(event)
 		case <-d.done:
 			// finish loop when program is done
 			done = true
@@ -297,13 +533,20 @@ func (d *Dispenser) notifyDispenseSubscribers(wg sync.WaitGroup) {
 	}
 
 	// cancel all client subscriptions
-	for _, client := range d.dispenseClients {
-		client.Cancel()
-	}
+	d.cancelEventsClients()
 
 	wg.Done()
 }
 
+// sendEvent hands an event to the events subscribers. Once the dispenser
+// is stopped, the event is dropped instead of blocking the sender.
+func (d *Dispenser) sendEvent(event events.Event) {
+	select {
+	case d.events <- event:
+	case <-d.done:
+	}
+}
+
 // handleNetworking is run as a goroutine and handles network changes
 //func (d *Dispenser) handleNetworking(wg sync.WaitGroup) {
 //	wg.Add(1)
@@ -341,8 +584,8 @@ func (d *Dispenser) RunAndWait() error {
 	// track tasks so function can be returned from only when all tasks are stopped
 	var wg sync.WaitGroup
 
-	// initialize a new channel that tracks dispense states
-	d.dispenses = make(chan DispenseState)
+	// initialize a new channel that tracks dispenser events
+	d.events = make(chan events.Event)
 
 	// initialize a new done channel to be closed to stop the dispenser
 	d.done = make(chan struct{})
@@ -350,13 +593,29 @@ func (d *Dispenser) RunAndWait() error {
 	// restore configs from the database
 	d.restoreConfigs()
 
+	// resolve dispenses that were interrupted by a previous shutdown, which
+	// are told about to every subscriber, as there is none yet
+	interruptedEvents := []events.Event{}
+	for _, dispense := range d.recoverDispenseQueue() {
+		interruptedEvents = append(interruptedEvents, dispenseInterruptedEvent(dispense))
+	}
+
+	d.nextClient.Lock()
+	d.interruptedEvents = interruptedEvents
+	d.nextClient.Unlock()
+
 	//go d.handleNetworking(wg)
 
 	// start background routines
-	go d.maybeAttemptSavedWifiConnection(wg)
-	go d.notifyDispenseSubscribers(wg)
-	go d.runLightningNodes(wg)
-	go d.handleDispenses(wg)
+	wg.Add(8)
+	go d.maybeAttemptSavedWifiConnection(&wg)
+	go d.notifyEventsSubscribers(&wg)
+	go d.runLightningNodes(&wg)
+	go d.handleDispenses(&wg)
+	go d.processDispenseQueue(&wg)
+	go d.runSchedules(&wg)
+	go d.runStatusLed(&wg)
+	go d.handleButton(&wg)
 
 	//go func() {
 	//	check, err := onion.Check(d.tor)
@@ -374,16 +633,19 @@ func (d *Dispenser) RunAndWait() error {
 	err = d.pairing.Advertise()
 	if err != nil {
 		d.log.Errorf("unable to advertise: %v", err)
+	} else {
+		d.pairingMode = true
+		d.playSound(SoundPairing)
 	}
 
-	err = d.runPos(wg)
+	err = d.runPos(&wg)
 	if err != nil {
 		err = errors.Errorf("unable to run point of sales: %v", err)
 		d.Stop()
 		goto Teardown
 	}
 
-	err = d.runApi(wg)
+	err = d.runApi(&wg)
 	if err != nil {
 		err = errors.Errorf("unable to run api: %v", err)
 		d.Stop()
@@ -392,8 +654,10 @@ func (d *Dispenser) RunAndWait() error {
 
 	d.state = state.StateStarted
 
-	// signal successful startup with two short buzzer noises
-	d.machine.DiagnosticNoise()
+	// signal successful startup, unless the machine failed its self test
+	if !d.selfTestOnBoot || d.RunSelfTest().Passed {
+		d.playSound(SoundStartup)
+	}
 
 	d.log.Infof("dispenser started")
 
@@ -403,31 +667,56 @@ func (d *Dispenser) RunAndWait() error {
 Teardown:
 	d.state = state.StateStopping
 
-	// tear off dispenses channel
-	close(d.dispenses)
-	d.dispenses = nil
-
 	// wait for all registered tasks to finish
 	wg.Wait()
 
+	// the events channel is left open, as callbacks like motor faults may
+	// still send events, which are dropped through the closed done channel
+
 	d.state = state.StateStopped
 
 	return err
 }
 
 func (d *Dispenser) ToggleDispense(on bool) {
-	// Always make sure that buzzing stops
-	if d.buzzOnDispense || !on {
-		d.machine.ToggleBuzzer(on)
+	err := d.toggleDispense(on)
+	if err != nil {
+		d.log.Warnf("Could not dispense: %v", err)
 	}
+}
 
-	d.machine.ToggleMotor(on)
+// toggleDispense starts or stops dispensing from the default compartment
+func (d *Dispenser) toggleDispense(on bool) error {
+	return d.toggleCompartment(d.defaultCompartment(), on)
+}
 
+// toggleCompartment starts or stops dispensing from a compartment, unless
+// the safety layer refuses to start its motor
+func (d *Dispenser) toggleCompartment(compartment int, on bool) error {
 	if on {
-		d.dispenses <- DispenseStateOn
+		err := d.safety.StartMotor(d.motorCommand(compartment, true))
+		if err != nil {
+			return errors.Errorf("motor refused to start: %v", err)
+		}
 	} else {
-		d.dispenses <- DispenseStateOff
+		d.safety.StopMotor(d.motorCommand(compartment, false))
+	}
+
+	// Always make sure that buzzing stops
+	if d.ShouldBuzzOnDispenseNow() || !on {
+		d.machine.ToggleBuzzer(on)
+	}
+
+	lowStock := d.trackMotor(compartment, on)
+
+	d.sendEvent(events.DispenseEvent{On: on, Compartment: compartment})
+
+	if lowStock {
+		d.sendEvent(d.lowStockEvent(compartment))
+		d.playSound(SoundLowStock)
 	}
+
+	return nil
 }
 
 func (d *Dispenser) GetState() state.State {
@@ -449,10 +738,56 @@ func (d *Dispenser) ShouldDispenseOnTouch() bool {
 	return d.dispenseOnTouch
 }
 
+func (d *Dispenser) IsInDemoMode() bool {
+	return d.demoMode
+}
+
+// shouldDispenseSample tells if a long press should dispense a free sample
+// right now, which is not needed while every touch dispenses anyway
+func (d *Dispenser) shouldDispenseSample() bool {
+	return d.demoMode && !d.maintenance && !d.ShouldDispenseOnTouchNow()
+}
+
 func (d *Dispenser) ShouldBuzzOnDispense() bool {
 	return d.buzzOnDispense
 }
 
+// ShouldDispenseOnTouchNow tells if dispensing on touch is enabled and
+// applies according to the promo hours
+func (d *Dispenser) ShouldDispenseOnTouchNow() bool {
+	return d.dispenseOnTouch && !d.maintenance && d.IsScheduleActive(sweetdb.SchedulePromoHours)
+}
+
+// ShouldBuzzOnDispenseNow tells if buzzing is enabled and not silenced
+// by the quiet hours
+func (d *Dispenser) ShouldBuzzOnDispenseNow() bool {
+	return d.buzzOnDispense && !d.IsScheduleActive(sweetdb.ScheduleQuietHours)
+}
+
+func (d *Dispenser) GetPrice() int64 {
+	if d.price <= 0 {
+		return defaultPrice
+	}
+
+	return d.price
+}
+
+func (d *Dispenser) GetMemo() string {
+	if d.memo == "" {
+		return defaultMemo
+	}
+
+	return d.memo
+}
+
+func (d *Dispenser) GetDispenseDuration() time.Duration {
+	if d.dispenseDuration <= 0 {
+		return defaultDispenseDuration
+	}
+
+	return d.dispenseDuration
+}
+
 func (d *Dispenser) SetName(name string) error {
 	d.log.Infof("Setting name")
 
@@ -463,6 +798,8 @@ func (d *Dispenser) SetName(name string) error {
 		return errors.Errorf("Failed setting name: %v", err)
 	}
 
+	d.sendEvent(events.SettingsEvent{Name: "name", Value: name})
+
 	return nil
 }
 
@@ -476,6 +813,23 @@ func (d *Dispenser) SetDispenseOnTouch(dispenseOnTouch bool) error {
 		return errors.Errorf("Failed setting dispense on touch: %v", err)
 	}
 
+	d.sendEvent(events.SettingsEvent{Name: "dispenseOnTouch", Value: dispenseOnTouch})
+
+	return nil
+}
+
+func (d *Dispenser) SetDemoMode(demoMode bool) error {
+	d.log.Infof("Setting demo mode")
+
+	d.demoMode = demoMode
+
+	err := d.db.SetDemoMode(demoMode)
+	if err != nil {
+		return errors.Errorf("Failed setting demo mode: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "demoMode", Value: demoMode})
+
 	return nil
 }
 
@@ -489,6 +843,61 @@ func (d *Dispenser) SetBuzzOnDispense(buzzOnDispense bool) error {
 		return errors.Errorf("Failed setting buzz on dispense: %v", err)
 	}
 
+	d.sendEvent(events.SettingsEvent{Name: "buzzOnDispense", Value: buzzOnDispense})
+
+	return nil
+}
+
+func (d *Dispenser) SetPrice(price int64) error {
+	d.log.Infof("Setting price")
+
+	if price <= 0 {
+		return errors.Errorf("Price must be positive, got %d", price)
+	}
+
+	d.price = price
+
+	err := d.db.SetPrice(price)
+	if err != nil {
+		return errors.Errorf("Failed setting price: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "price", Value: price})
+
+	return nil
+}
+
+func (d *Dispenser) SetMemo(memo string) error {
+	d.log.Infof("Setting memo")
+
+	d.memo = memo
+
+	err := d.db.SetMemo(memo)
+	if err != nil {
+		return errors.Errorf("Failed setting memo: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "memo", Value: memo})
+
+	return nil
+}
+
+func (d *Dispenser) SetDispenseDuration(duration time.Duration) error {
+	d.log.Infof("Setting dispense duration")
+
+	if duration <= 0 {
+		return errors.Errorf("Dispense duration must be positive, got %v", duration)
+	}
+
+	d.dispenseDuration = duration
+
+	err := d.db.SetDispenseDuration(duration)
+	if err != nil {
+		return errors.Errorf("Failed setting dispense duration: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "dispenseDuration", Value: duration})
+
 	return nil
 }
 
@@ -518,20 +927,3 @@ func (d *Dispenser) Stop() {
 	// signal the dispenser run loop to stop
 	close(d.done)
 }
-
-func (d *Dispenser) SubscribeDispenses() *DispenseClient {
-	client := &DispenseClient{
-		Dispenses:  make(chan DispenseState),
-		cancelChan: make(chan struct{}),
-		dispenser:  d,
-	}
-
-	d.nextClient.Lock()
-	client.Id = d.nextClient.id
-	d.nextClient.id++
-	d.nextClient.Unlock()
-
-	d.dispenseClients[client.Id] = client
-
-	return client
-}
@@ -0,0 +1,332 @@
+package dispenser
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/state"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"time"
+)
+
+const (
+	// holdInvoiceWatchTimeout is how long a hold invoice is watched for an
+	// incoming payment. Later payments are never settled and time out.
+	holdInvoiceWatchTimeout = 1 * time.Hour
+
+	// holdInvoiceResumeTimeout is how long a hold invoice that was left open
+	// by a previous run is at least watched, to learn about its state
+	holdInvoiceResumeTimeout = 1 * time.Minute
+
+	// holdDispenseMaxWait is how long a dispense for a held payment waits
+	// for the motor, well before the held payment expires and the channel
+	// it is held in has to be closed
+	holdDispenseMaxWait = 10 * time.Minute
+)
+
+// addHoldInvoice creates a hold invoice with a fresh preimage, records it
+// for the given compartment and watches it for an incoming payment
+func (d *Dispenser) addHoldInvoice(nodeID string, node lightning.HoldInvoiceNode, request *lightning.InvoiceRequest, compartment int) (*lightning.Invoice, error) {
+	preimage := make([]byte, 32)
+
+	_, err := rand.Read(preimage)
+	if err != nil {
+		return nil, errors.Errorf("unable to generate preimage: %v", err)
+	}
+
+	hash := sha256.Sum256(preimage)
+
+	invoice, err := node.AddHoldInvoice(hash[:], request)
+	if err != nil {
+		return nil, errors.Errorf("unable to add hold invoice: %v", err)
+	}
+
+	err = d.db.SaveInvoice(&sweetdb.Invoice{
+		RHash:       invoice.RHash,
+		NodeId:      nodeID,
+		MSat:        invoice.MSat,
+		Memo:        invoice.Memo,
+		Created:     time.Now(),
+		Hold:        true,
+		Preimage:    hex.EncodeToString(preimage),
+		Compartment: compartment,
+	})
+	if err != nil {
+		d.cancelHoldInvoice(node, invoice.RHash)
+		return nil, errors.Errorf("unable to save invoice: %v", err)
+	}
+
+	err = d.startWatchingHoldInvoice(node, invoice.RHash, time.Now().Add(holdInvoiceWatchTimeout))
+	if err != nil {
+		d.cancelHoldInvoice(node, invoice.RHash)
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// startWatchingHoldInvoice watches a hold invoice for a payment until the
+// deadline, unless it is watched already
+func (d *Dispenser) startWatchingHoldInvoice(node lightning.HoldInvoiceNode, rHash string, deadline time.Time) error {
+	d.holdWatchesMutex.Lock()
+	defer d.holdWatchesMutex.Unlock()
+
+	if d.holdWatches[rHash] {
+		return nil
+	}
+
+	client, err := node.SubscribeSingleInvoice(rHash)
+	if err != nil {
+		return errors.Errorf("unable to subscribe to invoice: %v", err)
+	}
+
+	d.holdWatches[rHash] = true
+
+	go d.watchHoldInvoice(node, client, rHash, deadline)
+
+	return nil
+}
+
+// watchHoldInvoice is run as a goroutine and waits for a payment to be
+// held for the given invoice. Payments held after the deadline are
+// cancelled, as the customer is likely gone by then.
+func (d *Dispenser) watchHoldInvoice(node lightning.HoldInvoiceNode, client *lightning.SingleInvoiceClient, rHash string, deadline time.Time) {
+	defer func() {
+		d.holdWatchesMutex.Lock()
+		delete(d.holdWatches, rHash)
+		d.holdWatchesMutex.Unlock()
+	}()
+
+	defer client.Cancel()
+
+	wait := time.Until(deadline)
+	if wait < holdInvoiceResumeTimeout {
+		wait = holdInvoiceResumeTimeout
+	}
+
+	timeout := time.After(wait)
+
+	for {
+		select {
+		case invoice, ok := <-client.Invoices:
+			if !ok {
+				d.log.Warnf("stopped watching hold invoice %s", rHash)
+				return
+			}
+
+			switch invoice.State {
+			case lightning.InvoiceStateAccepted:
+				if time.Now().After(deadline) {
+					d.log.Warnf("Cancelling hold invoice %s paid after %v", rHash, holdInvoiceWatchTimeout)
+					d.cancelHoldInvoice(node, rHash)
+					return
+				}
+
+				d.acceptHoldInvoice(node, invoice)
+				return
+			case lightning.InvoiceStateSettled, lightning.InvoiceStateCanceled:
+				d.markHoldInvoiceResolved(rHash)
+				return
+			}
+		case <-timeout:
+			d.log.Debugf("stopped watching unpaid hold invoice %s", rHash)
+			d.markHoldInvoiceResolved(rHash)
+			return
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// resumeHoldInvoices resolves the hold invoices of a started node that a
+// previous run left open. Held payments are settled for finished dispenses
+// and cancelled for interrupted or canceled ones, while invoices without a
+// dispense are watched again.
+func (d *Dispenser) resumeHoldInvoices(nodeID string, node lightning.HoldInvoiceNode) {
+	invoices, err := d.db.GetOpenHoldInvoices()
+	if err != nil {
+		d.log.Errorf("could not get open hold invoices: %v", err)
+		return
+	}
+
+	for _, invoice := range invoices {
+		if invoice.NodeId != nodeID {
+			continue
+		}
+
+		dispense, err := d.db.GetDispense(invoice.RHash)
+		if err != nil {
+			d.log.Errorf("could not get dispense for hold invoice %s: %v", invoice.RHash, err)
+			continue
+		}
+
+		switch {
+		case dispense == nil:
+			err := d.startWatchingHoldInvoice(node, invoice.RHash, invoice.Created.Add(holdInvoiceWatchTimeout))
+			if err != nil {
+				d.log.Errorf("could not resume hold invoice %s: %v", invoice.RHash, err)
+			}
+		case dispense.State == sweetdb.DispenseStateDone:
+			d.settleHoldInvoice(node, invoice)
+		case dispense.State == sweetdb.DispenseStateInterrupted,
+			dispense.State == sweetdb.DispenseStateCanceled:
+			d.cancelHoldInvoice(node, invoice.RHash)
+		}
+	}
+}
+
+// acceptHoldInvoice enqueues a dispense for a held payment, or cancels the
+// payment if nothing can be dispensed for it
+func (d *Dispenser) acceptHoldInvoice(node lightning.HoldInvoiceNode, invoice *lightning.Invoice) {
+	d.log.Infof("payment for hold invoice %s is held", invoice.RHash)
+
+	recorded, err := d.db.GetInvoice(invoice.RHash)
+	if err != nil || recorded == nil {
+		d.log.Errorf("could not get hold invoice %s: %v", invoice.RHash, err)
+		d.cancelHoldInvoice(node, invoice.RHash)
+		return
+	}
+
+	// the held amount is not reported by all node versions
+	if invoice.AmtPaidMSat == 0 {
+		invoice.AmtPaidMSat = recorded.MSat
+	}
+
+	err = d.checkDispensable(recorded.Compartment)
+	if err != nil {
+		d.log.Warnf("Cancelling hold invoice %s: %v", invoice.RHash, err)
+		d.cancelHoldInvoice(node, invoice.RHash)
+
+		d.saveSale(&sweetdb.Sale{
+			RHash:       invoice.RHash,
+			AmtPaidMSat: invoice.AmtPaidMSat,
+			NodeId:      recorded.NodeId,
+			Settled:     time.Now(),
+			Outcome:     sweetdb.SaleOutcomeCanceled,
+			Compartment: recorded.Compartment,
+			Product:     d.GetCompartment(recorded.Compartment).Product,
+		})
+
+		return
+	}
+
+	if !d.enqueueRecordedDispense(invoice, recorded) {
+		d.cancelHoldInvoice(node, invoice.RHash)
+	}
+}
+
+// checkDispensable tells why the dispenser is currently unable to dispense
+// from a compartment
+func (d *Dispenser) checkDispensable(compartment int) error {
+	if d.state != state.StateStarted {
+		return errors.Errorf("dispenser is %s", state.String(d.state))
+	}
+
+	if d.maintenance {
+		return errors.Errorf("dispenser is under maintenance")
+	}
+
+	if fault := d.GetMotorFault(); fault != nil {
+		return errors.Errorf("motor is faulted due to exceeded %s limit", fault.Reason)
+	}
+
+	if d.IsCompartmentEmpty(compartment) {
+		return errors.Errorf("hopper of compartment %d is empty", compartment)
+	}
+
+	return nil
+}
+
+// resolveHoldInvoice settles the held payment of a dispensed invoice,
+// or cancels it if dispensing failed
+func (d *Dispenser) resolveHoldInvoice(rHash string, dispensed bool) {
+	recorded, err := d.db.GetInvoice(rHash)
+	if err != nil || recorded == nil {
+		d.log.Errorf("could not get hold invoice %s: %v", rHash, err)
+		return
+	}
+
+	node, ok := d.nodeman.GetNode(recorded.NodeId).(lightning.HoldInvoiceNode)
+	if !ok {
+		d.log.Errorf("node %s of hold invoice %s is unavailable", recorded.NodeId, rHash)
+		return
+	}
+
+	if !dispensed {
+		d.cancelHoldInvoice(node, rHash)
+		return
+	}
+
+	d.settleHoldInvoice(node, recorded)
+}
+
+// settleHoldInvoice takes a held payment
+func (d *Dispenser) settleHoldInvoice(node lightning.HoldInvoiceNode, recorded *sweetdb.Invoice) {
+	preimage, err := hex.DecodeString(recorded.Preimage)
+	if err != nil {
+		d.log.Errorf("invalid preimage of hold invoice %s: %v", recorded.RHash, err)
+		return
+	}
+
+	err = node.SettleInvoice(preimage)
+	if err != nil {
+		d.log.Errorf("could not settle hold invoice %s: %v", recorded.RHash, err)
+		return
+	}
+
+	d.log.Infof("settled hold invoice %s", recorded.RHash)
+
+	d.markHoldInvoiceResolved(recorded.RHash)
+}
+
+// cancelHoldInvoice returns a held payment to the customer
+func (d *Dispenser) cancelHoldInvoice(node lightning.HoldInvoiceNode, rHash string) {
+	err := node.CancelInvoice(rHash)
+	if err != nil {
+		d.log.Errorf("could not cancel hold invoice %s: %v", rHash, err)
+		return
+	}
+
+	d.log.Infof("cancelled hold invoice %s", rHash)
+
+	d.markHoldInvoiceResolved(rHash)
+}
+
+// markHoldInvoiceResolved records that a hold invoice needs no more
+// attention
+func (d *Dispenser) markHoldInvoiceResolved(rHash string) {
+	recorded, err := d.db.GetInvoice(rHash)
+	if err != nil || recorded == nil {
+		d.log.Errorf("could not get hold invoice %s: %v", rHash, err)
+		return
+	}
+
+	recorded.Resolved = true
+
+	err = d.db.SaveInvoice(recorded)
+	if err != nil {
+		d.log.Errorf("could not save hold invoice %s: %v", rHash, err)
+	}
+}
+
+func (d *Dispenser) ShouldHoldInvoices() bool {
+	return d.holdInvoices
+}
+
+func (d *Dispenser) SetHoldInvoices(holdInvoices bool) error {
+	d.log.Infof("Setting hold invoices")
+
+	d.holdInvoices = holdInvoices
+
+	err := d.db.SetHoldInvoices(holdInvoices)
+	if err != nil {
+		return errors.Errorf("Failed setting hold invoices: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "holdInvoices", Value: holdInvoices})
+
+	return nil
+}
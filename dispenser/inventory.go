@@ -0,0 +1,379 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"time"
+)
+
+// defaultLowStockRatio is the share of the hopper capacity below which stock
+// is considered low as long as no threshold has been configured
+const defaultLowStockRatio = 0.1
+
+// compartmentInventory tracks the stock of a single compartment
+type compartmentInventory struct {
+	// inventory holds the motor runtime since the last refill
+	inventory *sweetdb.Inventory
+
+	// motorStarted is when the motor was started, or zero if it is off
+	motorStarted time.Time
+
+	// lowStock indicates if a low stock event was emitted since the last refill
+	lowStock bool
+}
+
+// restoreInventory loads the motor runtime of every compartment since its
+// last refill
+func (d *Dispenser) restoreInventory() {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	d.inventories = make(map[int]*compartmentInventory)
+
+	for _, compartment := range d.machine.Compartments() {
+		inventory, err := d.db.GetInventory(compartment)
+		if err != nil {
+			d.log.Errorf("could not get inventory of compartment %d: %v", compartment, err)
+			inventory = &sweetdb.Inventory{}
+		}
+
+		inv := &compartmentInventory{inventory: inventory}
+		inv.lowStock = d.isLowStock(inv)
+
+		d.inventories[compartment] = inv
+	}
+}
+
+// inventoryOf returns the inventory of a compartment, expecting the
+// inventory to be locked
+func (d *Dispenser) inventoryOf(compartment int) *compartmentInventory {
+	inv, ok := d.inventories[compartment]
+	if !ok {
+		inv = &compartmentInventory{inventory: &sweetdb.Inventory{}}
+		d.inventories[compartment] = inv
+	}
+
+	return inv
+}
+
+// trackMotor accumulates the time the motor of a compartment is running.
+// It returns true when the remaining quantity just fell below the low
+// stock threshold.
+func (d *Dispenser) trackMotor(compartment int, on bool) bool {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	inv := d.inventoryOf(compartment)
+
+	if on {
+		if inv.motorStarted.IsZero() {
+			inv.motorStarted = time.Now()
+		}
+
+		return false
+	}
+
+	if inv.motorStarted.IsZero() {
+		return false
+	}
+
+	inv.inventory.MotorRuntime += time.Since(inv.motorStarted)
+	inv.motorStarted = time.Time{}
+
+	err := d.db.SetInventory(compartment, inv.inventory)
+	if err != nil {
+		d.log.Errorf("could not save inventory of compartment %d: %v", compartment, err)
+	}
+
+	if inv.lowStock || !d.isLowStock(inv) {
+		return false
+	}
+
+	inv.lowStock = true
+
+	d.log.Warnf("Stock of compartment %d is low with an estimated %.0fg remaining",
+		compartment, d.remaining(inv))
+
+	return true
+}
+
+// lowStockEvent describes the stock of a compartment that just ran low
+func (d *Dispenser) lowStockEvent(compartment int) events.LowStockEvent {
+	return events.LowStockEvent{
+		Compartment: compartment,
+		Remaining:   d.GetCompartmentRemaining(compartment),
+		FillLevel:   d.GetCompartmentFillLevel(compartment),
+	}
+}
+
+// isInventoryTracked tells if the calibration allows estimating the stock
+func (d *Dispenser) isInventoryTracked() bool {
+	return d.gramsPerSecond > 0 && d.hopperCapacity > 0
+}
+
+// remaining estimates the remaining grams, expecting the inventory to be locked
+func (d *Dispenser) remaining(inv *compartmentInventory) float64 {
+	remaining := d.hopperCapacity - inv.inventory.MotorRuntime.Seconds()*d.gramsPerSecond
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// isLowStock expects the inventory to be locked
+func (d *Dispenser) isLowStock(inv *compartmentInventory) bool {
+	return d.isInventoryTracked() && d.remaining(inv) < d.GetLowStockThreshold()
+}
+
+func (d *Dispenser) GetGramsPerSecond() float64 {
+	return d.gramsPerSecond
+}
+
+// GetHopperCapacity returns the capacity of the hopper of a single compartment
+func (d *Dispenser) GetHopperCapacity() float64 {
+	return d.hopperCapacity
+}
+
+func (d *Dispenser) GetLowStockThreshold() float64 {
+	if d.lowStockThreshold <= 0 {
+		return d.hopperCapacity * defaultLowStockRatio
+	}
+
+	return d.lowStockThreshold
+}
+
+// GetCompartmentMotorRuntime returns the time the motor of a compartment
+// ran since its last refill
+func (d *Dispenser) GetCompartmentMotorRuntime(compartment int) time.Duration {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	return d.inventoryOf(compartment).inventory.MotorRuntime
+}
+
+// GetCompartmentRefilled returns when the hopper of a compartment was last
+// refilled
+func (d *Dispenser) GetCompartmentRefilled(compartment int) time.Time {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	return d.inventoryOf(compartment).inventory.Refilled
+}
+
+// GetCompartmentRemaining estimates the remaining grams in the hopper of a
+// compartment. It returns the hopper capacity as long as the inventory is
+// not calibrated.
+func (d *Dispenser) GetCompartmentRemaining(compartment int) float64 {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	if !d.isInventoryTracked() {
+		return d.hopperCapacity
+	}
+
+	return d.remaining(d.inventoryOf(compartment))
+}
+
+// GetCompartmentFillLevel estimates the filled share of the hopper of a
+// compartment between 0 and 1
+func (d *Dispenser) GetCompartmentFillLevel(compartment int) float64 {
+	if !d.isInventoryTracked() {
+		return 1
+	}
+
+	return d.GetCompartmentRemaining(compartment) / d.hopperCapacity
+}
+
+func (d *Dispenser) IsCompartmentLowStock(compartment int) bool {
+	d.inventoryMutex.Lock()
+	defer d.inventoryMutex.Unlock()
+
+	return d.isLowStock(d.inventoryOf(compartment))
+}
+
+// IsCompartmentEmpty tells if the hopper of a compartment is estimated to
+// be empty
+func (d *Dispenser) IsCompartmentEmpty(compartment int) bool {
+	return d.isInventoryTracked() && d.GetCompartmentRemaining(compartment) <= 0
+}
+
+// GetMotorRuntime returns the time all motors ran since their last refill
+func (d *Dispenser) GetMotorRuntime() time.Duration {
+	var runtime time.Duration
+
+	for _, compartment := range d.machine.Compartments() {
+		runtime += d.GetCompartmentMotorRuntime(compartment)
+	}
+
+	return runtime
+}
+
+// GetRefilled returns when the hopper that was refilled the longest time
+// ago was last refilled
+func (d *Dispenser) GetRefilled() time.Time {
+	var refilled time.Time
+
+	for i, compartment := range d.machine.Compartments() {
+		r := d.GetCompartmentRefilled(compartment)
+		if i == 0 || r.Before(refilled) {
+			refilled = r
+		}
+	}
+
+	return refilled
+}
+
+// GetRemaining estimates the remaining grams in all hoppers
+func (d *Dispenser) GetRemaining() float64 {
+	var remaining float64
+
+	for _, compartment := range d.machine.Compartments() {
+		remaining += d.GetCompartmentRemaining(compartment)
+	}
+
+	return remaining
+}
+
+// GetFillLevel estimates the filled share of all hoppers between 0 and 1
+func (d *Dispenser) GetFillLevel() float64 {
+	compartments := d.machine.Compartments()
+
+	if !d.isInventoryTracked() || len(compartments) == 0 {
+		return 1
+	}
+
+	return d.GetRemaining() / (d.hopperCapacity * float64(len(compartments)))
+}
+
+// IsInventoryTracked tells if grams per second and the hopper capacity
+// are calibrated
+func (d *Dispenser) IsInventoryTracked() bool {
+	return d.isInventoryTracked()
+}
+
+// IsLowStock tells if any compartment is low on stock
+func (d *Dispenser) IsLowStock() bool {
+	for _, compartment := range d.machine.Compartments() {
+		if d.IsCompartmentLowStock(compartment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsEmpty tells if the hoppers of all compartments are estimated to be empty
+func (d *Dispenser) IsEmpty() bool {
+	for _, compartment := range d.machine.Compartments() {
+		if !d.IsCompartmentEmpty(compartment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Refilled resets the motor runtime of all compartments after their
+// hoppers were refilled
+func (d *Dispenser) Refilled() error {
+	for _, compartment := range d.machine.Compartments() {
+		err := d.RefilledCompartment(compartment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefilledCompartment resets the motor runtime of a compartment after its
+// hopper was refilled
+func (d *Dispenser) RefilledCompartment(compartment int) error {
+	d.log.Infof("Refilled hopper of compartment %d", compartment)
+
+	d.inventoryMutex.Lock()
+
+	inventory := &sweetdb.Inventory{
+		MotorRuntime: 0,
+		Refilled:     time.Now(),
+	}
+
+	err := d.db.SetInventory(compartment, inventory)
+	if err != nil {
+		d.inventoryMutex.Unlock()
+		return errors.Errorf("Failed saving inventory of compartment %d: %v", compartment, err)
+	}
+
+	inv := d.inventoryOf(compartment)
+	inv.inventory = inventory
+	inv.lowStock = false
+
+	if !inv.motorStarted.IsZero() {
+		inv.motorStarted = time.Now()
+	}
+
+	d.inventoryMutex.Unlock()
+
+	d.sendEvent(events.RefilledEvent{Compartment: compartment, Capacity: d.hopperCapacity})
+
+	return nil
+}
+
+func (d *Dispenser) SetGramsPerSecond(gramsPerSecond float64) error {
+	d.log.Infof("Setting grams per second")
+
+	if gramsPerSecond < 0 {
+		return errors.Errorf("Grams per second must not be negative, got %v", gramsPerSecond)
+	}
+
+	d.gramsPerSecond = gramsPerSecond
+
+	err := d.db.SetGramsPerSecond(gramsPerSecond)
+	if err != nil {
+		return errors.Errorf("Failed setting grams per second: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "gramsPerSecond", Value: gramsPerSecond})
+
+	return nil
+}
+
+func (d *Dispenser) SetHopperCapacity(grams float64) error {
+	d.log.Infof("Setting hopper capacity")
+
+	if grams < 0 {
+		return errors.Errorf("Hopper capacity must not be negative, got %v", grams)
+	}
+
+	d.hopperCapacity = grams
+
+	err := d.db.SetHopperCapacity(grams)
+	if err != nil {
+		return errors.Errorf("Failed setting hopper capacity: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "hopperCapacity", Value: grams})
+
+	return nil
+}
+
+func (d *Dispenser) SetLowStockThreshold(grams float64) error {
+	d.log.Infof("Setting low stock threshold")
+
+	if grams < 0 {
+		return errors.Errorf("Low stock threshold must not be negative, got %v", grams)
+	}
+
+	d.lowStockThreshold = grams
+
+	err := d.db.SetLowStockThreshold(grams)
+	if err != nil {
+		return errors.Errorf("Failed setting low stock threshold: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "lowStockThreshold", Value: grams})
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package dispenser
+
+import (
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/state"
+	"sync"
+	"time"
+)
+
+const (
+	// statusLedInterval is how often the status led is updated
+	statusLedInterval = 1 * time.Second
+)
+
+// hasAvailableNode checks if any lightning node is enabled
+func (d *Dispenser) hasAvailableNode() bool {
+	for _, node := range d.nodeman.GetNodes() {
+		if node.Enabled() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ledStatus determines what the status led shows, where the most
+// important condition wins
+func (d *Dispenser) ledStatus() machine.LedStatus {
+	switch {
+	case d.GetMotorFault() != nil:
+		return machine.LedStatus{Color: machine.ColorRed, Blink: machine.BlinkFast}
+	case d.state != state.StateStarted:
+		return machine.LedStatus{Color: machine.ColorYellow, Blink: machine.BlinkSlow}
+	case d.maintenance:
+		return machine.LedStatus{Color: machine.ColorYellow, Blink: machine.BlinkFast}
+	case d.pairingMode && len(d.nodeman.GetNodes()) == 0:
+		return machine.LedStatus{Color: machine.ColorBlue, Blink: machine.BlinkFast}
+	case !d.networkConnected:
+		return machine.LedStatus{Color: machine.ColorBlue, Blink: machine.BlinkSlow}
+	case !d.hasAvailableNode():
+		return machine.LedStatus{Color: machine.ColorYellow, Blink: machine.BlinkNone}
+	case d.IsEmpty() || !d.IsOpen():
+		return machine.LedStatus{Color: machine.ColorRed, Blink: machine.BlinkNone}
+	default:
+		return machine.LedStatus{Color: machine.ColorGreen, Blink: machine.BlinkNone}
+	}
+}
+
+// runStatusLed is run as a goroutine and keeps the status led up to date
+func (d *Dispenser) runStatusLed(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(statusLedInterval)
+	defer ticker.Stop()
+
+	var shown *machine.LedStatus
+
+	for {
+		status := d.ledStatus()
+
+		if shown == nil || *shown != status {
+			d.machine.SetLed(status)
+			shown = &status
+		}
+
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+	}
+}
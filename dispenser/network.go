@@ -9,9 +9,7 @@ import (
 
 // maybeAttemptSavedWifiConnection is run as a goroutine and attempts a connection
 // to the most recently persisted wifi connection, if no network connection is available yet
-func (d *Dispenser) maybeAttemptSavedWifiConnection(wg sync.WaitGroup) {
-	wg.Add(1)
-
+func (d *Dispenser) maybeAttemptSavedWifiConnection(wg *sync.WaitGroup) {
 	wifiConnection, err := d.db.GetWifi()
 	if err != nil {
 		d.log.Warnf("could not get wifi connection: %v", err)
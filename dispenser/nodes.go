@@ -8,9 +8,7 @@ import (
 )
 
 // runLightningNodes
-func (d *Dispenser) runLightningNodes(wg sync.WaitGroup) {
-	wg.Add(1)
-
+func (d *Dispenser) runLightningNodes(wg *sync.WaitGroup) {
 	d.nodeman.Load()
 
 	d.log.Infof("restored %d lightning nodes from database", len(d.nodeman.GetNodes()))
@@ -18,10 +16,15 @@ func (d *Dispenser) runLightningNodes(wg sync.WaitGroup) {
 	// subscribe to network updates
 	networkClient := d.network.Subscribe()
 
-	if d.network.Status().Connected() {
+	d.networkConnected = d.network.Status().Connected()
+
+	if d.networkConnected {
 		d.startLightningNodes()
 	}
 
+	// keep track of which nodes are able to receive payments
+	go d.nodeman.PollStatuses(d.done)
+
 	done := false
 
 	d.log.Infof("start running lightning nodes")
@@ -31,6 +34,8 @@ func (d *Dispenser) runLightningNodes(wg sync.WaitGroup) {
 		case update := <-networkClient.Updates:
 			d.log.Infof("Network changed to %v", update)
 
+			d.networkConnected = update.Connected
+
 			if update.Connected {
 				d.startLightningNodes()
 			}
@@ -68,10 +73,20 @@ func (d *Dispenser) startLightningNodes() {
 			}
 
 			go d.handleLightningNodeInvoices(client)
+
+			d.resumeNodeHoldInvoices(node)
 		}
 	}
 }
 
+// resumeNodeHoldInvoices picks up the hold invoices a previous run left
+// open on a node that supports them
+func (d *Dispenser) resumeNodeHoldInvoices(node nodeman.LightningNode) {
+	if holdNode, ok := node.(lightning.HoldInvoiceNode); ok {
+		go d.resumeHoldInvoices(node.ID(), holdNode)
+	}
+}
+
 func (d *Dispenser) handleLightningNodeInvoices(client *lightning.InvoicesClient) {
 	d.log.Infof("start handling lightning invoices")
 
@@ -83,8 +98,11 @@ func (d *Dispenser) handleLightningNodeInvoices(client *lightning.InvoicesClient
 		}
 
 		if invoice.Settled {
-			d.payments <- invoice
+			d.enqueueDispense(invoice)
 		}
+
+		// the invoice is only seen once its dispense was persisted
+		client.Ack()
 	}
 }
 
@@ -96,6 +114,11 @@ func (d *Dispenser) GetNode(id string) nodeman.LightningNode {
 	return d.nodeman.GetNode(id)
 }
 
+// GetNodeStatus returns the last known status of a node
+func (d *Dispenser) GetNodeStatus(id string) lightning.NodeStatus {
+	return d.nodeman.GetStatus(id)
+}
+
 func (d *Dispenser) AddNode(config nodeman.NodeConfig) (nodeman.LightningNode, error) {
 	return d.nodeman.AddNode(config)
 }
@@ -123,7 +146,16 @@ func (d *Dispenser) EnableNode(id string) error {
 
 	go d.handleLightningNodeInvoices(client)
 
-	return d.nodeman.EnableNode(id)
+	err = d.nodeman.EnableNode(id)
+	if err != nil {
+		return err
+	}
+
+	go d.nodeman.RefreshStatus(node)
+
+	d.resumeNodeHoldInvoices(node)
+
+	return nil
 }
 
 func (d *Dispenser) DisableNode(id string) error {
@@ -1,14 +1,21 @@
 package dispenser
 
 import (
+	"context"
 	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/nodeman"
+	"github.com/the-lightning-land/sweetd/sweetdb"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // runPos
-func (d *Dispenser) runPos(wg sync.WaitGroup) error {
+func (d *Dispenser) runPos(wg *sync.WaitGroup) error {
 	listener, err := net.Listen("tcp", "127.0.0.1:9001")
 	if err != nil {
 		return errors.Errorf("unable to listen: %v", err)
@@ -17,14 +24,14 @@ func (d *Dispenser) runPos(wg sync.WaitGroup) error {
 	// point the onion service to the listener
 	d.posOnionService.SetListener(listener)
 
-	go func() {
-		wg.Add(1)
+	server := &http.Server{Handler: d.posHandler}
 
-		go func() {
-			wg.Add(1)
+	wg.Add(2)
 
-			err := http.Serve(listener, d.posHandler)
-			if err != nil {
+	go func() {
+		go func() {
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
 				d.log.Errorf("unable to serve: %v", err)
 			}
 
@@ -57,6 +64,14 @@ func (d *Dispenser) runPos(wg sync.WaitGroup) error {
 			}
 		}
 
+		// closes the listener and lets running requests finish
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		err = server.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			d.log.Errorf("could not shut down point of sales server: %v", err)
+		}
+
 		networkClient.Cancel()
 
 		d.posOnionService.Stop()
@@ -72,3 +87,59 @@ func (d *Dispenser) runPos(wg sync.WaitGroup) error {
 func (d *Dispenser) GetPosOnionID() string {
 	return d.posOnionService.ID()
 }
+
+// GetInvoiceMemo renders the configured memo template for an invoice
+// over the given amount of satoshis
+func (d *Dispenser) GetInvoiceMemo(price int64) string {
+	replacer := strings.NewReplacer(
+		"{price}", strconv.FormatInt(price, 10),
+		"{name}", d.GetName(),
+	)
+
+	return replacer.Replace(d.GetMemo())
+}
+
+// RecordInvoice remembers an invoice created by the point of sales, so only
+// payments to invoices of this dispenser lead to dispenses from the given
+// compartment
+func (d *Dispenser) RecordInvoice(nodeID string, invoice *lightning.Invoice, compartment int) error {
+	err := d.db.SaveInvoice(&sweetdb.Invoice{
+		RHash:       invoice.RHash,
+		NodeId:      nodeID,
+		MSat:        invoice.MSat,
+		Memo:        invoice.Memo,
+		Created:     time.Now(),
+		Compartment: compartment,
+	})
+	if err != nil {
+		return errors.Errorf("unable to save invoice: %v", err)
+	}
+
+	return nil
+}
+
+// AddInvoice creates and records an invoice on the given node, which is
+// dispensed for from the given compartment. While holding invoices is
+// enabled and supported by the node, a hold invoice is created, which is
+// only settled after dispensing succeeded.
+func (d *Dispenser) AddInvoice(node nodeman.LightningNode, request *lightning.InvoiceRequest, compartment int) (*lightning.Invoice, error) {
+	if d.holdInvoices {
+		if holdNode, ok := node.(lightning.HoldInvoiceNode); ok {
+			return d.addHoldInvoice(node.ID(), holdNode, request, compartment)
+		}
+
+		d.log.Warnf("node %s does not support hold invoices", node.ID())
+	}
+
+	invoice, err := node.AddInvoice(request)
+	if err != nil {
+		return nil, errors.Errorf("unable to add invoice: %v", err)
+	}
+
+	err = d.RecordInvoice(node.ID(), invoice, compartment)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
@@ -0,0 +1,146 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"sort"
+	"time"
+)
+
+// sortPriceTiers orders price tiers by ascending price
+func sortPriceTiers(tiers []sweetdb.PriceTier) []sweetdb.PriceTier {
+	sorted := make([]sweetdb.PriceTier, len(tiers))
+	copy(sorted, tiers)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Price < sorted[j].Price
+	})
+
+	return sorted
+}
+
+// GetPriceTiers returns the configured price tiers ordered by ascending price.
+// Without any configured tiers, the price and dispense duration make up the
+// only tier.
+func (d *Dispenser) GetPriceTiers() []sweetdb.PriceTier {
+	if len(d.priceTiers) == 0 {
+		return []sweetdb.PriceTier{
+			{Price: d.GetPrice(), Duration: d.GetDispenseDuration()},
+		}
+	}
+
+	return d.priceTiers
+}
+
+func (d *Dispenser) GetMaxDispenseDuration() time.Duration {
+	if d.maxDispenseDuration <= 0 {
+		return defaultMaxDispenseDuration
+	}
+
+	return d.maxDispenseDuration
+}
+
+// GetDispenseDurationFor maps a paid amount of satoshis to the time the motor
+// should run. The highest tier that is covered by the amount determines the
+// rate at which the amount is converted, and the result is capped by the max
+// dispense duration. Amounts below the lowest tier result in a zero duration.
+func (d *Dispenser) GetDispenseDurationFor(sat int64) time.Duration {
+	var tier *sweetdb.PriceTier
+
+	for _, t := range d.GetPriceTiers() {
+		if t.Price > 0 && t.Price <= sat {
+			t := t
+			tier = &t
+		}
+	}
+
+	if tier == nil {
+		return 0
+	}
+
+	duration := float64(tier.Duration) * float64(sat) / float64(tier.Price)
+
+	if max := d.GetMaxDispenseDuration(); duration > float64(max) {
+		return max
+	}
+
+	return time.Duration(duration)
+}
+
+// GetCompartmentPrice returns the price of a single dispense from a
+// compartment, which defaults to the price of the dispenser
+func (d *Dispenser) GetCompartmentPrice(compartment int) int64 {
+	if price := d.GetCompartment(compartment).Price; price > 0 {
+		return price
+	}
+
+	return d.GetPrice()
+}
+
+// GetDispenseDurationForCompartment maps a paid amount of satoshis to the
+// time the motor of a compartment should run. Compartments with a price of
+// their own convert the amount at the rate of their price to the dispense
+// duration, while all others use the price tiers.
+func (d *Dispenser) GetDispenseDurationForCompartment(compartment int, sat int64) time.Duration {
+	price := d.GetCompartment(compartment).Price
+	if price <= 0 {
+		return d.GetDispenseDurationFor(sat)
+	}
+
+	if sat < price {
+		return 0
+	}
+
+	duration := float64(d.GetDispenseDuration()) * float64(sat) / float64(price)
+
+	if max := d.GetMaxDispenseDuration(); duration > float64(max) {
+		return max
+	}
+
+	return time.Duration(duration)
+}
+
+func (d *Dispenser) SetPriceTiers(tiers []sweetdb.PriceTier) error {
+	d.log.Infof("Setting price tiers")
+
+	for _, tier := range tiers {
+		if tier.Price <= 0 {
+			return errors.Errorf("Tier price must be positive, got %d", tier.Price)
+		}
+
+		if tier.Duration <= 0 {
+			return errors.Errorf("Tier duration must be positive, got %v", tier.Duration)
+		}
+	}
+
+	d.priceTiers = sortPriceTiers(tiers)
+
+	err := d.db.SetPriceTiers(d.priceTiers)
+	if err != nil {
+		return errors.Errorf("Failed setting price tiers: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "priceTiers", Value: d.priceTiers})
+
+	return nil
+}
+
+func (d *Dispenser) SetMaxDispenseDuration(duration time.Duration) error {
+	d.log.Infof("Setting max dispense duration")
+
+	if duration <= 0 {
+		return errors.Errorf("Max dispense duration must be positive, got %v", duration)
+	}
+
+	d.maxDispenseDuration = duration
+
+	err := d.db.SetMaxDispenseDuration(duration)
+	if err != nil {
+		return errors.Errorf("Failed setting max dispense duration: %v", err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: "maxDispenseDuration", Value: duration})
+
+	return nil
+}
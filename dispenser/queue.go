@@ -0,0 +1,380 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"sync"
+	"time"
+)
+
+const (
+	// minDispenseRetryBackoff is the first wait before pending dispenses are
+	// attempted again after the motor refused to start
+	minDispenseRetryBackoff = 5 * time.Second
+
+	// maxDispenseRetryBackoff is the longest wait between attempts
+	maxDispenseRetryBackoff = 5 * time.Minute
+)
+
+// enqueueDispense persists a dispense for a settled invoice and signals the
+// dispense queue. Invoices that were not created by the dispenser or that
+// were enqueued before are ignored, so every payment is dispensed at most once.
+func (d *Dispenser) enqueueDispense(invoice *lightning.Invoice) {
+	recorded, err := d.db.GetInvoice(invoice.RHash)
+	if err != nil {
+		d.log.Errorf("could not get invoice %s: %v", invoice.RHash, err)
+		return
+	}
+
+	if recorded == nil {
+		d.log.Debugf("ignoring settled invoice %s that was not created by the dispenser", invoice.RHash)
+		return
+	}
+
+	// hold invoices are dispensed for before they are settled
+	if recorded.Hold {
+		d.log.Debugf("ignoring settled hold invoice %s", invoice.RHash)
+		return
+	}
+
+	d.enqueueRecordedDispense(invoice, recorded)
+}
+
+// enqueueRecordedDispense persists a dispense for a paid invoice that was
+// created by the dispenser. It returns false if nothing will be dispensed
+// for the payment.
+func (d *Dispenser) enqueueRecordedDispense(invoice *lightning.Invoice, recorded *sweetdb.Invoice) bool {
+	sale := &sweetdb.Sale{
+		RHash:       invoice.RHash,
+		AmtPaidMSat: invoice.AmtPaidMSat,
+		NodeId:      recorded.NodeId,
+		Settled:     invoice.SettleDate,
+		Duration:    d.GetDispenseDurationForCompartment(recorded.Compartment, invoice.AmtPaidMSat/1000),
+		Outcome:     sweetdb.SaleOutcomeQueued,
+		Compartment: recorded.Compartment,
+		Product:     d.GetCompartment(recorded.Compartment).Product,
+	}
+
+	if sale.Settled.IsZero() {
+		sale.Settled = time.Now()
+	}
+
+	// payments of the simulator never reach the sales ledger
+	simulated := recorded.NodeId == simulatorNodeID
+
+	if sale.Duration == 0 {
+		d.log.Warnf("Not dispensing for invoice %s with an underpaid amount of %d msat",
+			invoice.RHash, invoice.AmtPaidMSat)
+
+		sale.Outcome = sweetdb.SaleOutcomeUnderpaid
+		if !simulated {
+			d.saveSale(sale)
+		}
+
+		d.recorder.RecordPayment(invoice.RHash, invoice.AmtPaidMSat, recorded.Compartment)
+
+		return false
+	}
+
+	added, err := d.db.EnqueueDispense(&sweetdb.Dispense{
+		RHash:       invoice.RHash,
+		AmtPaidMSat: invoice.AmtPaidMSat,
+		Duration:    sale.Duration,
+		State:       sweetdb.DispenseStatePending,
+		Enqueued:    time.Now(),
+		Hold:        recorded.Hold,
+		Compartment: recorded.Compartment,
+		Simulated:   simulated,
+	})
+	if err != nil {
+		d.log.Errorf("could not enqueue dispense for invoice %s: %v", invoice.RHash, err)
+		return false
+	}
+
+	if !added {
+		d.log.Debugf("dispense for invoice %s was already enqueued", invoice.RHash)
+		return true
+	}
+
+	d.log.Infof("enqueued dispense for invoice %s", invoice.RHash)
+
+	d.recorder.RecordPayment(invoice.RHash, invoice.AmtPaidMSat, recorded.Compartment)
+
+	d.playSound(SoundPayment)
+
+	if !simulated {
+		d.saveSale(sale)
+	}
+
+	// wake up the queue, unless it is about to wake up anyway
+	select {
+	case d.queued <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// recoverDispenseQueue marks dispenses that were running during a previous
+// shutdown as interrupted, as it is unknown how much was dispensed for them.
+//
+// The queue dispenses at most once for every payment: an entry is marked
+// as dispensing before its motor starts, and such an entry is never
+// started again. Repeating it could hand out the candy twice, while an
+// interrupted entry is returned here and listed by the api, so the
+// operator can compensate the customer. Held payments of interrupted
+// dispenses are cancelled once their node is started again, which returns
+// them to the customer.
+func (d *Dispenser) recoverDispenseQueue() []*sweetdb.Dispense {
+	interrupted := []*sweetdb.Dispense{}
+
+	dispenses, err := d.db.GetOpenDispenses()
+	if err != nil {
+		d.log.Errorf("could not get dispenses: %v", err)
+		return interrupted
+	}
+
+	for _, dispense := range dispenses {
+		if dispense.State != sweetdb.DispenseStateDispensing {
+			continue
+		}
+
+		d.log.Errorf("dispense for invoice %s was interrupted", dispense.RHash)
+
+		dispense.State = sweetdb.DispenseStateInterrupted
+		dispense.Completed = time.Now()
+
+		err := d.db.SaveDispense(dispense)
+		if err != nil {
+			d.log.Errorf("could not save dispense for invoice %s: %v", dispense.RHash, err)
+		}
+
+		d.updateSaleOutcome(dispense, sweetdb.SaleOutcomeInterrupted)
+
+		interrupted = append(interrupted, dispense)
+	}
+
+	return interrupted
+}
+
+// dispenseInterruptedEvent tells subscribers about a dispense that could
+// not be finished
+func dispenseInterruptedEvent(dispense *sweetdb.Dispense) events.DispenseInterruptedEvent {
+	return events.DispenseInterruptedEvent{
+		RHash:       dispense.RHash,
+		Compartment: dispense.Compartment,
+		AmtPaidMSat: dispense.AmtPaidMSat,
+	}
+}
+
+// processDispenseQueue is run as a goroutine and dispenses all pending
+// entries of the dispense queue one after another
+func (d *Dispenser) processDispenseQueue(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	d.log.Infof("started processing dispense queue")
+
+	backoff := minDispenseRetryBackoff
+
+	for {
+		// retry is set when pending dispenses have to be attempted again
+		var retry <-chan time.Time
+
+		dispenses, err := d.db.GetOpenDispenses()
+		if err != nil {
+			d.log.Errorf("could not get dispenses: %v", err)
+			retry = time.After(backoff)
+		}
+
+		for _, dispense := range dispenses {
+			if dispense.State != sweetdb.DispenseStatePending {
+				continue
+			}
+
+			running, err := d.dispenseQueued(dispense)
+			if !running {
+				d.log.Infof("stopped processing dispense queue")
+				return
+			}
+
+			if err != nil {
+				d.log.Warnf("Retrying pending dispenses in %v: %v", backoff, err)
+				retry = time.After(backoff)
+				break
+			}
+		}
+
+		// a successful run starts over with the shortest wait
+		if retry == nil {
+			backoff = minDispenseRetryBackoff
+		} else {
+			backoff *= 2
+			if backoff > maxDispenseRetryBackoff {
+				backoff = maxDispenseRetryBackoff
+			}
+		}
+
+		select {
+		case <-d.queued:
+		case <-retry:
+		case <-d.done:
+			d.log.Infof("stopped processing dispense queue")
+			return
+		}
+	}
+}
+
+// dispenseQueued runs the motor for a pending dispense and records its
+// outcome. It returns false if the dispenser was stopped in the meantime,
+// and an error if the dispense stays pending to be attempted again later.
+func (d *Dispenser) dispenseQueued(dispense *sweetdb.Dispense) (bool, error) {
+	// respect cooldowns and faults of the motor before dispensing
+	running, err := d.waitForMotor(dispense.Compartment, dispense.Hold)
+	if !running {
+		return false, nil
+	}
+
+	if err != nil {
+		d.cancelHoldDispense(dispense, err)
+		return true, nil
+	}
+
+	// the dispense is marked before the motor starts, so it is never
+	// repeated after a crash
+	dispense.State = sweetdb.DispenseStateDispensing
+
+	err = d.db.SaveDispense(dispense)
+	if err != nil {
+		return true, errors.Errorf("could not save dispense for invoice %s: %v", dispense.RHash, err)
+	}
+
+	d.log.Debugf("Dispensing for invoice %s from compartment %d for a duration of %v",
+		dispense.RHash, dispense.Compartment, dispense.Duration)
+
+	// forget about faults of previous runs
+	select {
+	case <-d.motorFaults:
+	default:
+	}
+
+	err = d.toggleCompartment(dispense.Compartment, true)
+	if err != nil && dispense.Hold {
+		d.cancelHoldDispense(dispense, err)
+		return true, nil
+	}
+
+	if err != nil {
+		// the motor never started, so the dispense is retried later
+		dispense.State = sweetdb.DispenseStatePending
+
+		saveErr := d.db.SaveDispense(dispense)
+		if saveErr != nil {
+			d.log.Errorf("could not save dispense for invoice %s: %v", dispense.RHash, saveErr)
+		}
+
+		return true, errors.Errorf("could not dispense for invoice %s: %v", dispense.RHash, err)
+	}
+
+	stopped := false
+
+	select {
+	case <-time.After(dispense.Duration):
+		d.toggleCompartment(dispense.Compartment, false)
+		d.playSound(SoundDispensed)
+		dispense.State = sweetdb.DispenseStateDone
+	case <-d.motorFaults:
+		d.log.Errorf("dispense for invoice %s was stopped by a motor fault", dispense.RHash)
+		dispense.State = sweetdb.DispenseStateInterrupted
+	case <-d.done:
+		// subscribers are gone already, so only the machine is stopped
+		d.safety.StopMotor(d.motorCommand(dispense.Compartment, false))
+		d.machine.ToggleBuzzer(false)
+		d.trackMotor(dispense.Compartment, false)
+		dispense.State = sweetdb.DispenseStateInterrupted
+		stopped = true
+	}
+
+	dispense.Completed = time.Now()
+
+	err = d.db.SaveDispense(dispense)
+	if err != nil {
+		d.log.Errorf("could not save dispense for invoice %s: %v", dispense.RHash, err)
+	}
+
+	if dispense.State == sweetdb.DispenseStateInterrupted {
+		d.updateSaleOutcome(dispense, sweetdb.SaleOutcomeInterrupted)
+
+		if !stopped {
+			d.sendEvent(dispenseInterruptedEvent(dispense))
+		}
+	} else {
+		d.updateSaleOutcome(dispense, sweetdb.SaleOutcomeDispensed)
+	}
+
+	// held payments are only taken once the candy came out
+	if dispense.Hold {
+		d.resolveHoldInvoice(dispense.RHash, dispense.State == sweetdb.DispenseStateDone)
+	}
+
+	return !stopped, nil
+}
+
+// cancelHoldDispense gives up on a dispense for a held payment that cannot
+// happen soon, and returns the payment to the customer
+func (d *Dispenser) cancelHoldDispense(dispense *sweetdb.Dispense, reason error) {
+	d.log.Warnf("Cancelling dispense for hold invoice %s: %v", dispense.RHash, reason)
+
+	dispense.State = sweetdb.DispenseStateCanceled
+	dispense.Completed = time.Now()
+
+	err := d.db.SaveDispense(dispense)
+	if err != nil {
+		d.log.Errorf("could not save dispense for invoice %s: %v", dispense.RHash, err)
+	}
+
+	d.updateSaleOutcome(dispense, sweetdb.SaleOutcomeCanceled)
+
+	d.resolveHoldInvoice(dispense.RHash, false)
+}
+
+func (d *Dispenser) GetDispenses() ([]*sweetdb.Dispense, error) {
+	return d.db.GetDispenses()
+}
+
+// saveSale writes a sale to the sales ledger
+func (d *Dispenser) saveSale(sale *sweetdb.Sale) {
+	err := d.db.SaveSale(sale)
+	if err != nil {
+		d.log.Errorf("could not save sale for invoice %s: %v", sale.RHash, err)
+	}
+}
+
+// updateSaleOutcome records how the dispense for a sale ended
+func (d *Dispenser) updateSaleOutcome(dispense *sweetdb.Dispense, outcome string) {
+	if dispense.Simulated {
+		return
+	}
+
+	rHash := dispense.RHash
+
+	sale, err := d.db.GetSale(rHash)
+	if err != nil {
+		d.log.Errorf("could not get sale for invoice %s: %v", rHash, err)
+		return
+	}
+
+	if sale == nil {
+		d.log.Warnf("no sale for invoice %s found", rHash)
+		return
+	}
+
+	sale.Outcome = outcome
+
+	d.saveSale(sale)
+}
+
+func (d *Dispenser) GetSales(from time.Time, to time.Time) ([]*sweetdb.Sale, error) {
+	return d.db.GetSales(from, to)
+}
@@ -0,0 +1,53 @@
+package dispenser
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"time"
+)
+
+const (
+	// simulatorNodeID is recorded as the node of simulated payments
+	simulatorNodeID = "simulator"
+)
+
+// SimulatePayment dispenses for a payment reported by the simulator as if
+// it was paid to an invoice of the dispenser. Every simulated payment gets
+// a fresh payment hash, so replaying a recording twice dispenses twice.
+func (d *Dispenser) SimulatePayment(payment machine.SimulatedPayment) {
+	hash := make([]byte, 32)
+
+	_, err := rand.Read(hash)
+	if err != nil {
+		d.log.Errorf("could not generate payment hash for simulated payment: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	invoice := &lightning.Invoice{
+		RHash:       hex.EncodeToString(hash),
+		Settled:     true,
+		MSat:        payment.MSat,
+		AmtPaidMSat: payment.MSat,
+		SettleDate:  now,
+		State:       lightning.InvoiceStateSettled,
+	}
+
+	// the invoice is not saved, as simulated payments are not sales
+	recorded := &sweetdb.Invoice{
+		RHash:       invoice.RHash,
+		NodeId:      simulatorNodeID,
+		MSat:        payment.MSat,
+		Created:     now,
+		Compartment: payment.Compartment,
+	}
+
+	d.log.Infof("Simulating payment %s of %d msat for compartment %d as %s",
+		payment.RHash, payment.MSat, payment.Compartment, invoice.RHash)
+
+	d.enqueueRecordedDispense(invoice, recorded)
+}
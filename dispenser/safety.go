@@ -0,0 +1,254 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"time"
+)
+
+const (
+	// motorRetryInterval is how often the dispense queue checks if the
+	// motor regained its duty cycle budget
+	motorRetryInterval = 5 * time.Second
+)
+
+// defaultMotorDrive runs the motor at full speed without ramps as long as
+// no motor drive has been configured
+var defaultMotorDrive = sweetdb.MotorDrive{
+	Speed: 1,
+}
+
+// defaultMotorLimits apply as long as no motor limits have been configured
+var defaultMotorLimits = sweetdb.MotorLimits{
+	MaxRuntime: 30 * time.Second,
+	Cooldown:   1 * time.Second,
+	DutyCycle:  0.5,
+	DutyWindow: 5 * time.Minute,
+}
+
+func newSafetyLimits(limits sweetdb.MotorLimits) machine.SafetyLimits {
+	return machine.SafetyLimits{
+		MaxRuntime: limits.MaxRuntime,
+		Cooldown:   limits.Cooldown,
+		DutyCycle:  limits.DutyCycle,
+		DutyWindow: limits.DutyWindow,
+	}
+}
+
+// restoreMotorLimits applies saved motor limits to the safety layer
+func (d *Dispenser) restoreMotorLimits() {
+	limits, err := d.db.GetMotorLimits()
+	if err != nil {
+		d.log.Errorf("could not get motor limits: %v", err)
+	}
+
+	if limits == nil {
+		limits = &defaultMotorLimits
+	}
+
+	d.safety.SetLimits(newSafetyLimits(*limits))
+}
+
+// restoreMotorDrive loads the saved speed and ramps of the motor
+func (d *Dispenser) restoreMotorDrive() {
+	drive, err := d.db.GetMotorDrive()
+	if err != nil {
+		d.log.Errorf("could not get motor drive: %v", err)
+	}
+
+	if drive == nil {
+		drive = &defaultMotorDrive
+	}
+
+	d.motorDrive = *drive
+}
+
+// motorCommand starts or stops the motor of a compartment with the
+// configured speed and ramps
+func (d *Dispenser) motorCommand(compartment int, on bool) machine.MotorCommand {
+	return machine.MotorCommand{
+		On:          on,
+		Speed:       d.motorDrive.Speed,
+		RampUp:      d.motorDrive.RampUp,
+		RampDown:    d.motorDrive.RampDown,
+		Compartment: compartment,
+	}
+}
+
+// handleMotorFault is called by the safety layer after it stopped the motor
+func (d *Dispenser) handleMotorFault(fault *machine.Fault) {
+	d.machine.ToggleBuzzer(false)
+	lowStock := d.trackMotor(fault.Compartment, false)
+
+	// let a running queued dispense know that it was cut short
+	select {
+	case d.motorFaults <- struct{}{}:
+	default:
+	}
+
+	d.sendEvent(events.DispenseEvent{On: false, Compartment: fault.Compartment})
+	d.sendEvent(events.FaultEvent{Reason: fault.Reason, Compartment: fault.Compartment, Active: true})
+
+	d.playSound(SoundError)
+
+	if lowStock {
+		d.sendEvent(d.lowStockEvent(fault.Compartment))
+	}
+}
+
+// waitForMotor blocks until the motor of a compartment may start and the
+// dispenser is not under maintenance. Faults and maintenance are waited out
+// until they are over, cooldowns until they elapsed. It returns false if the
+// dispenser was stopped in the meantime.
+//
+// Held payments are not kept waiting for an operator, so for them an error
+// is returned right away on faults and maintenance, and once the motor was
+// unavailable for holdDispenseMaxWait.
+func (d *Dispenser) waitForMotor(compartment int, hold bool) (bool, error) {
+	waiting := ""
+	giveUp := time.After(holdDispenseMaxWait)
+
+	if !hold {
+		giveUp = nil
+	}
+
+	for {
+		err := d.safety.CanStartMotor(compartment)
+		if err == nil && d.maintenance {
+			err = errors.Errorf("dispenser is under maintenance")
+		}
+
+		if err == nil {
+			if waiting != "" {
+				d.log.Infof("Motor of compartment %d may run again", compartment)
+			}
+
+			return true, nil
+		}
+
+		var wait <-chan time.Time
+		reason := ""
+
+		switch cooldown := d.safety.CooldownRemaining(compartment); {
+		case d.safety.GetFault() != nil:
+			reason = "fault"
+		case d.maintenance:
+			reason = "maintenance"
+		case cooldown > 0:
+			// cooldowns are short and expected, so they are not logged
+			wait = time.After(cooldown)
+		default:
+			reason = "limit"
+			wait = time.After(motorRetryInterval)
+		}
+
+		if hold && (reason == "fault" || reason == "maintenance") {
+			return true, err
+		}
+
+		if reason != "" && reason != waiting {
+			d.log.Warnf("Waiting for motor of compartment %d: %v", compartment, err)
+			waiting = reason
+		}
+
+		select {
+		case <-wait:
+		case <-d.motorReleased:
+		case <-giveUp:
+			return true, errors.Errorf("motor is unavailable for %v: %v", holdDispenseMaxWait, err)
+		case <-d.done:
+			return false, nil
+		}
+	}
+}
+
+// releaseMotor wakes up a dispense waiting for the motor
+func (d *Dispenser) releaseMotor() {
+	select {
+	case d.motorReleased <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispenser) GetMotorLimits() sweetdb.MotorLimits {
+	limits := d.safety.GetLimits()
+
+	return sweetdb.MotorLimits{
+		MaxRuntime: limits.MaxRuntime,
+		Cooldown:   limits.Cooldown,
+		DutyCycle:  limits.DutyCycle,
+		DutyWindow: limits.DutyWindow,
+	}
+}
+
+func (d *Dispenser) GetMotorDrive() sweetdb.MotorDrive {
+	return d.motorDrive
+}
+
+func (d *Dispenser) SetMotorDrive(drive sweetdb.MotorDrive) error {
+	d.log.Infof("Setting motor drive")
+
+	if drive.Speed <= 0 || drive.Speed > 1 {
+		return errors.Errorf("Motor speed must be above 0 and at most 1, got %v", drive.Speed)
+	}
+
+	if drive.RampUp < 0 || drive.RampDown < 0 {
+		return errors.Errorf("Motor ramps must not be negative")
+	}
+
+	err := d.db.SetMotorDrive(&drive)
+	if err != nil {
+		return errors.Errorf("Failed setting motor drive: %v", err)
+	}
+
+	d.motorDrive = drive
+
+	d.sendEvent(events.SettingsEvent{Name: "motorDrive", Value: drive})
+
+	return nil
+}
+
+// GetMotorFault returns the current motor fault, or nil if there is none
+func (d *Dispenser) GetMotorFault() *machine.Fault {
+	return d.safety.GetFault()
+}
+
+func (d *Dispenser) SetMotorLimits(limits sweetdb.MotorLimits) error {
+	d.log.Infof("Setting motor limits")
+
+	if limits.MaxRuntime < 0 || limits.Cooldown < 0 || limits.DutyWindow < 0 {
+		return errors.Errorf("Motor limits must not be negative")
+	}
+
+	if limits.DutyCycle < 0 || limits.DutyCycle > 1 {
+		return errors.Errorf("Duty cycle must be between 0 and 1, got %v", limits.DutyCycle)
+	}
+
+	err := d.db.SetMotorLimits(&limits)
+	if err != nil {
+		return errors.Errorf("Failed setting motor limits: %v", err)
+	}
+
+	d.safety.SetLimits(newSafetyLimits(limits))
+
+	d.sendEvent(events.SettingsEvent{Name: "motorLimits", Value: limits})
+
+	return nil
+}
+
+// ResetMotorFault allows the motor to run again after a fault
+func (d *Dispenser) ResetMotorFault() {
+	fault := d.safety.GetFault()
+	if fault == nil {
+		return
+	}
+
+	d.log.Infof("Resetting motor fault")
+
+	d.safety.ResetFault()
+	d.releaseMotor()
+
+	d.sendEvent(events.FaultEvent{Compartment: fault.Compartment, Active: false})
+}
@@ -0,0 +1,199 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"sync"
+	"time"
+)
+
+const (
+	// scheduleInterval is how often schedules are re-evaluated
+	scheduleInterval = 30 * time.Second
+
+	minutesPerDay = 24 * 60
+)
+
+// scheduleNames are all schedules the dispenser knows about
+var scheduleNames = []string{
+	sweetdb.ScheduleOpeningHours,
+	sweetdb.ScheduleQuietHours,
+	sweetdb.SchedulePromoHours,
+}
+
+// scheduleDefaults tells if a schedule without any windows is active
+var scheduleDefaults = map[string]bool{
+	sweetdb.ScheduleOpeningHours: true,
+	sweetdb.ScheduleQuietHours:   false,
+	sweetdb.SchedulePromoHours:   true,
+}
+
+// onDay checks if a window applies to the given day of the week, where no
+// days mean every day
+func onDay(window sweetdb.ScheduleWindow, day time.Weekday) bool {
+	if len(window.Days) == 0 {
+		return true
+	}
+
+	for _, d := range window.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// windowActive checks if a time falls into a schedule window
+func windowActive(window sweetdb.ScheduleWindow, t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	previousDay := (day + 6) % 7
+
+	switch {
+	case window.Start == window.End:
+		return onDay(window, day)
+	case window.Start < window.End:
+		return onDay(window, day) && minute >= window.Start && minute < window.End
+	default:
+		return (onDay(window, day) && minute >= window.Start) ||
+			(onDay(window, previousDay) && minute < window.End)
+	}
+}
+
+// scheduleActive checks if a time falls into any window of a schedule
+func scheduleActive(name string, windows []sweetdb.ScheduleWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return scheduleDefaults[name]
+	}
+
+	for _, window := range windows {
+		if windowActive(window, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restoreSchedules loads all schedules from the database
+func (d *Dispenser) restoreSchedules() {
+	d.schedulesMutex.Lock()
+	defer d.schedulesMutex.Unlock()
+
+	now := time.Now()
+
+	for _, name := range scheduleNames {
+		windows, err := d.db.GetSchedule(name)
+		if err != nil {
+			d.log.Errorf("could not get schedule %s: %v", name, err)
+		}
+
+		d.schedules[name] = windows
+		d.activeSchedules[name] = scheduleActive(name, windows, now)
+	}
+}
+
+// applySchedules evaluates all schedules for the given time and notifies
+// subscribers about schedules that became active or inactive
+func (d *Dispenser) applySchedules(t time.Time) {
+	changes := []events.ScheduleEvent{}
+
+	d.schedulesMutex.Lock()
+
+	for _, name := range scheduleNames {
+		active := scheduleActive(name, d.schedules[name], t)
+
+		if d.activeSchedules[name] == active {
+			continue
+		}
+
+		d.activeSchedules[name] = active
+
+		changes = append(changes, events.ScheduleEvent{Name: name, Active: active})
+	}
+
+	d.schedulesMutex.Unlock()
+
+	for _, change := range changes {
+		d.log.Infof("schedule %s is now active: %v", change.Name, change.Active)
+
+		d.sendEvent(change)
+	}
+}
+
+// runSchedules is run as a goroutine and applies schedules over time
+func (d *Dispenser) runSchedules(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	d.log.Infof("started running schedules")
+
+	for {
+		select {
+		case t := <-ticker.C:
+			d.applySchedules(t)
+		case <-d.done:
+			d.log.Infof("stopped running schedules")
+			return
+		}
+	}
+}
+
+func (d *Dispenser) GetSchedule(name string) []sweetdb.ScheduleWindow {
+	d.schedulesMutex.RLock()
+	defer d.schedulesMutex.RUnlock()
+
+	return d.schedules[name]
+}
+
+// IsScheduleActive tells if a schedule applies at the moment
+func (d *Dispenser) IsScheduleActive(name string) bool {
+	d.schedulesMutex.RLock()
+	defer d.schedulesMutex.RUnlock()
+
+	return d.activeSchedules[name]
+}
+
+// IsOpen tells if the point of sales accepts orders at the moment
+func (d *Dispenser) IsOpen() bool {
+	return d.IsScheduleActive(sweetdb.ScheduleOpeningHours)
+}
+
+func (d *Dispenser) SetSchedule(name string, windows []sweetdb.ScheduleWindow) error {
+	d.log.Infof("Setting schedule %s", name)
+
+	if _, ok := scheduleDefaults[name]; !ok {
+		return errors.Errorf("Unknown schedule %s", name)
+	}
+
+	for _, window := range windows {
+		if window.Start < 0 || window.Start >= minutesPerDay || window.End < 0 || window.End >= minutesPerDay {
+			return errors.Errorf("Schedule window times must be within a day, got %d to %d", window.Start, window.End)
+		}
+
+		for _, day := range window.Days {
+			if day < time.Sunday || day > time.Saturday {
+				return errors.Errorf("Unknown day of the week %d", day)
+			}
+		}
+	}
+
+	d.schedulesMutex.Lock()
+	d.schedules[name] = windows
+	d.schedulesMutex.Unlock()
+
+	err := d.db.SetSchedule(name, windows)
+	if err != nil {
+		return errors.Errorf("Failed setting schedule %s: %v", name, err)
+	}
+
+	d.sendEvent(events.SettingsEvent{Name: name, Value: windows})
+
+	d.applySchedules(time.Now())
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package dispenser
+
+import (
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+)
+
+// RunSelfTest tests the motor, buzzer, status led and inputs of the machine
+// and keeps the report
+func (d *Dispenser) RunSelfTest() *machine.SelfTestReport {
+	d.log.Infof("Running self test")
+
+	report := d.machine.SelfTest()
+
+	d.selfTestMutex.Lock()
+	d.selfTestReport = report
+	d.selfTestMutex.Unlock()
+
+	for _, check := range report.Checks {
+		switch {
+		case !check.Verified:
+			d.log.Warnf("Self test of %s could not be verified: %s", check.Name, check.Message)
+		case check.Passed:
+			d.log.Infof("Self test of %s passed: %s", check.Name, check.Message)
+		default:
+			d.log.Errorf("Self test of %s failed: %s", check.Name, check.Message)
+		}
+	}
+
+	d.sendEvent(events.SelfTestEvent{Passed: report.Passed})
+
+	if !report.Passed {
+		d.playSound(SoundError)
+	}
+
+	return report
+}
+
+// GetSelfTestReport returns the report of the last self test, or nil if no
+// self test was run yet
+func (d *Dispenser) GetSelfTestReport() *machine.SelfTestReport {
+	d.selfTestMutex.Lock()
+	defer d.selfTestMutex.Unlock()
+
+	return d.selfTestReport
+}
@@ -0,0 +1,152 @@
+package dispenser
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/events"
+	"github.com/the-lightning-land/sweetd/machine"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+	"time"
+)
+
+const (
+	SoundStartup   = "startup"
+	SoundPayment   = "payment"
+	SoundDispensed = "dispensed"
+	SoundError     = "error"
+	SoundLowStock  = "lowStock"
+	SoundPairing   = "pairing"
+	SoundPrice     = "price"
+
+	// maxPatternSteps limits the number of on and off durations of a pattern
+	maxPatternSteps = 32
+
+	// maxPatternStep limits a single on or off duration of a pattern
+	maxPatternStep = 5 * time.Second
+)
+
+// defaultBuzzerPatterns are played as long as no pattern has been
+// configured for an event
+var defaultBuzzerPatterns = map[string]machine.Pattern{
+	SoundStartup:   machine.DiagnosticPattern,
+	SoundPayment:   {100 * time.Millisecond},
+	SoundDispensed: {50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond},
+	SoundError:     {600 * time.Millisecond, 200 * time.Millisecond, 600 * time.Millisecond},
+	SoundLowStock:  {300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+	SoundPairing:   {50 * time.Millisecond, 100 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 400 * time.Millisecond},
+	SoundPrice:     {100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 300 * time.Millisecond},
+}
+
+// validatePattern makes sure a pattern can be played in reasonable time
+func validatePattern(pattern machine.Pattern) error {
+	if len(pattern) == 0 || len(pattern) > maxPatternSteps {
+		return errors.Errorf("Pattern must have between 1 and %d steps, got %d", maxPatternSteps, len(pattern))
+	}
+
+	for _, step := range pattern {
+		if step <= 0 || step > maxPatternStep {
+			return errors.Errorf("Pattern steps must be positive and at most %v, got %v", maxPatternStep, step)
+		}
+	}
+
+	return nil
+}
+
+// restoreBuzzerPatterns loads configured buzzer patterns from the database
+func (d *Dispenser) restoreBuzzerPatterns() {
+	patterns, err := d.db.GetBuzzerPatterns()
+	if err != nil {
+		d.log.Errorf("could not get buzzer patterns: %v", err)
+	}
+
+	buzzerPatterns := make(map[string]machine.Pattern)
+
+	for name, pattern := range patterns {
+		buzzerPatterns[name] = pattern
+	}
+
+	d.buzzerPatternsMutex.Lock()
+	d.buzzerPatterns = buzzerPatterns
+	d.buzzerPatternsMutex.Unlock()
+}
+
+// playSound plays the buzzer pattern of an event, unless it is quiet hours.
+// Errors interrupt whatever is playing.
+func (d *Dispenser) playSound(name string) {
+	if d.IsScheduleActive(sweetdb.ScheduleQuietHours) {
+		return
+	}
+
+	d.machine.PlayPattern(d.GetBuzzerPattern(name), name == SoundError)
+}
+
+// GetBuzzerPattern returns the pattern played for an event
+func (d *Dispenser) GetBuzzerPattern(name string) machine.Pattern {
+	d.buzzerPatternsMutex.RLock()
+	defer d.buzzerPatternsMutex.RUnlock()
+
+	if pattern, ok := d.buzzerPatterns[name]; ok {
+		return pattern
+	}
+
+	return defaultBuzzerPatterns[name]
+}
+
+// GetBuzzerPatterns returns the patterns played for all events
+func (d *Dispenser) GetBuzzerPatterns() map[string]machine.Pattern {
+	patterns := make(map[string]machine.Pattern)
+
+	for name := range defaultBuzzerPatterns {
+		patterns[name] = d.GetBuzzerPattern(name)
+	}
+
+	return patterns
+}
+
+// SetBuzzerPattern configures the pattern played for an event
+func (d *Dispenser) SetBuzzerPattern(name string, pattern machine.Pattern) error {
+	d.log.Infof("Setting buzzer pattern %s", name)
+
+	if _, ok := defaultBuzzerPatterns[name]; !ok {
+		return errors.Errorf("Unknown buzzer pattern %s", name)
+	}
+
+	err := validatePattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	d.buzzerPatternsMutex.Lock()
+
+	patterns := make(map[string][]time.Duration)
+	for n, p := range d.buzzerPatterns {
+		patterns[n] = p
+	}
+
+	patterns[name] = pattern
+
+	err = d.db.SetBuzzerPatterns(patterns)
+	if err != nil {
+		d.buzzerPatternsMutex.Unlock()
+		return errors.Errorf("Failed setting buzzer pattern %s: %v", name, err)
+	}
+
+	d.buzzerPatterns[name] = pattern
+
+	d.buzzerPatternsMutex.Unlock()
+
+	d.sendEvent(events.SettingsEvent{Name: "buzzerPatterns", Value: d.GetBuzzerPatterns()})
+
+	return nil
+}
+
+// PreviewBuzzerPattern plays a pattern right away, regardless of quiet hours
+func (d *Dispenser) PreviewBuzzerPattern(pattern machine.Pattern) error {
+	err := validatePattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	d.machine.PlayPattern(pattern, true)
+
+	return nil
+}
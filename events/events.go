@@ -0,0 +1,78 @@
+package events
+
+import "time"
+
+// Event is anything that happens on the dispenser and is of interest to
+// subscribers
+type Event interface{}
+
+// DispenseEvent is emitted whenever dispensing from a compartment starts
+// or stops
+type DispenseEvent struct {
+	On          bool
+	Compartment int
+}
+
+// TouchEvent is emitted whenever the touch sensor is touched or released
+type TouchEvent struct {
+	On bool
+}
+
+// GestureEvent is emitted whenever a gesture was recognized on the touch sensor
+type GestureEvent struct {
+	Gesture  string
+	Duration time.Duration
+}
+
+// SettingsEvent is emitted whenever a setting of the dispenser changes
+type SettingsEvent struct {
+	Name  string
+	Value interface{}
+}
+
+// ScheduleEvent is emitted whenever a schedule becomes active or inactive
+type ScheduleEvent struct {
+	Name   string
+	Active bool
+}
+
+// LowStockEvent is emitted once the estimated remaining quantity falls
+// below the low stock threshold
+type LowStockEvent struct {
+	Compartment int
+	Remaining   float64
+	FillLevel   float64
+}
+
+// RefilledEvent is emitted whenever the hopper of a compartment was refilled
+type RefilledEvent struct {
+	Compartment int
+	Capacity    float64
+}
+
+// FaultEvent is emitted whenever the motor was stopped due to an exceeded
+// safety limit, and again when the fault is reset
+type FaultEvent struct {
+	Reason      string
+	Compartment int
+	Active      bool
+}
+
+// DispenseInterruptedEvent is emitted whenever a paid dispense could not
+// be finished, so the customer may have to be compensated
+type DispenseInterruptedEvent struct {
+	RHash       string
+	Compartment int
+	AmtPaidMSat int64
+}
+
+// SelfTestEvent is emitted whenever a self test of the machine finished
+type SelfTestEvent struct {
+	Passed bool
+}
+
+// Client receives events until it is cancelled
+type Client struct {
+	Events <-chan Event
+	Cancel func()
+}
@@ -1,57 +1,39 @@
 module github.com/the-lightning-land/sweetd
 
+go 1.13
+
 require (
-	cloud.google.com/go v0.43.0 // indirect
-	github.com/coreos/bbolt v1.3.3 // indirect
-	github.com/coreos/etcd v3.3.13+incompatible // indirect
-	github.com/coreos/go-semver v0.3.0 // indirect
-	github.com/coreos/go-systemd v0.0.0-20190719114852-fd7a80b32e1f // indirect
 	github.com/cretz/bine v0.1.0
 	github.com/go-errors/errors v1.0.1
-	github.com/go-kit/kit v0.9.0 // indirect
-	github.com/gobuffalo/logger v1.0.1 // indirect
-	github.com/gobuffalo/packr v0.0.0-20190708182234-662c20c19dde // indirect
 	github.com/gobuffalo/packr/v2 v2.5.3-0.20190708182234-662c20c19dde
-	github.com/godbus/dbus v4.1.0+incompatible
 	github.com/godbus/dbus/v5 v5.0.3-0.20190904191448-bf76e5699422
-	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
-	github.com/golang/protobuf v1.3.2
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/mux v1.7.3
 	github.com/gorilla/websocket v1.4.0
-	github.com/grpc-ecosystem/grpc-gateway v1.9.4 // indirect
-	github.com/inconshreveable/go-update v0.0.0-20160112193335-8152e7eb6ccf
 	github.com/jessevdk/go-flags v1.4.0
-	github.com/kisielk/errcheck v1.2.0 // indirect
-	github.com/kr/pty v1.1.8 // indirect
-	github.com/lightningnetwork/lnd v0.5.2-beta
-	github.com/magiconair/properties v1.8.1 // indirect
-	github.com/muka/ble v0.0.0-20190208060657-c5982255bf40 // indirect
+	github.com/lightningnetwork/lnd v0.7.1-beta
 	github.com/muka/go-bluetooth v0.0.0-20190511040657-127007ab0f74
-	github.com/mwitkow/go-conntrack v0.0.0-20190716064945-2f068394615f // indirect
-	github.com/pelletier/go-toml v1.4.0 // indirect
 	github.com/pkg/errors v0.8.1
-	github.com/prometheus/common v0.6.0 // indirect
-	github.com/prometheus/procfs v0.0.3 // indirect
-	github.com/rogpeppe/fastuuid v1.2.0 // indirect
-	github.com/russross/blackfriday v2.0.0+incompatible // indirect
 	github.com/sirupsen/logrus v1.4.2
-	github.com/spf13/afero v1.2.2 // indirect
-	github.com/spf13/jwalterweatherman v1.1.0 // indirect
-	github.com/stretchr/objx v0.2.0 // indirect
-	github.com/ugorji/go v1.1.7 // indirect
 	go.etcd.io/bbolt v1.3.3
-	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
-	golang.org/x/exp v0.0.0-20190718202018-cfdd5522f6f6 // indirect
-	golang.org/x/image v0.0.0-20190703141733-d6a02ce849c9 // indirect
-	golang.org/x/mobile v0.0.0-20190719004257-d2bd2a29d028 // indirect
-	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
 	golang.org/x/sys v0.0.0-20190712062909-fae7ac547cb7
-	golang.org/x/tools v0.0.0-20190719005602-e377ae9d6386 // indirect
 	google.golang.org/grpc v1.22.0
 	periph.io/x/periph v3.4.0+incompatible
 )
 
-replace github.com/golang/lint => github.com/golang/lint v0.0.0-20190227174305-8f45f776aaf1
+require (
+	github.com/coreos/bbolt v1.3.3 // indirect
+	github.com/gobuffalo/logger v1.0.1 // indirect
+	github.com/grpc-ecosystem/grpc-gateway v1.9.4 // indirect
+	github.com/rogpeppe/fastuuid v1.2.0 // indirect
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
+	golang.org/x/text v0.3.2 // indirect
+	google.golang.org/genproto v0.0.0-20190716160619-c506a9f90610 // indirect
+)
 
 replace github.com/muka/go-bluetooth => github.com/davidknezic/go-bluetooth v0.0.0-20190908190248-44f9969a8d67
+
+replace github.com/btcsuite/btcwallet v0.0.0-20180904010540-284e2e0e696e33d5be388f7f3d9a26db703e0c06 => github.com/btcsuite/btcwallet v0.0.0-20181130030754-284e2e0e696e
+
+replace github.com/coreos/bbolt v0.0.0-20180223184059-7ee3ded59d4835e10f3e7d0f7603c42aa5e83820 => github.com/coreos/bbolt v1.3.1-etcd.8
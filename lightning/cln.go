@@ -0,0 +1,617 @@
+package lightning
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clnInvoiceStatusUnpaid  = "unpaid"
+	clnInvoiceStatusPaid    = "paid"
+	clnInvoiceStatusExpired = "expired"
+
+	// clnChannelStateNormal is the state of channels that can route payments
+	clnChannelStateNormal = "CHANNELD_NORMAL"
+
+	// clnErrorWaitTimedOut is returned by waitanyinvoice when no invoice
+	// was paid within the timeout
+	clnErrorWaitTimedOut = 904
+)
+
+type ClnNodeConfig struct {
+	// SocketPath is the path of the lightning-rpc unix socket
+	SocketPath string
+	Logger     Logger
+
+	// IndexStore optionally persists how far paid invoices were seen
+	IndexStore InvoiceIndexStore
+
+	// OnConnectionState is called whenever the connection state changes
+	OnConnectionState func(state string)
+}
+
+// ClnNode talks to Core Lightning through JSON-RPC over its unix socket
+type ClnNode struct {
+	*invoiceFeed
+	socketPath  string
+	logger      Logger
+	nextRequest uint64
+	indexStore  InvoiceIndexStore
+	index       *InvoiceIndex
+	quit        chan struct{}
+}
+
+// Compile time check for protocol compatibility
+var _ Node = (*ClnNode)(nil)
+var _ StatusNode = (*ClnNode)(nil)
+
+func NewClnNode(config *ClnNodeConfig) (*ClnNode, error) {
+	if config.SocketPath == "" {
+		return nil, errors.Errorf("No socket path given")
+	}
+
+	return &ClnNode{
+		invoiceFeed: newInvoiceFeed(config.Logger, config.OnConnectionState),
+		socketPath:  config.SocketPath,
+		logger:      config.Logger,
+		indexStore:  config.IndexStore,
+	}, nil
+}
+
+// clnMsat is an amount in millisatoshis, which older versions of Core
+// Lightning encode as a string like "1000msat" and newer ones as a number
+type clnMsat int64
+
+func (m *clnMsat) UnmarshalJSON(data []byte) error {
+	var value interface{}
+
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case float64:
+		*m = clnMsat(value)
+	case string:
+		msat, err := strconv.ParseInt(strings.TrimSuffix(value, "msat"), 10, 64)
+		if err != nil {
+			return errors.Errorf("Invalid amount %s: %v", value, err)
+		}
+		*m = clnMsat(msat)
+	case nil:
+		*m = 0
+	default:
+		return errors.Errorf("Invalid amount %v", value)
+	}
+
+	return nil
+}
+
+type clnInvoice struct {
+	Label              string  `json:"label"`
+	PaymentHash        string  `json:"payment_hash"`
+	Bolt11             string  `json:"bolt11"`
+	Status             string  `json:"status"`
+	Description        string  `json:"description"`
+	AmountMsat         clnMsat `json:"amount_msat"`
+	AmountReceivedMsat clnMsat `json:"amount_received_msat"`
+	ExpiresAt          int64   `json:"expires_at"`
+	PaidAt             int64   `json:"paid_at"`
+	PayIndex           uint64  `json:"pay_index"`
+}
+
+type clnListInvoicesResponse struct {
+	Invoices []*clnInvoice `json:"invoices"`
+}
+
+type clnAddInvoiceResponse struct {
+	PaymentHash string `json:"payment_hash"`
+	Bolt11      string `json:"bolt11"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type clnGetInfoResponse struct {
+	Id                    string `json:"id"`
+	Blockheight           uint32 `json:"blockheight"`
+	NumActiveChannels     uint32 `json:"num_active_channels"`
+	WarningBitcoindSync   string `json:"warning_bitcoind_sync"`
+	WarningLightningdSync string `json:"warning_lightningd_sync"`
+}
+
+type clnListFundsResponse struct {
+	Channels []struct {
+		State         string  `json:"state"`
+		Connected     bool    `json:"connected"`
+		OurAmountMsat clnMsat `json:"our_amount_msat"`
+		AmountMsat    clnMsat `json:"amount_msat"`
+	} `json:"channels"`
+}
+
+type clnRequest struct {
+	JsonRpc string      `json:"jsonrpc"`
+	Id      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type clnError struct {
+	Method  string
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *clnError) Error() string {
+	return fmt.Sprintf("%s failed with code %d: %s", e.Method, e.Code, e.Message)
+}
+
+type clnResponse struct {
+	Id     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *clnError       `json:"error"`
+}
+
+// call runs a single JSON-RPC command on its own connection, which is
+// closed as soon as the context is done
+func (r *ClnNode) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", r.socketPath)
+	if err != nil {
+		return errors.Errorf("Could not connect to %s: %v", r.socketPath, err)
+	}
+
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	req := clnRequest{
+		JsonRpc: "2.0",
+		Id:      atomic.AddUint64(&r.nextRequest, 1),
+		Method:  method,
+		Params:  params,
+	}
+
+	err = json.NewEncoder(conn).Encode(&req)
+	if err != nil {
+		return errors.Errorf("Could not send %s: %v", method, err)
+	}
+
+	res := clnResponse{}
+
+	err = json.NewDecoder(conn).Decode(&res)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return errors.Errorf("Could not receive %s: %v", method, err)
+	}
+
+	if res.Error != nil {
+		res.Error.Method = method
+		return res.Error
+	}
+
+	if res.Id != req.Id {
+		return errors.Errorf("%s got response to request %d", method, res.Id)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(res.Result, result)
+	if err != nil {
+		return errors.Errorf("Could not parse %s: %v", method, err)
+	}
+
+	return nil
+}
+
+func clnInvoiceState(status string) string {
+	switch status {
+	case clnInvoiceStatusPaid:
+		return InvoiceStateSettled
+	case clnInvoiceStatusExpired:
+		return InvoiceStateCanceled
+	default:
+		return InvoiceStateOpen
+	}
+}
+
+func newClnInvoice(invoice *clnInvoice) *Invoice {
+	return &Invoice{
+		RHash:          invoice.PaymentHash,
+		PaymentRequest: invoice.Bolt11,
+		Settled:        invoice.Status == clnInvoiceStatusPaid,
+		MSat:           int64(invoice.AmountMsat),
+		AmtPaidMSat:    int64(invoice.AmountReceivedMsat),
+		Memo:           invoice.Description,
+		SettleDate:     unixTime(invoice.PaidAt),
+		State:          clnInvoiceState(invoice.Status),
+	}
+}
+
+// newClnInvoiceParams translates an invoice request to the parameters of
+// the invoice command
+func newClnInvoiceParams(req *InvoiceRequest) (map[string]interface{}, error) {
+	if req.MSat < 0 {
+		return nil, errors.Errorf("Invoice amount can not be negative")
+	}
+
+	if req.Expiry < 0 {
+		return nil, errors.Errorf("Invoice expiry can not be negative")
+	}
+
+	// the invoice command only commits to the hash of a description it
+	// was given in full
+	if len(req.DescriptionHash) > 0 {
+		return nil, errors.Errorf("Core Lightning can not add invoices with a description hash")
+	}
+
+	label, err := newClnLabel()
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"amount_msat": "any",
+		"label":       label,
+		"description": req.Memo,
+	}
+
+	if req.MSat > 0 {
+		params["amount_msat"] = req.MSat
+	}
+
+	if req.Expiry > 0 {
+		params["expiry"] = int64(req.Expiry / time.Second)
+	}
+
+	if req.FallbackAddr != "" {
+		params["fallbacks"] = []string{req.FallbackAddr}
+	}
+
+	if req.Private {
+		params["exposeprivatechannels"] = true
+	}
+
+	return params, nil
+}
+
+// newClnLabel creates the unique label Core Lightning requires for each
+// invoice
+func newClnLabel() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Errorf("Could not create invoice label: %v", err)
+	}
+
+	return "sweetd-" + hex.EncodeToString(b), nil
+}
+
+func (r *ClnNode) Start() error {
+	if r.quit != nil {
+		return nil
+	}
+
+	r.quit = make(chan struct{})
+
+	go r.run(r.quit, r.waitInvoices)
+
+	return nil
+}
+
+func (r *ClnNode) Stop() error {
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+
+	r.closeAllInvoiceSubscriptions()
+
+	return nil
+}
+
+// waitInvoices delivers paid invoices to all clients from the last seen
+// pay index on, until a command fails or the node is stopped
+func (r *ClnNode) waitInvoices(quit chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := r.call(ctx, "getinfo", nil, &clnGetInfoResponse{})
+	if err != nil {
+		return errors.Errorf("Node is unreachable: %v", err)
+	}
+
+	index, err := r.getInvoiceIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.setConnectionState(ConnectionStateConnected)
+
+	r.logger.Infof("Waiting for invoices paid after pay index %d", index.SettleIndex)
+
+	for {
+		invoice := &clnInvoice{}
+
+		err := r.call(ctx, "waitanyinvoice", map[string]interface{}{
+			"lastpay_index": index.SettleIndex,
+		}, invoice)
+		if err != nil {
+			return errors.Errorf("Failed waiting for invoices: %v", err)
+		}
+
+		r.deliverInvoice(newClnInvoice(invoice))
+
+		// the index only advances once clients acknowledged the invoice,
+		// so it is delivered again after a crash
+		index = r.advanceInvoiceIndex(index, invoice)
+	}
+}
+
+// getInvoiceIndex returns the pay index seen last. A resubscription
+// continues where the previous one stopped, otherwise the persisted index
+// is used. Without one, it starts at the latest paid invoice, to only
+// receive invoices paid from now on.
+func (r *ClnNode) getInvoiceIndex(ctx context.Context) (InvoiceIndex, error) {
+	if r.index != nil {
+		return *r.index, nil
+	}
+
+	if r.indexStore != nil {
+		index, err := r.indexStore.GetInvoiceIndex()
+		if err != nil {
+			r.logger.Errorf("Could not get invoice index: %v", err)
+		} else if index.SettleIndex > 0 {
+			r.index = &index
+			return index, nil
+		}
+	}
+
+	latest, err := r.findLatestPayIndex(ctx)
+	if err != nil {
+		return InvoiceIndex{}, errors.Errorf("Could not find latest pay index: %v", err)
+	}
+
+	index := r.advanceInvoiceIndex(InvoiceIndex{}, &clnInvoice{PayIndex: latest})
+	r.index = &index
+
+	return index, nil
+}
+
+// hasPaidInvoiceAfter tells if an invoice was paid after the given pay
+// index, without waiting for one
+func (r *ClnNode) hasPaidInvoiceAfter(ctx context.Context, index uint64) (bool, error) {
+	err := r.call(ctx, "waitanyinvoice", map[string]interface{}{
+		"lastpay_index": index,
+		"timeout":       0,
+	}, nil)
+	if err, ok := err.(*clnError); ok && err.Code == clnErrorWaitTimedOut {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// findLatestPayIndex searches the pay index of the invoice paid last.
+// Pay indexes count up from one without gaps, so it takes a logarithmic
+// number of commands instead of listing every invoice of the node.
+func (r *ClnNode) findLatestPayIndex(ctx context.Context) (uint64, error) {
+	// find an index no invoice was paid after
+	var low, high uint64 = 0, 1
+
+	for {
+		paid, err := r.hasPaidInvoiceAfter(ctx, high)
+		if err != nil {
+			return 0, err
+		}
+
+		if !paid {
+			break
+		}
+
+		low, high = high+1, high*2
+	}
+
+	// the latest pay index is at least low and at most high
+	for low < high {
+		mid := low + (high-low+1)/2
+
+		paid, err := r.hasPaidInvoiceAfter(ctx, mid-1)
+		if err != nil {
+			return 0, err
+		}
+
+		if paid {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	return low, nil
+}
+
+// advanceInvoiceIndex persists the pay index of an invoice if it is newer
+// than the given index
+func (r *ClnNode) advanceInvoiceIndex(index InvoiceIndex, invoice *clnInvoice) InvoiceIndex {
+	if invoice.PayIndex <= index.SettleIndex {
+		return index
+	}
+
+	next := index
+	next.SettleIndex = invoice.PayIndex
+
+	r.index = &next
+
+	if r.indexStore == nil {
+		return next
+	}
+
+	err := r.indexStore.SetInvoiceIndex(next)
+	if err != nil {
+		r.logger.Errorf("Could not save invoice index: %v", err)
+	}
+
+	return next
+}
+
+// lookupInvoice finds an invoice by its payment hash
+func (r *ClnNode) lookupInvoice(ctx context.Context, rHash string) (*clnInvoice, error) {
+	res := clnListInvoicesResponse{}
+
+	err := r.call(ctx, "listinvoices", map[string]interface{}{
+		"payment_hash": rHash,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Invoices) == 0 {
+		return nil, errors.Errorf("No invoice with hash %s", rHash)
+	}
+
+	return res.Invoices[0], nil
+}
+
+func (r *ClnNode) GetInvoice(rHash string) (*Invoice, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	invoice, err := r.lookupInvoice(context.Background(), rHash)
+	if err != nil {
+		return nil, errors.Errorf("Could not find invoice: %v", err)
+	}
+
+	return newClnInvoice(invoice), nil
+}
+
+func (r *ClnNode) AddInvoice(req *InvoiceRequest) (*Invoice, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	params, err := newClnInvoiceParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	res := clnAddInvoiceResponse{}
+
+	err = r.call(ctx, "invoice", params, &res)
+	if err != nil {
+		return nil, errors.Errorf("Could not add invoice: %v", err)
+	}
+
+	invoice, err := r.lookupInvoice(ctx, res.PaymentHash)
+	if err != nil {
+		r.logger.Errorf("Could not look up added invoice: %v", err)
+
+		invoice = &clnInvoice{
+			PaymentHash: res.PaymentHash,
+			Bolt11:      res.Bolt11,
+			Status:      clnInvoiceStatusUnpaid,
+			Description: req.Memo,
+			AmountMsat:  clnMsat(req.MSat),
+			ExpiresAt:   res.ExpiresAt,
+		}
+	}
+
+	added := newClnInvoice(invoice)
+
+	// Core Lightning only tells when an invoice expires
+	added.CreationDate = time.Now()
+	if invoice.ExpiresAt > 0 {
+		added.Expiry = time.Until(unixTime(invoice.ExpiresAt)).Round(time.Second)
+	}
+
+	return added, nil
+}
+
+// GetStatus checks if the node is reachable, synced and has channels with
+// enough inbound liquidity to receive payments
+func (r *ClnNode) GetStatus() (*NodeStatus, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	info := clnGetInfoResponse{}
+
+	err := r.call(ctx, "getinfo", nil, &info)
+	if err != nil {
+		return nil, errors.Errorf("Could not get info: %v", err)
+	}
+
+	funds := clnListFundsResponse{}
+
+	err = r.call(ctx, "listfunds", nil, &funds)
+	if err != nil {
+		return nil, errors.Errorf("Could not list funds: %v", err)
+	}
+
+	status := &NodeStatus{
+		Reachable:      true,
+		SyncedToChain:  info.WarningBitcoindSync == "" && info.WarningLightningdSync == "",
+		BlockHeight:    info.Blockheight,
+		ActiveChannels: info.NumActiveChannels,
+		Checked:        time.Now(),
+	}
+
+	for _, channel := range funds.Channels {
+		if channel.State != clnChannelStateNormal {
+			continue
+		}
+
+		status.BalanceMSat += int64(channel.OurAmountMsat)
+
+		if channel.Connected {
+			status.InboundMSat += int64(channel.AmountMsat - channel.OurAmountMsat)
+		}
+	}
+
+	return status, nil
+}
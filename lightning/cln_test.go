@@ -0,0 +1,497 @@
+package lightning
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCln serves the JSON-RPC commands of Core Lightning on a unix socket
+type fakeCln struct {
+	t        *testing.T
+	listener net.Listener
+	dir      string
+
+	mu       sync.Mutex
+	paid     []map[string]interface{}
+	invoices map[string]map[string]interface{}
+	calls    []clnRequest
+	changed  chan struct{}
+	done     chan struct{}
+}
+
+func newFakeCln(t *testing.T) *fakeCln {
+	dir, err := ioutil.TempDir("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "lightning-rpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeCln{
+		t:        t,
+		listener: listener,
+		dir:      dir,
+		invoices: make(map[string]map[string]interface{}),
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.serve()
+
+	return s
+}
+
+func (s *fakeCln) socketPath() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeCln) close() {
+	close(s.done)
+	s.listener.Close()
+	os.RemoveAll(s.dir)
+}
+
+// pay marks an invoice paid with the next pay index
+func (s *fakeCln) pay(hash string, amountMsat interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paid = append(s.paid, map[string]interface{}{
+		"label":                "label-" + hash,
+		"payment_hash":         hash,
+		"status":               "paid",
+		"amount_msat":          amountMsat,
+		"amount_received_msat": amountMsat,
+		"pay_index":            len(s.paid) + 1,
+		"paid_at":              1500000000,
+	})
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *fakeCln) requests(method string) []clnRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []clnRequest
+	for _, req := range s.calls {
+		if req.Method == method {
+			requests = append(requests, req)
+		}
+	}
+
+	return requests
+}
+
+func (s *fakeCln) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeCln) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req struct {
+		clnRequest
+		Params map[string]interface{} `json:"params"`
+	}
+
+	err := json.NewDecoder(conn).Decode(&req)
+	if err != nil {
+		return
+	}
+
+	req.clnRequest.Params = req.Params
+
+	s.mu.Lock()
+	s.calls = append(s.calls, req.clnRequest)
+	s.mu.Unlock()
+
+	result, rpcErr := s.result(req.Method, req.Params)
+
+	res := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.Id,
+	}
+
+	if rpcErr != nil {
+		res["error"] = rpcErr
+	} else {
+		res["result"] = result
+	}
+
+	json.NewEncoder(conn).Encode(res)
+}
+
+func (s *fakeCln) result(method string, params map[string]interface{}) (interface{}, *clnError) {
+	switch method {
+	case "getinfo":
+		return map[string]interface{}{"id": "02abc", "blockheight": 100}, nil
+	case "invoice":
+		hash := "hash-" + params["label"].(string)
+
+		s.mu.Lock()
+		s.invoices[hash] = map[string]interface{}{
+			"label":        params["label"],
+			"payment_hash": hash,
+			"bolt11":       "lnbc1",
+			"status":       "unpaid",
+			"description":  params["description"],
+			// older versions encode amounts as strings
+			"amount_msat": "2000msat",
+			"expires_at":  time.Now().Add(time.Hour).Unix(),
+		}
+		s.mu.Unlock()
+
+		return map[string]interface{}{
+			"payment_hash": hash,
+			"bolt11":       "lnbc1",
+			"expires_at":   time.Now().Add(time.Hour).Unix(),
+		}, nil
+	case "listinvoices":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		invoices := []interface{}{}
+		if invoice, ok := s.invoices[params["payment_hash"].(string)]; ok {
+			invoices = append(invoices, invoice)
+		}
+
+		return map[string]interface{}{"invoices": invoices}, nil
+	case "waitanyinvoice":
+		index := int(params["lastpay_index"].(float64))
+		_, hasTimeout := params["timeout"]
+
+		for {
+			s.mu.Lock()
+			changed := s.changed
+			if index < len(s.paid) {
+				invoice := s.paid[index]
+				s.mu.Unlock()
+				return invoice, nil
+			}
+			s.mu.Unlock()
+
+			if hasTimeout {
+				return nil, &clnError{Code: clnErrorWaitTimedOut, Message: "Timed out"}
+			}
+
+			select {
+			case <-changed:
+			case <-s.done:
+				return nil, &clnError{Code: -1, Message: "Shutting down"}
+			}
+		}
+	default:
+		return nil, &clnError{Code: -32601, Message: "Unknown command " + method}
+	}
+}
+
+type memoryIndexStore struct {
+	mu    sync.Mutex
+	index InvoiceIndex
+}
+
+func (s *memoryIndexStore) GetInvoiceIndex() (InvoiceIndex, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.index, nil
+}
+
+func (s *memoryIndexStore) SetInvoiceIndex(index InvoiceIndex) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index = index
+
+	return nil
+}
+
+func startClnNode(t *testing.T, server *fakeCln, store InvoiceIndexStore) (*ClnNode, *InvoicesClient) {
+	node, err := NewClnNode(&ClnNodeConfig{
+		SocketPath: server.socketPath(),
+		Logger:     noopLogger{},
+		IndexStore: store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := node.SubscribeInvoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = node.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return node, client
+}
+
+// waitConnected waits until the node started waiting for paid invoices
+func waitConnected(t *testing.T, node *ClnNode) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for node.ConnectionState() != ConnectionStateConnected {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for connection")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receiveInvoice receives the next invoice and acknowledges it
+func receiveInvoice(t *testing.T, client *InvoicesClient) *Invoice {
+	select {
+	case invoice := <-client.Invoices:
+		client.Ack()
+		return invoice
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for invoice")
+		return nil
+	}
+}
+
+func TestClnMsat(t *testing.T) {
+	tests := []struct {
+		json string
+		msat clnMsat
+	}{
+		{`1000`, 1000},
+		{`"1000msat"`, 1000},
+		{`null`, 0},
+	}
+
+	for _, test := range tests {
+		var msat clnMsat
+
+		err := json.Unmarshal([]byte(test.json), &msat)
+		if err != nil {
+			t.Fatalf("unable to decode %s: %v", test.json, err)
+		}
+
+		if msat != test.msat {
+			t.Errorf("decoded %s as %d, expected %d", test.json, msat, test.msat)
+		}
+	}
+
+	var msat clnMsat
+	if err := json.Unmarshal([]byte(`"many msat"`), &msat); err == nil {
+		t.Errorf("expected invalid amount to fail")
+	}
+}
+
+func TestClnAddInvoice(t *testing.T) {
+	server := newFakeCln(t)
+	defer server.close()
+
+	node, _ := startClnNode(t, server, nil)
+	defer node.Stop()
+
+	invoice, err := node.AddInvoice(&InvoiceRequest{
+		Memo:   "Candy",
+		MSat:   2000,
+		Expiry: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	requests := server.requests("invoice")
+	if len(requests) != 1 {
+		t.Fatalf("expected one invoice command, got %d", len(requests))
+	}
+
+	params := requests[0].Params.(map[string]interface{})
+	if params["amount_msat"] != float64(2000) {
+		t.Errorf("unexpected amount %v", params["amount_msat"])
+	}
+	if params["description"] != "Candy" {
+		t.Errorf("unexpected description %v", params["description"])
+	}
+	if params["expiry"] != float64(600) {
+		t.Errorf("unexpected expiry %v", params["expiry"])
+	}
+	if label, _ := params["label"].(string); !strings.HasPrefix(label, "sweetd-") {
+		t.Errorf("unexpected label %v", params["label"])
+	}
+
+	if invoice.RHash != "hash-"+params["label"].(string) {
+		t.Errorf("unexpected hash %s", invoice.RHash)
+	}
+	if invoice.MSat != 2000 {
+		t.Errorf("unexpected amount %d", invoice.MSat)
+	}
+	if invoice.State != InvoiceStateOpen {
+		t.Errorf("unexpected state %s", invoice.State)
+	}
+	if invoice.Expiry <= 0 {
+		t.Errorf("expected an expiry, got %v", invoice.Expiry)
+	}
+}
+
+func TestClnWaitInvoicesResumesFromPayIndex(t *testing.T) {
+	server := newFakeCln(t)
+	defer server.close()
+
+	server.pay("a", 1000)
+	server.pay("b", "2000msat")
+	server.pay("c", "3000msat")
+
+	store := &memoryIndexStore{index: InvoiceIndex{SettleIndex: 1}}
+
+	node, client := startClnNode(t, server, store)
+	defer node.Stop()
+
+	invoice := receiveInvoice(t, client)
+	if invoice.RHash != "b" || !invoice.Settled || invoice.AmtPaidMSat != 2000 {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+
+	invoice = receiveInvoice(t, client)
+	if invoice.RHash != "c" || invoice.AmtPaidMSat != 3000 {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+
+	waits := server.requests("waitanyinvoice")
+	first := waits[0].Params.(map[string]interface{})
+	if first["lastpay_index"] != float64(1) {
+		t.Errorf("expected to resume after pay index 1, got %v", first["lastpay_index"])
+	}
+
+	server.pay("d", 4000)
+
+	invoice = receiveInvoice(t, client)
+	if invoice.RHash != "d" || invoice.AmtPaidMSat != 4000 {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+
+	index, _ := store.GetInvoiceIndex()
+	if index.SettleIndex < 3 {
+		t.Errorf("expected index to advance, got %d", index.SettleIndex)
+	}
+}
+
+func TestClnStartsAfterLatestPaidInvoice(t *testing.T) {
+	server := newFakeCln(t)
+	defer server.close()
+
+	for _, hash := range []string{"a", "b", "c", "d", "e"} {
+		server.pay(hash, 1000)
+	}
+
+	store := &memoryIndexStore{}
+
+	node, client := startClnNode(t, server, store)
+	defer node.Stop()
+
+	waitConnected(t, node)
+
+	server.pay("f", 1000)
+
+	invoice := receiveInvoice(t, client)
+	if invoice.RHash != "f" {
+		t.Fatalf("expected only invoices paid from now on, got %s", invoice.RHash)
+	}
+
+	if len(server.requests("listinvoices")) != 0 {
+		t.Errorf("expected the pay index to be found without listing invoices")
+	}
+
+	index, _ := store.GetInvoiceIndex()
+	if index.SettleIndex < 5 {
+		t.Errorf("expected index to start at the latest paid invoice, got %d", index.SettleIndex)
+	}
+}
+
+func TestClnFindLatestPayIndex(t *testing.T) {
+	for paid := 0; paid < 10; paid++ {
+		server := newFakeCln(t)
+
+		for i := 0; i < paid; i++ {
+			server.pay(string(rune('a'+i)), 1000)
+		}
+
+		node, err := NewClnNode(&ClnNodeConfig{
+			SocketPath: server.socketPath(),
+			Logger:     noopLogger{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest, err := node.findLatestPayIndex(context.Background())
+		if err != nil {
+			t.Fatalf("unable to find latest pay index: %v", err)
+		}
+
+		if latest != uint64(paid) {
+			t.Errorf("expected latest pay index %d, got %d", paid, latest)
+		}
+
+		server.close()
+	}
+}
+
+func TestClnIndexAdvancesOnlyAfterAck(t *testing.T) {
+	server := newFakeCln(t)
+	defer server.close()
+
+	server.pay("a", 1000)
+	server.pay("b", 1000)
+
+	store := &memoryIndexStore{index: InvoiceIndex{SettleIndex: 1}}
+
+	node, client := startClnNode(t, server, store)
+	defer node.Stop()
+
+	select {
+	case <-client.Invoices:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for invoice")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if index, _ := store.GetInvoiceIndex(); index.SettleIndex != 1 {
+		t.Fatalf("expected index to wait for the ack, got %d", index.SettleIndex)
+	}
+
+	client.Ack()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if index, _ := store.GetInvoiceIndex(); index.SettleIndex == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for index to advance")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
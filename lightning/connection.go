@@ -0,0 +1,45 @@
+package lightning
+
+import "time"
+
+const (
+	ConnectionStateConnecting   = "connecting"
+	ConnectionStateConnected    = "connected"
+	ConnectionStateDisconnected = "disconnected"
+)
+
+const (
+	// minReconnectBackoff is the first wait before resubscribing to
+	// invoices after the stream broke
+	minReconnectBackoff = 1 * time.Second
+
+	// maxReconnectBackoff caps the wait between resubscribing to invoices
+	maxReconnectBackoff = 2 * time.Minute
+
+	// statusTimeout is how long checking the status of a node may take
+	statusTimeout = 10 * time.Second
+)
+
+// InvoiceIndex is how far the invoices of a node were seen
+type InvoiceIndex struct {
+	AddIndex    uint64
+	SettleIndex uint64
+}
+
+// InvoiceIndexStore persists how far the invoices of a node were seen, so
+// invoices that were added or settled while the node was unreachable are
+// delivered once it is reachable again
+type InvoiceIndexStore interface {
+	GetInvoiceIndex() (InvoiceIndex, error)
+	SetInvoiceIndex(index InvoiceIndex) error
+}
+
+// nextBackoff doubles the wait before reconnecting up to the maximum
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxReconnectBackoff {
+		return maxReconnectBackoff
+	}
+
+	return backoff
+}
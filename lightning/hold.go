@@ -0,0 +1,18 @@
+package lightning
+
+// HoldInvoiceNode is implemented by nodes that can hold incoming payments
+// until they are explicitly settled or cancelled
+type HoldInvoiceNode interface {
+	Node
+	AddHoldInvoice(hash []byte, request *InvoiceRequest) (*Invoice, error)
+	SubscribeSingleInvoice(rHash string) (*SingleInvoiceClient, error)
+	SettleInvoice(preimage []byte) error
+	CancelInvoice(rHash string) error
+}
+
+// SingleInvoiceClient receives updates of a single invoice until it is
+// cancelled
+type SingleInvoiceClient struct {
+	Invoices <-chan *Invoice
+	Cancel   func()
+}
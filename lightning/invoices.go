@@ -1,12 +1,180 @@
 package lightning
 
+import (
+	"sync"
+	"time"
+)
+
 type InvoicesClient struct {
 	Invoices   chan *Invoice
 	Id         uint32
 	cancelChan chan struct{}
-	node       Node
+	acks       chan struct{}
+	feed       *invoiceFeed
 }
 
 func (c *InvoicesClient) Cancel() {
-	c.node.unsubscribeInvoices(c)
+	c.feed.unsubscribeInvoices(c)
+}
+
+// Ack tells the node that the invoice received last was handled. Until
+// then, no further invoices are delivered and the invoice is not
+// remembered as seen, so it is delivered again after a restart.
+func (c *InvoicesClient) Ack() {
+	select {
+	case c.acks <- struct{}{}:
+	case <-c.cancelChan:
+	}
+}
+
+// invoiceFeed keeps the invoice clients and the connection state of a
+// node, and is embedded by all nodes that stream invoices
+type invoiceFeed struct {
+	logger             Logger
+	invoicesClients    map[uint32]*InvoicesClient
+	clientsMutex       sync.Mutex
+	nextInvoicesClient nextClient
+	onConnectionState  func(state string)
+	connectionState    string
+	stateMutex         sync.Mutex
+}
+
+func newInvoiceFeed(logger Logger, onConnectionState func(state string)) *invoiceFeed {
+	return &invoiceFeed{
+		logger:            logger,
+		invoicesClients:   make(map[uint32]*InvoicesClient),
+		onConnectionState: onConnectionState,
+		connectionState:   ConnectionStateDisconnected,
+	}
+}
+
+// run is run as a goroutine and keeps invoices flowing to all clients.
+// Whenever subscribe returns, it subscribes again with an exponential
+// backoff, which starts over with the shortest wait after a working
+// connection.
+func (f *invoiceFeed) run(quit chan struct{}, subscribe func(quit chan struct{}) error) {
+	backoff := minReconnectBackoff
+
+	for {
+		f.setConnectionState(ConnectionStateConnecting)
+
+		err := subscribe(quit)
+
+		if f.ConnectionState() == ConnectionStateConnected {
+			backoff = minReconnectBackoff
+		}
+
+		f.setConnectionState(ConnectionStateDisconnected)
+
+		select {
+		case <-quit:
+			f.logger.Infof("Stopping invoice listener")
+			return
+		default:
+		}
+
+		f.logger.Errorf("Lost invoice subscription, resubscribing in %v: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-quit:
+			f.logger.Infof("Stopping invoice listener")
+			return
+		}
+
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// ConnectionState tells if the invoice subscription is connected
+func (f *invoiceFeed) ConnectionState() string {
+	f.stateMutex.Lock()
+	defer f.stateMutex.Unlock()
+
+	return f.connectionState
+}
+
+// setConnectionState reports changes of the connection state
+func (f *invoiceFeed) setConnectionState(state string) {
+	f.stateMutex.Lock()
+
+	if f.connectionState == state {
+		f.stateMutex.Unlock()
+		return
+	}
+
+	f.connectionState = state
+	f.stateMutex.Unlock()
+
+	if f.onConnectionState != nil {
+		f.onConnectionState(state)
+	}
+}
+
+func (f *invoiceFeed) SubscribeInvoices() (*InvoicesClient, error) {
+	client := &InvoicesClient{
+		Invoices:   make(chan *Invoice),
+		cancelChan: make(chan struct{}),
+		acks:       make(chan struct{}),
+		feed:       f,
+	}
+
+	f.nextInvoicesClient.Lock()
+	client.Id = f.nextInvoicesClient.id
+	f.nextInvoicesClient.id++
+	f.nextInvoicesClient.Unlock()
+
+	f.clientsMutex.Lock()
+	f.invoicesClients[client.Id] = client
+	f.clientsMutex.Unlock()
+
+	return client, nil
+}
+
+// invoicesClientsList returns the currently subscribed clients
+func (f *invoiceFeed) invoicesClientsList() []*InvoicesClient {
+	f.clientsMutex.Lock()
+	defer f.clientsMutex.Unlock()
+
+	clients := make([]*InvoicesClient, 0, len(f.invoicesClients))
+	for _, client := range f.invoicesClients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// deliverInvoice sends an invoice to all clients and waits until they
+// acknowledged it, skipping clients that unsubscribe meanwhile
+func (f *invoiceFeed) deliverInvoice(invoice *Invoice) {
+	for _, client := range f.invoicesClientsList() {
+		select {
+		case client.Invoices <- invoice:
+		case <-client.cancelChan:
+			continue
+		}
+
+		select {
+		case <-client.acks:
+		case <-client.cancelChan:
+		}
+	}
+}
+
+func (f *invoiceFeed) closeAllInvoiceSubscriptions() {
+	for _, client := range f.invoicesClientsList() {
+		client.Cancel()
+	}
+}
+
+func (f *invoiceFeed) unsubscribeInvoices(client *InvoicesClient) {
+	f.clientsMutex.Lock()
+	defer f.clientsMutex.Unlock()
+
+	if _, ok := f.invoicesClients[client.Id]; !ok {
+		return
+	}
+
+	delete(f.invoicesClients, client.Id)
+	close(client.cancelChan)
 }
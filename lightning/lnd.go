@@ -6,11 +6,10 @@ import (
 	"encoding/hex"
 	"github.com/go-errors/errors"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
-	"io"
 	"sync"
 	"time"
 )
@@ -30,26 +29,37 @@ type LndNodeConfig struct {
 	CertBytes     []byte
 	MacaroonBytes []byte
 	Logger        Logger
+
+	// IndexStore optionally persists how far invoices were seen
+	IndexStore InvoiceIndexStore
+
+	// OnConnectionState is called whenever the connection state changes
+	OnConnectionState func(state string)
 }
 
 type LndNode struct {
-	uri                string
-	tlsCredentials     credentials.TransportCredentials
-	macaroonMetadata   metadata.MD
-	conn               *grpc.ClientConn
-	client             lnrpc.LightningClient
-	logger             Logger
-	invoicesClients    map[uint32]*InvoicesClient
-	nextInvoicesClient nextClient
+	*invoiceFeed
+	uri              string
+	tlsCredentials   credentials.TransportCredentials
+	macaroonMetadata metadata.MD
+	conn             *grpc.ClientConn
+	client           lnrpc.LightningClient
+	invoices         invoicesrpc.InvoicesClient
+	logger           Logger
+	indexStore       InvoiceIndexStore
+	quit             chan struct{}
 }
 
 // Compile time check for protocol compatibility
 var _ Node = (*LndNode)(nil)
+var _ HoldInvoiceNode = (*LndNode)(nil)
+var _ StatusNode = (*LndNode)(nil)
 
 func NewLndNode(config *LndNodeConfig) (*LndNode, error) {
 	node := &LndNode{
-		logger:          config.Logger,
-		invoicesClients: make(map[uint32]*InvoicesClient),
+		invoiceFeed: newInvoiceFeed(config.Logger, config.OnConnectionState),
+		logger:      config.Logger,
+		indexStore:  config.IndexStore,
 	}
 
 	if config.Uri != "" {
@@ -70,6 +80,89 @@ func NewLndNode(config *LndNodeConfig) (*LndNode, error) {
 	return node, nil
 }
 
+// unixTime converts a unix timestamp from lnd, where zero means unset
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
+
+// invoiceState converts the state of an lnd invoice
+func invoiceState(state lnrpc.Invoice_InvoiceState) string {
+	switch state {
+	case lnrpc.Invoice_SETTLED:
+		return InvoiceStateSettled
+	case lnrpc.Invoice_CANCELED:
+		return InvoiceStateCanceled
+	case lnrpc.Invoice_ACCEPTED:
+		return InvoiceStateAccepted
+	default:
+		return InvoiceStateOpen
+	}
+}
+
+// newInvoice converts an lnd invoice
+func newInvoice(invoice *lnrpc.Invoice) *Invoice {
+	return &Invoice{
+		RHash:          hex.EncodeToString(invoice.RHash),
+		PaymentRequest: invoice.PaymentRequest,
+		MSat:           invoice.Value * 1000,
+		AmtPaidMSat:    invoice.AmtPaidMsat,
+		Settled:        invoice.Settled,
+		Memo:           invoice.Memo,
+		CreationDate:   unixTime(invoice.CreationDate),
+		Expiry:         time.Duration(invoice.Expiry) * time.Second,
+		SettleDate:     unixTime(invoice.SettleDate),
+		State:          invoiceState(invoice.State),
+	}
+}
+
+// newInvoiceRequest converts an invoice request for lnd, which only
+// accepts whole satoshis
+func newInvoiceRequest(req *InvoiceRequest) (*lnrpc.Invoice, error) {
+	if req.MSat < 0 || req.MSat%1000 != 0 {
+		return nil, errors.Errorf("Invoice amount of %d msat is not a whole number of satoshis", req.MSat)
+	}
+
+	if req.Expiry < 0 {
+		return nil, errors.Errorf("Invoice expiry must not be negative, got %v", req.Expiry)
+	}
+
+	return &lnrpc.Invoice{
+		Memo:            req.Memo,
+		Value:           req.MSat / 1000,
+		Expiry:          int64(req.Expiry / time.Second),
+		DescriptionHash: req.DescriptionHash,
+		Private:         req.Private,
+		FallbackAddr:    req.FallbackAddr,
+	}, nil
+}
+
+// lookupAddedInvoice returns the invoice as lnd created it, falling back
+// to the request if it can not be looked up
+func (r *LndNode) lookupAddedInvoice(ctx context.Context, rHash []byte, paymentRequest string, req *lnrpc.Invoice) *Invoice {
+	invoice, err := r.client.LookupInvoice(ctx, &lnrpc.PaymentHash{
+		RHash: rHash,
+	})
+	if err == nil {
+		return newInvoice(invoice)
+	}
+
+	r.logger.Errorf("Could not look up added invoice %x: %v", rHash, err)
+
+	return &Invoice{
+		RHash:          hex.EncodeToString(rHash),
+		PaymentRequest: paymentRequest,
+		MSat:           req.Value * 1000,
+		Memo:           req.Memo,
+		CreationDate:   time.Now(),
+		Expiry:         time.Duration(req.Expiry) * time.Second,
+		State:          InvoiceStateOpen,
+	}
+}
+
 func (r *LndNode) setUri(uri string) {
 	r.uri = uri
 }
@@ -94,6 +187,10 @@ func (r *LndNode) setMacaroon(macaroonBytes []byte) {
 }
 
 func (r *LndNode) Start() error {
+	if r.quit != nil {
+		return nil
+	}
+
 	var err error
 	r.conn, err = grpc.Dial(r.uri, grpc.WithTransportCredentials(r.tlsCredentials))
 	if err != nil {
@@ -101,59 +198,116 @@ func (r *LndNode) Start() error {
 	}
 
 	r.client = lnrpc.NewLightningClient(r.conn)
+	r.invoices = invoicesrpc.NewInvoicesClient(r.conn)
+
+	r.quit = make(chan struct{})
 
-	go r.run()
+	go r.run(r.quit, r.subscribeInvoices)
 
 	return nil
 }
 
-func (r *LndNode) run() {
-	ctx := context.Background()
+// subscribeInvoices delivers invoices to all clients from the last seen
+// index on, until the stream breaks or the node is stopped
+func (r *LndNode) subscribeInvoices(quit chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
 
-	invoices, err := r.client.SubscribeInvoices(ctx, &lnrpc.InvoiceSubscription{})
+	// tear down the stream as soon as the node is stopped
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// streams only fail once they are read from, so the node is asked
+	// for its info first to know if it is reachable
+	_, err := r.client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return errors.Errorf("Node is unreachable: %v", err)
+	}
+
+	index := r.getInvoiceIndex()
+
+	invoices, err := r.client.SubscribeInvoices(ctx, &lnrpc.InvoiceSubscription{
+		AddIndex:    index.AddIndex,
+		SettleIndex: index.SettleIndex,
+	})
 	if err != nil {
-		r.logger.Errorf("Could not subscribe to invoices: %v", err)
-		return
+		return errors.Errorf("Could not subscribe to invoices: %v", err)
 	}
 
+	r.setConnectionState(ConnectionStateConnected)
+
+	r.logger.Infof("Subscribed to invoices from add index %d and settle index %d",
+		index.AddIndex, index.SettleIndex)
+
 	for {
 		invoice, err := invoices.Recv()
-		if err == io.EOF {
-			r.logger.Errorf("Got EOF from invoices stream: %v", err)
-			time.Sleep(1 * time.Second)
-			continue
+		if err != nil {
+			return errors.Errorf("Failed receiving invoices: %v", err)
 		}
 
-		if err != nil {
-			errStatus, ok := status.FromError(err)
-			if !ok {
-				r.logger.Errorf("Could not get status from err: %v", err)
-			}
+		r.deliverInvoice(newInvoice(invoice))
 
-			if errStatus.Code() == 1 {
-				r.logger.Infof("Stopping invoice listener")
-				break
-			} else if err != nil {
-				r.logger.Errorf("Failed receiving subscription items: %v", err)
-				break
-			}
-		}
+		// the index only advances once clients acknowledged the invoice,
+		// so it is delivered again after a crash
+		index = r.advanceInvoiceIndex(index, invoice)
+	}
+}
 
-		for _, client := range r.invoicesClients {
-			client.Invoices <- &Invoice{
-				RHash:          hex.EncodeToString(invoice.RHash),
-				PaymentRequest: invoice.PaymentRequest,
-				MSat:           invoice.Value,
-				Settled:        invoice.Settled,
-				Memo:           invoice.Memo,
-			}
-		}
+// getInvoiceIndex returns the persisted index, or zero to only receive
+// invoices that are added or settled from now on
+func (r *LndNode) getInvoiceIndex() InvoiceIndex {
+	if r.indexStore == nil {
+		return InvoiceIndex{}
+	}
+
+	index, err := r.indexStore.GetInvoiceIndex()
+	if err != nil {
+		r.logger.Errorf("Could not get invoice index: %v", err)
+		return InvoiceIndex{}
 	}
+
+	return index
+}
+
+// advanceInvoiceIndex persists the index of an invoice if it is newer than
+// the given index
+func (r *LndNode) advanceInvoiceIndex(index InvoiceIndex, invoice *lnrpc.Invoice) InvoiceIndex {
+	next := index
+
+	if invoice.AddIndex > next.AddIndex {
+		next.AddIndex = invoice.AddIndex
+	}
+
+	if invoice.SettleIndex > next.SettleIndex {
+		next.SettleIndex = invoice.SettleIndex
+	}
+
+	if next == index || r.indexStore == nil {
+		return next
+	}
+
+	err := r.indexStore.SetInvoiceIndex(next)
+	if err != nil {
+		r.logger.Errorf("Could not save invoice index: %v", err)
+	}
+
+	return next
 }
 
 func (r *LndNode) Stop() error {
-	if r.conn !=  nil {
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+
+	if r.conn != nil {
 		err := r.conn.Close()
 		if err != nil {
 			return errors.Errorf("Could not close connection: %v", err)
@@ -165,6 +319,51 @@ func (r *LndNode) Stop() error {
 	return nil
 }
 
+// GetStatus checks if the node is reachable, synced and has channels with
+// enough inbound liquidity to receive payments
+func (r *LndNode) GetStatus() (*NodeStatus, error) {
+	if r.client == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
+
+	info, err := r.client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return nil, errors.Errorf("Could not get info: %v", err)
+	}
+
+	balance, err := r.client.ChannelBalance(ctx, &lnrpc.ChannelBalanceRequest{})
+	if err != nil {
+		return nil, errors.Errorf("Could not get channel balance: %v", err)
+	}
+
+	channels, err := r.client.ListChannels(ctx, &lnrpc.ListChannelsRequest{
+		ActiveOnly: true,
+	})
+	if err != nil {
+		return nil, errors.Errorf("Could not list channels: %v", err)
+	}
+
+	status := &NodeStatus{
+		Reachable:      true,
+		SyncedToChain:  info.SyncedToChain,
+		BlockHeight:    info.BlockHeight,
+		ActiveChannels: info.NumActiveChannels,
+		BalanceMSat:    balance.Balance * 1000,
+		Checked:        time.Now(),
+	}
+
+	for _, channel := range channels.Channels {
+		status.InboundMSat += channel.RemoteBalance * 1000
+	}
+
+	return status, nil
+}
+
 func (r *LndNode) GetInvoice(rHash string) (*Invoice, error) {
 	if r.client == nil {
 		return nil, errors.Errorf("Node not started")
@@ -180,13 +379,7 @@ func (r *LndNode) GetInvoice(rHash string) (*Invoice, error) {
 		return nil, errors.Errorf("Could not find invoice: %v", err)
 	}
 
-	return &Invoice{
-		Settled:        res.Settled,
-		RHash:          hex.EncodeToString(res.RHash),
-		PaymentRequest: res.PaymentRequest,
-		Memo:           res.Memo,
-		MSat:           res.Value,
-	}, nil
+	return newInvoice(res), nil
 }
 
 func (r *LndNode) AddInvoice(req *InvoiceRequest) (*Invoice, error) {
@@ -197,49 +390,136 @@ func (r *LndNode) AddInvoice(req *InvoiceRequest) (*Invoice, error) {
 	ctx := context.Background()
 	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
 
-	res, err := r.client.AddInvoice(ctx, &lnrpc.Invoice{
-		Memo:  "Candy for 8 satoshis",
-		Value: 8,
-	})
+	invoice, err := newInvoiceRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.AddInvoice(ctx, invoice)
 	if err != nil {
 		return nil, errors.Errorf("Could not add invoice: %v", err)
 	}
 
-	return &Invoice{
-		Settled:        false,
-		RHash:          hex.EncodeToString(res.RHash),
-		PaymentRequest: res.PaymentRequest,
-		Memo:           req.Memo,
-		MSat:           req.MSat,
-	}, nil
+	return r.lookupAddedInvoice(ctx, res.RHash, res.PaymentRequest, invoice), nil
 }
 
-func (r *LndNode) SubscribeInvoices() (*InvoicesClient, error) {
-	client := &InvoicesClient{
-		Invoices:   make(chan *Invoice),
-		cancelChan: make(chan struct{}),
-		node:       r,
+func (r *LndNode) AddHoldInvoice(hash []byte, req *InvoiceRequest) (*Invoice, error) {
+	if r.invoices == nil {
+		return nil, errors.Errorf("Node not started")
 	}
 
-	r.nextInvoicesClient.Lock()
-	client.Id = r.nextInvoicesClient.id
-	r.nextInvoicesClient.id++
-	r.nextInvoicesClient.Unlock()
+	ctx := context.Background()
+	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
 
-	r.invoicesClients[client.Id] = client
+	invoice, err := newInvoiceRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
-	return client, nil
+	res, err := r.invoices.AddHoldInvoice(ctx, &invoicesrpc.AddHoldInvoiceRequest{
+		Hash:            hash,
+		Memo:            invoice.Memo,
+		Value:           invoice.Value,
+		Expiry:          invoice.Expiry,
+		DescriptionHash: invoice.DescriptionHash,
+		Private:         invoice.Private,
+		FallbackAddr:    invoice.FallbackAddr,
+	})
+	if err != nil {
+		return nil, errors.Errorf("Could not add hold invoice: %v", err)
+	}
+
+	return r.lookupAddedInvoice(ctx, hash, res.PaymentRequest, invoice), nil
 }
 
-func (r *LndNode) closeAllInvoiceSubscriptions() {
-	for _, client := range r.invoicesClients {
-		client.Cancel()
+func (r *LndNode) SubscribeSingleInvoice(rHash string) (*SingleInvoiceClient, error) {
+	if r.invoices == nil {
+		return nil, errors.Errorf("Node not started")
 	}
+
+	hash, err := hex.DecodeString(rHash)
+	if err != nil {
+		return nil, errors.Errorf("Invalid payment hash %s: %v", rHash, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
+
+	stream, err := r.invoices.SubscribeSingleInvoice(ctx, &invoicesrpc.SubscribeSingleInvoiceRequest{
+		RHash: hash,
+	})
+	if err != nil {
+		cancel()
+		return nil, errors.Errorf("Could not subscribe to invoice: %v", err)
+	}
+
+	invoices := make(chan *Invoice)
+
+	go func() {
+		defer close(invoices)
+
+		for {
+			invoice, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logger.Errorf("Failed receiving invoice updates: %v", err)
+				}
+				return
+			}
+
+			select {
+			case invoices <- newInvoice(invoice):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return &SingleInvoiceClient{
+		Invoices: invoices,
+		Cancel:   cancel,
+	}, nil
+}
+
+func (r *LndNode) SettleInvoice(preimage []byte) error {
+	if r.invoices == nil {
+		return errors.Errorf("Node not started")
+	}
+
+	ctx := context.Background()
+	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
+
+	_, err := r.invoices.SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{
+		Preimage: preimage,
+	})
+	if err != nil {
+		return errors.Errorf("Could not settle invoice: %v", err)
+	}
+
+	return nil
 }
 
-func (r *LndNode) unsubscribeInvoices(client *InvoicesClient) {
-	delete(r.invoicesClients, client.Id)
-	close(client.cancelChan)
+func (r *LndNode) CancelInvoice(rHash string) error {
+	if r.invoices == nil {
+		return errors.Errorf("Node not started")
+	}
+
+	hash, err := hex.DecodeString(rHash)
+	if err != nil {
+		return errors.Errorf("Invalid payment hash %s: %v", rHash, err)
+	}
+
+	ctx := context.Background()
+	ctx = metadata.NewOutgoingContext(ctx, r.macaroonMetadata)
+
+	_, err = r.invoices.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{
+		PaymentHash: hash,
+	})
+	if err != nil {
+		return errors.Errorf("Could not cancel invoice: %v", err)
+	}
+
+	return nil
 }
 
 func (r *LndNode) Create(walletPassword []byte, cipherSeedMnemonic []string, aezeedPassphrase []byte) error {
@@ -0,0 +1,499 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restMacaroonHeader carries the macaroon to lnd's REST proxy
+const restMacaroonHeader = "Grpc-Metadata-macaroon"
+
+type LndRestNodeConfig struct {
+	// Uri is the host and REST port of lnd, optionally with a scheme
+	Uri           string
+	CertBytes     []byte
+	MacaroonBytes []byte
+	Logger        Logger
+
+	// IndexStore optionally persists how far invoices were seen
+	IndexStore InvoiceIndexStore
+
+	// OnConnectionState is called whenever the connection state changes
+	OnConnectionState func(state string)
+}
+
+// LndRestNode talks to lnd through its REST proxy, for setups that do not
+// expose the gRPC port
+type LndRestNode struct {
+	*invoiceFeed
+	baseUrl    string
+	httpClient *http.Client
+	macaroon   string
+	logger     Logger
+	indexStore InvoiceIndexStore
+	quit       chan struct{}
+}
+
+// Compile time check for protocol compatibility
+var _ Node = (*LndRestNode)(nil)
+var _ StatusNode = (*LndRestNode)(nil)
+
+func NewLndRestNode(config *LndRestNodeConfig) (*LndRestNode, error) {
+	if config.Uri == "" {
+		return nil, errors.Errorf("No uri given")
+	}
+
+	baseUrl := strings.TrimSuffix(config.Uri, "/")
+	if !strings.HasPrefix(baseUrl, "https://") && !strings.HasPrefix(baseUrl, "http://") {
+		baseUrl = "https://" + baseUrl
+	}
+
+	parsedUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, errors.Errorf("Invalid uri %s: %v", config.Uri, err)
+	}
+
+	if parsedUrl.Host == "" {
+		return nil, errors.Errorf("Invalid uri %s: no host given", config.Uri)
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if config.CertBytes != nil {
+		cert := x509.NewCertPool()
+		fullCertBytes := append(beginCertificateBlock, config.CertBytes...)
+		fullCertBytes = append(fullCertBytes, endCertificateBlock...)
+
+		if ok := cert.AppendCertsFromPEM(fullCertBytes); !ok {
+			return nil, errors.Errorf("unable to set certificate: unable to append")
+		}
+
+		tlsConfig.RootCAs = cert
+	}
+
+	return &LndRestNode{
+		invoiceFeed: newInvoiceFeed(config.Logger, config.OnConnectionState),
+		baseUrl:     baseUrl,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		macaroon:   hex.EncodeToString(config.MacaroonBytes),
+		logger:     config.Logger,
+		indexStore: config.IndexStore,
+	}, nil
+}
+
+// restInvoice is an invoice as encoded by lnd's REST proxy, which quotes
+// 64 bit integers
+type restInvoice struct {
+	Memo           string `json:"memo"`
+	RHash          []byte `json:"r_hash"`
+	Value          int64  `json:"value,string"`
+	Settled        bool   `json:"settled"`
+	CreationDate   int64  `json:"creation_date,string"`
+	SettleDate     int64  `json:"settle_date,string"`
+	PaymentRequest string `json:"payment_request"`
+	Expiry         int64  `json:"expiry,string"`
+	AddIndex       uint64 `json:"add_index,string"`
+	SettleIndex    uint64 `json:"settle_index,string"`
+	AmtPaidMsat    int64  `json:"amt_paid_msat,string"`
+	State          string `json:"state"`
+}
+
+// rpcInvoice converts the invoice to its gRPC counterpart
+func (i *restInvoice) rpcInvoice() *lnrpc.Invoice {
+	invoice := &lnrpc.Invoice{
+		Memo:           i.Memo,
+		RHash:          i.RHash,
+		Value:          i.Value,
+		Settled:        i.Settled,
+		CreationDate:   i.CreationDate,
+		SettleDate:     i.SettleDate,
+		PaymentRequest: i.PaymentRequest,
+		Expiry:         i.Expiry,
+		AddIndex:       i.AddIndex,
+		SettleIndex:    i.SettleIndex,
+		AmtPaidMsat:    i.AmtPaidMsat,
+		State:          lnrpc.Invoice_OPEN,
+	}
+
+	switch i.State {
+	case "SETTLED":
+		invoice.State = lnrpc.Invoice_SETTLED
+	case "CANCELED":
+		invoice.State = lnrpc.Invoice_CANCELED
+	case "ACCEPTED":
+		invoice.State = lnrpc.Invoice_ACCEPTED
+	}
+
+	return invoice
+}
+
+type restAddInvoiceRequest struct {
+	Memo            string `json:"memo,omitempty"`
+	Value           int64  `json:"value,string"`
+	Expiry          int64  `json:"expiry,string,omitempty"`
+	DescriptionHash []byte `json:"description_hash,omitempty"`
+	Private         bool   `json:"private,omitempty"`
+	FallbackAddr    string `json:"fallback_addr,omitempty"`
+}
+
+type restAddInvoiceResponse struct {
+	RHash          []byte `json:"r_hash"`
+	PaymentRequest string `json:"payment_request"`
+	AddIndex       uint64 `json:"add_index,string"`
+}
+
+type restGetInfoResponse struct {
+	BlockHeight       uint32 `json:"block_height"`
+	NumActiveChannels uint32 `json:"num_active_channels"`
+	SyncedToChain     bool   `json:"synced_to_chain"`
+}
+
+type restChannelBalanceResponse struct {
+	Balance int64 `json:"balance,string"`
+}
+
+type restListChannelsResponse struct {
+	Channels []struct {
+		RemoteBalance int64 `json:"remote_balance,string"`
+	} `json:"channels"`
+}
+
+// restError is how lnd's REST proxy reports a failed call
+type restError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// restStreamMessage is a single message of a streaming call
+type restStreamMessage struct {
+	Result *restInvoice `json:"result"`
+	Error  *restError   `json:"error"`
+}
+
+// do sends a request to the REST proxy and returns the response if it
+// succeeded
+func (r *LndRestNode) do(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Errorf("Could not encode request: %v", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, r.baseUrl+path, reader)
+	if err != nil {
+		return nil, errors.Errorf("Could not create request: %v", err)
+	}
+
+	req = req.WithContext(ctx)
+
+	if r.macaroon != "" {
+		req.Header.Set(restMacaroonHeader, r.macaroon)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+
+		restErr := restError{}
+
+		data, _ := ioutil.ReadAll(res.Body)
+		if json.Unmarshal(data, &restErr) == nil && restErr.Error != "" {
+			return nil, errors.Errorf("%s", restErr.Error)
+		}
+
+		return nil, errors.Errorf("%s %s failed with status %d", method, path, res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// call sends a request to the REST proxy and decodes its response
+func (r *LndRestNode) call(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	res, err := r.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err != nil {
+		return errors.Errorf("Could not decode response: %v", err)
+	}
+
+	return nil
+}
+
+func (r *LndRestNode) Start() error {
+	if r.quit != nil {
+		return nil
+	}
+
+	r.quit = make(chan struct{})
+
+	go r.run(r.quit, r.subscribeInvoices)
+
+	return nil
+}
+
+func (r *LndRestNode) Stop() error {
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+
+	r.closeAllInvoiceSubscriptions()
+
+	return nil
+}
+
+// subscribeInvoices delivers invoices to all clients from the last seen
+// index on, until the stream breaks or the node is stopped
+func (r *LndRestNode) subscribeInvoices(quit chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// tear down the stream as soon as the node is stopped
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := r.call(ctx, http.MethodGet, "/v1/getinfo", nil, &restGetInfoResponse{})
+	if err != nil {
+		return errors.Errorf("Node is unreachable: %v", err)
+	}
+
+	index := r.getInvoiceIndex()
+
+	query := url.Values{}
+	query.Set("add_index", strconv.FormatUint(index.AddIndex, 10))
+	query.Set("settle_index", strconv.FormatUint(index.SettleIndex, 10))
+
+	res, err := r.do(ctx, http.MethodGet, "/v1/invoices/subscribe?"+query.Encode(), nil)
+	if err != nil {
+		return errors.Errorf("Could not subscribe to invoices: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	r.setConnectionState(ConnectionStateConnected)
+
+	r.logger.Infof("Subscribed to invoices from add index %d and settle index %d",
+		index.AddIndex, index.SettleIndex)
+
+	decoder := json.NewDecoder(res.Body)
+
+	for {
+		message := restStreamMessage{}
+
+		err := decoder.Decode(&message)
+		if err != nil {
+			return errors.Errorf("Failed receiving invoices: %v", err)
+		}
+
+		if message.Error != nil {
+			return errors.Errorf("Failed receiving invoices: %s", message.Error.Message)
+		}
+
+		if message.Result == nil {
+			continue
+		}
+
+		invoice := message.Result.rpcInvoice()
+
+		r.deliverInvoice(newInvoice(invoice))
+
+		// the index only advances once clients acknowledged the invoice,
+		// so it is delivered again after a crash
+		index = r.advanceInvoiceIndex(index, invoice)
+	}
+}
+
+// getInvoiceIndex returns the persisted index, or zero to only receive
+// invoices that are added or settled from now on
+func (r *LndRestNode) getInvoiceIndex() InvoiceIndex {
+	if r.indexStore == nil {
+		return InvoiceIndex{}
+	}
+
+	index, err := r.indexStore.GetInvoiceIndex()
+	if err != nil {
+		r.logger.Errorf("Could not get invoice index: %v", err)
+		return InvoiceIndex{}
+	}
+
+	return index
+}
+
+// advanceInvoiceIndex persists the index of an invoice if it is newer than
+// the given index
+func (r *LndRestNode) advanceInvoiceIndex(index InvoiceIndex, invoice *lnrpc.Invoice) InvoiceIndex {
+	next := index
+
+	if invoice.AddIndex > next.AddIndex {
+		next.AddIndex = invoice.AddIndex
+	}
+
+	if invoice.SettleIndex > next.SettleIndex {
+		next.SettleIndex = invoice.SettleIndex
+	}
+
+	if next == index || r.indexStore == nil {
+		return next
+	}
+
+	err := r.indexStore.SetInvoiceIndex(next)
+	if err != nil {
+		r.logger.Errorf("Could not save invoice index: %v", err)
+	}
+
+	return next
+}
+
+// lookupInvoice finds an invoice by its hex encoded payment hash
+func (r *LndRestNode) lookupInvoice(ctx context.Context, rHash string) (*lnrpc.Invoice, error) {
+	invoice := restInvoice{}
+
+	err := r.call(ctx, http.MethodGet, "/v1/invoice/"+url.PathEscape(rHash), nil, &invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoice.rpcInvoice(), nil
+}
+
+func (r *LndRestNode) GetInvoice(rHash string) (*Invoice, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	invoice, err := r.lookupInvoice(context.Background(), rHash)
+	if err != nil {
+		return nil, errors.Errorf("Could not find invoice: %v", err)
+	}
+
+	return newInvoice(invoice), nil
+}
+
+func (r *LndRestNode) AddInvoice(req *InvoiceRequest) (*Invoice, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	invoice, err := newInvoiceRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	res := restAddInvoiceResponse{}
+
+	err = r.call(ctx, http.MethodPost, "/v1/invoices", &restAddInvoiceRequest{
+		Memo:            invoice.Memo,
+		Value:           invoice.Value,
+		Expiry:          invoice.Expiry,
+		DescriptionHash: invoice.DescriptionHash,
+		Private:         invoice.Private,
+		FallbackAddr:    invoice.FallbackAddr,
+	}, &res)
+	if err != nil {
+		return nil, errors.Errorf("Could not add invoice: %v", err)
+	}
+
+	added, err := r.lookupInvoice(ctx, hex.EncodeToString(res.RHash))
+	if err == nil {
+		return newInvoice(added), nil
+	}
+
+	r.logger.Errorf("Could not look up added invoice %x: %v", res.RHash, err)
+
+	return &Invoice{
+		RHash:          hex.EncodeToString(res.RHash),
+		PaymentRequest: res.PaymentRequest,
+		MSat:           invoice.Value * 1000,
+		Memo:           invoice.Memo,
+		CreationDate:   time.Now(),
+		Expiry:         time.Duration(invoice.Expiry) * time.Second,
+		State:          InvoiceStateOpen,
+	}, nil
+}
+
+// GetStatus checks if the node is reachable, synced and has channels with
+// enough inbound liquidity to receive payments
+func (r *LndRestNode) GetStatus() (*NodeStatus, error) {
+	if r.quit == nil {
+		return nil, errors.Errorf("Node not started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	info := restGetInfoResponse{}
+
+	err := r.call(ctx, http.MethodGet, "/v1/getinfo", nil, &info)
+	if err != nil {
+		return nil, errors.Errorf("Could not get info: %v", err)
+	}
+
+	balance := restChannelBalanceResponse{}
+
+	err = r.call(ctx, http.MethodGet, "/v1/balance/channels", nil, &balance)
+	if err != nil {
+		return nil, errors.Errorf("Could not get channel balance: %v", err)
+	}
+
+	channels := restListChannelsResponse{}
+
+	err = r.call(ctx, http.MethodGet, "/v1/channels?active_only=true", nil, &channels)
+	if err != nil {
+		return nil, errors.Errorf("Could not list channels: %v", err)
+	}
+
+	status := &NodeStatus{
+		Reachable:      true,
+		SyncedToChain:  info.SyncedToChain,
+		BlockHeight:    info.BlockHeight,
+		ActiveChannels: info.NumActiveChannels,
+		BalanceMSat:    balance.Balance * 1000,
+		Checked:        time.Now(),
+	}
+
+	for _, channel := range channels.Channels {
+		status.InboundMSat += channel.RemoteBalance * 1000
+	}
+
+	return status, nil
+}
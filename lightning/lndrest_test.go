@@ -0,0 +1,231 @@
+package lightning
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var (
+	testMacaroon = []byte{0x02, 0x01, 0xff}
+	testRHash    = []byte{0xde, 0xad, 0xbe, 0xef}
+)
+
+// restTestInvoice is an invoice as lnd's REST proxy encodes it
+func restTestInvoice(settleIndex uint64, state string) map[string]interface{} {
+	return map[string]interface{}{
+		"memo":            "Candy",
+		"r_hash":          testRHash,
+		"value":           "2",
+		"settled":         state == "SETTLED",
+		"creation_date":   "1500000000",
+		"payment_request": "lnbc1",
+		"expiry":          "600",
+		"add_index":       "7",
+		"settle_index":    fmt.Sprint(settleIndex),
+		"amt_paid_msat":   "2000",
+		"state":           state,
+	}
+}
+
+// newRestTestServer serves the given handlers and rejects requests
+// without the test macaroon
+func newRestTestServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Grpc-Metadata-macaroon") != hex.EncodeToString(testMacaroon) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "verification failed: signature mismatch after caveat verification",
+				"code":  2,
+			})
+			return
+		}
+
+		handler, ok := handlers[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		handler(w, r)
+	}))
+}
+
+func startLndRestNode(t *testing.T, server *httptest.Server, macaroon []byte, store InvoiceIndexStore) (*LndRestNode, *InvoicesClient) {
+	node, err := NewLndRestNode(&LndRestNodeConfig{
+		Uri:           server.URL,
+		MacaroonBytes: macaroon,
+		Logger:        noopLogger{},
+		IndexStore:    store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := node.SubscribeInvoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = node.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return node, client
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	json.NewEncoder(w).Encode(value)
+}
+
+func TestNewLndRestNodeValidatesUri(t *testing.T) {
+	for _, uri := range []string{"", "https:///v1", "http://%zz"} {
+		_, err := NewLndRestNode(&LndRestNodeConfig{Uri: uri})
+		if err == nil {
+			t.Errorf("expected uri %q to be rejected", uri)
+		}
+	}
+
+	node, err := NewLndRestNode(&LndRestNodeConfig{Uri: "mynode.local:8080/"})
+	if err != nil {
+		t.Fatalf("unable to create node: %v", err)
+	}
+
+	if node.baseUrl != "https://mynode.local:8080" {
+		t.Errorf("unexpected base url %s", node.baseUrl)
+	}
+}
+
+func TestLndRestAddInvoice(t *testing.T) {
+	var added restAddInvoiceRequest
+
+	server := newRestTestServer(t, map[string]http.HandlerFunc{
+		"GET /v1/getinfo": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{})
+		},
+		"GET /v1/invoices/subscribe": func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		},
+		"POST /v1/invoices": func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewDecoder(r.Body).Decode(&added)
+			if err != nil {
+				t.Errorf("unable to decode request: %v", err)
+			}
+
+			writeJSON(w, map[string]interface{}{
+				"r_hash":          testRHash,
+				"payment_request": "lnbc1",
+				"add_index":       "7",
+			})
+		},
+		"GET /v1/invoice/" + hex.EncodeToString(testRHash): func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, restTestInvoice(0, "OPEN"))
+		},
+	})
+	defer server.Close()
+
+	node, _ := startLndRestNode(t, server, testMacaroon, nil)
+	defer node.Stop()
+
+	invoice, err := node.AddInvoice(&InvoiceRequest{
+		Memo:   "Candy",
+		MSat:   2000,
+		Expiry: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	if added.Memo != "Candy" || added.Value != 2 || added.Expiry != 600 {
+		t.Errorf("unexpected request %+v", added)
+	}
+
+	if invoice.RHash != hex.EncodeToString(testRHash) {
+		t.Errorf("unexpected hash %s", invoice.RHash)
+	}
+	if invoice.MSat != 2000 || invoice.Memo != "Candy" || invoice.PaymentRequest != "lnbc1" {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+	if invoice.Expiry != 10*time.Minute || invoice.State != InvoiceStateOpen {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+
+	invoice, err = node.GetInvoice(hex.EncodeToString(testRHash))
+	if err != nil {
+		t.Fatalf("unable to get invoice: %v", err)
+	}
+
+	if invoice.Memo != "Candy" || invoice.CreationDate.Unix() != 1500000000 {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+}
+
+func TestLndRestRejectedMacaroon(t *testing.T) {
+	server := newRestTestServer(t, map[string]http.HandlerFunc{})
+	defer server.Close()
+
+	node, _ := startLndRestNode(t, server, []byte{0x00}, nil)
+	defer node.Stop()
+
+	_, err := node.GetInvoice(hex.EncodeToString(testRHash))
+	if err == nil {
+		t.Fatalf("expected a wrong macaroon to be rejected")
+	}
+}
+
+func TestLndRestSubscribeInvoices(t *testing.T) {
+	subscribed := make(chan string, 1)
+
+	server := newRestTestServer(t, map[string]http.HandlerFunc{
+		"GET /v1/getinfo": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{})
+		},
+		"GET /v1/invoices/subscribe": func(w http.ResponseWriter, r *http.Request) {
+			subscribed <- r.URL.RawQuery
+
+			// the proxy streams one object per line
+			writeJSON(w, map[string]interface{}{"result": restTestInvoice(3, "SETTLED")})
+			w.(http.Flusher).Flush()
+
+			writeJSON(w, map[string]interface{}{"result": restTestInvoice(4, "SETTLED")})
+			w.(http.Flusher).Flush()
+
+			<-r.Context().Done()
+		},
+	})
+	defer server.Close()
+
+	store := &memoryIndexStore{index: InvoiceIndex{AddIndex: 5, SettleIndex: 2}}
+
+	node, client := startLndRestNode(t, server, testMacaroon, store)
+	defer node.Stop()
+
+	select {
+	case query := <-subscribed:
+		if query != "add_index=5&settle_index=2" {
+			t.Errorf("expected to resume from the stored index, got %s", query)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for subscription")
+	}
+
+	for i := 0; i < 2; i++ {
+		invoice := receiveInvoice(t, client)
+
+		if !invoice.Settled || invoice.State != InvoiceStateSettled || invoice.AmtPaidMSat != 2000 {
+			t.Errorf("unexpected invoice %+v", invoice)
+		}
+	}
+
+	// the index advances once the next invoice is received
+	index, _ := store.GetInvoiceIndex()
+	if index.AddIndex != 7 || index.SettleIndex < 3 {
+		t.Errorf("expected index to advance, got %+v", index)
+	}
+}
@@ -10,8 +10,10 @@ import (
 //var sizeRegexp = regexp.MustCompile("BTCN: Verified 17000 filter headers in the last 10.13s (height 284001, 2014-02-03 20:51:30 +0100 CET)")
 
 type LocalNodeConfig struct {
-	DataDir string
-	Logger  Logger
+	DataDir           string
+	Logger            Logger
+	IndexStore        InvoiceIndexStore
+	OnConnectionState func(state string)
 }
 
 type LocalNode struct {
@@ -45,7 +47,9 @@ func NewLocalNode(config *LocalNodeConfig) (*LocalNode, error) {
 	log.Infof("using lnd version %s", version)
 
 	lndNode, err := NewLndNode(&LndNodeConfig{
-		Logger: log,
+		Logger:            log,
+		IndexStore:        config.IndexStore,
+		OnConnectionState: config.OnConnectionState,
 	})
 	if err != nil {
 		return nil, errors.Errorf("unable to create lnd node: %v", err)
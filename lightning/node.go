@@ -1,16 +1,47 @@
 package lightning
 
+import "time"
+
+const (
+	InvoiceStateOpen     = "open"
+	InvoiceStateSettled  = "settled"
+	InvoiceStateCanceled = "canceled"
+	InvoiceStateAccepted = "accepted"
+)
+
 type Invoice struct {
 	RHash          string
 	PaymentRequest string
 	Settled        bool
 	MSat           int64
+	AmtPaidMSat    int64
 	Memo           string
+	CreationDate   time.Time
+	Expiry         time.Duration
+	SettleDate     time.Time
+	State          string
 }
 
 type InvoiceRequest struct {
+	// MSat is the amount of the invoice, or zero for any amount
 	MSat int64
+
+	// Memo is shown to the payer, unless a description hash is given
 	Memo string
+
+	// Expiry is how long the invoice can be paid, or zero for the
+	// default of the node
+	Expiry time.Duration
+
+	// DescriptionHash commits to a description that is too long for
+	// the memo
+	DescriptionHash []byte
+
+	// Private includes route hints for private channels
+	Private bool
+
+	// FallbackAddr is an on-chain address the payer may pay to instead
+	FallbackAddr string
 }
 
 type Node interface {
@@ -0,0 +1,42 @@
+package lightning
+
+import "time"
+
+// NodeStatus tells if a node is able to receive payments right now
+type NodeStatus struct {
+	// Reachable tells if the node answered the last check
+	Reachable bool
+
+	// SyncedToChain tells if the node caught up with the chain
+	SyncedToChain bool
+
+	// BlockHeight is the height of the best block the node knows of
+	BlockHeight uint32
+
+	// ActiveChannels is the number of channels that can route payments
+	ActiveChannels uint32
+
+	// InboundMSat is how much the node can receive over its active channels
+	InboundMSat int64
+
+	// BalanceMSat is how much the node holds in its channels
+	BalanceMSat int64
+
+	// LastError is the reason the last failed check failed
+	LastError string
+
+	// LastErrorAt is when the last failed check failed
+	LastErrorAt time.Time
+
+	// Checked is when the node was last checked
+	Checked time.Time
+
+	// ConnectionState tells if the invoice subscription is connected
+	ConnectionState string
+}
+
+// StatusNode is a node that can be checked for its ability to receive
+// payments
+type StatusNode interface {
+	GetStatus() (*NodeStatus, error)
+}
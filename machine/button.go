@@ -0,0 +1,60 @@
+package machine
+
+import "time"
+
+// ButtonPress is a gesture performed on the service button
+type ButtonPress uint8
+
+const (
+	ButtonPressShort ButtonPress = iota
+	ButtonPressLong
+	ButtonPressVeryLong
+)
+
+const (
+	// buttonDebounce is the least time the button has to be held for a press
+	buttonDebounce = 50 * time.Millisecond
+
+	// longPressDuration is the least time the button is held for a long press
+	longPressDuration = 2 * time.Second
+
+	// veryLongPressDuration is the least time the button is held for a very
+	// long press
+	veryLongPressDuration = 10 * time.Second
+)
+
+func (p ButtonPress) String() string {
+	switch p {
+	case ButtonPressShort:
+		return "short"
+	case ButtonPressLong:
+		return "long"
+	case ButtonPressVeryLong:
+		return "very long"
+	default:
+		return "unknown"
+	}
+}
+
+// classifyPress determines the gesture of a press held for the given time
+func classifyPress(held time.Duration) ButtonPress {
+	switch {
+	case held >= veryLongPressDuration:
+		return ButtonPressVeryLong
+	case held >= longPressDuration:
+		return ButtonPressLong
+	default:
+		return ButtonPressShort
+	}
+}
+
+type ButtonClient struct {
+	Presses    chan ButtonPress
+	Id         uint32
+	cancelChan chan struct{}
+	machine    Machine
+}
+
+func (c *ButtonClient) Cancel() {
+	c.machine.unsubscribeButton(c)
+}
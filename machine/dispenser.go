@@ -1,30 +1,55 @@
 package machine
 
 import (
+	"github.com/go-errors/errors"
 	log "github.com/sirupsen/logrus"
-	"periph.io/x/periph/conn/gpio"
-	"periph.io/x/periph/conn/gpio/gpioreg"
+	"math"
+	"periph.io/x/periph/conn/physic"
 	"periph.io/x/periph/host"
 	"sync"
 	"time"
 )
 
+const (
+	// motorPwmFrequency is the frequency the motor pin is modulated with
+	motorPwmFrequency = 1 * physic.KiloHertz
+
+	// motorRampInterval is the time between speed changes while ramping
+	motorRampInterval = 20 * time.Millisecond
+)
+
 type DispenserMachine struct {
-	touchPin          string
-	motorPin          string
-	buzzerPin         string
-	motorEvents       chan bool      // Internal motor events channel
-	buzzerEvents      chan bool      // Internal buzzer events channel
-	done              chan bool      // Internal done channel
-	waitGroup         sync.WaitGroup // Internal goroutine WaitGroup
+	profile           *HardwareProfile
+	touchDebounce     time.Duration
+	touchPin          *profilePin
+	buttonPin         *profilePin
+	motorPins         map[int]*profilePin
+	buzzerPin         *profilePin
+	ledPin            *profilePin
+	ledRedPin         *profilePin
+	ledGreenPin       *profilePin
+	ledBluePin        *profilePin
+	motorEvents       map[int]chan MotorCommand // Internal motor events channels by compartment
+	buzzerEvents      chan bool                 // Internal buzzer events channel
+	ledEvents         chan LedStatus            // Internal led events channel
+	done              chan bool                 // Internal done channel
+	waitGroup         sync.WaitGroup            // Internal goroutine WaitGroup
 	touchesClients    map[uint32]*TouchesClient
 	nextTouchesClient nextTouchesClient
+	buttonClients     map[uint32]*ButtonClient
+	nextButtonClient  nextTouchesClient
+	player            *patternPlayer
+	ledMutex          sync.Mutex
+	led               LedStatus // Last requested led status
 }
 
 type DispenserMachineConfig struct {
-	TouchPin  string
-	MotorPin  string
-	BuzzerPin string
+	// Profile describes the wiring of all inputs and outputs
+	Profile *HardwareProfile
+
+	// TouchDebounce is the least time the touch sensor has to be touched
+	// before a touch is reported, defaulting to DefaultTouchDebounce
+	TouchDebounce time.Duration
 }
 
 // Compile time check for protocol compatibility
@@ -32,15 +57,27 @@ var _ Machine = (*DispenserMachine)(nil)
 
 func NewDispenserMachine(config *DispenserMachineConfig) *DispenserMachine {
 	m := &DispenserMachine{
-		touchPin:          config.TouchPin,
-		motorPin:          config.MotorPin,
-		buzzerPin:         config.BuzzerPin,
-		motorEvents:       make(chan bool),
+		profile:           config.Profile,
+		touchDebounce:     config.TouchDebounce,
+		motorEvents:       make(map[int]chan MotorCommand),
 		buzzerEvents:      make(chan bool),
+		ledEvents:         make(chan LedStatus),
 		touchesClients:    make(map[uint32]*TouchesClient),
 		nextTouchesClient: nextTouchesClient{id: 0},
+		buttonClients:     make(map[uint32]*ButtonClient),
+		nextButtonClient:  nextTouchesClient{id: 0},
+	}
+
+	for _, compartment := range m.profile.Compartments() {
+		m.motorEvents[compartment] = make(chan MotorCommand)
 	}
 
+	if m.touchDebounce <= 0 {
+		m.touchDebounce = DefaultTouchDebounce
+	}
+
+	m.player = newPatternPlayer(m.ToggleBuzzer)
+
 	return m
 }
 
@@ -49,14 +86,55 @@ func (m *DispenserMachine) Start() error {
 		return err
 	}
 
+	err := m.openPins()
+	if err != nil {
+		return err
+	}
+
 	m.done = make(chan bool)
 
-	var waitGroup sync.WaitGroup
-	m.waitGroup = waitGroup
+	m.waitGroup = sync.WaitGroup{}
 
 	go m.handleTouch()
-	go m.driveMotor()
+	go m.handleButton()
+	for compartment, p := range m.motorPins {
+		go m.driveMotor(compartment, p, m.motorEvents[compartment])
+	}
+
 	go m.driveBuzzer()
+	go m.driveLed()
+
+	return nil
+}
+
+// openPins looks up all pins of the hardware profile
+func (m *DispenserMachine) openPins() error {
+	err := m.profile.Validate()
+	if err != nil {
+		return errors.Errorf("Invalid hardware profile %s: %v", m.profile.Name, err)
+	}
+
+	pins := map[string]**profilePin{
+		RoleTouch:    &m.touchPin,
+		RoleButton:   &m.buttonPin,
+		RoleBuzzer:   &m.buzzerPin,
+		RoleLed:      &m.ledPin,
+		RoleLedRed:   &m.ledRedPin,
+		RoleLedGreen: &m.ledGreenPin,
+		RoleLedBlue:  &m.ledBluePin,
+	}
+
+	for role, pin := range pins {
+		*pin, err = openPin(m.profile, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.motorPins, err = openMotorPins(m.profile)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -74,9 +152,21 @@ func (m *DispenserMachine) Stop() error {
 	return nil
 }
 
-func (m *DispenserMachine) ToggleMotor(on bool) {
-	log.Infof("Toggling motor %v", on)
-	m.motorEvents <- on
+// Compartments returns the ids of all compartments that have a motor
+func (m *DispenserMachine) Compartments() []int {
+	return m.profile.Compartments()
+}
+
+func (m *DispenserMachine) DriveMotor(command MotorCommand) {
+	log.Infof("Driving motor %+v", command)
+
+	events, ok := m.motorEvents[command.Compartment]
+	if !ok {
+		log.Errorf("Compartment %d has no motor", command.Compartment)
+		return
+	}
+
+	events <- command
 }
 
 func (m *DispenserMachine) ToggleBuzzer(on bool) {
@@ -90,10 +180,10 @@ func (m *DispenserMachine) handleTouch() {
 	m.waitGroup.Add(1)
 	defer m.waitGroup.Done()
 
-	p := gpioreg.ByName(m.touchPin)
+	p := m.touchPin
 
-	// set as input, with an internal pull down resistor
-	if err := p.In(gpio.PullDown, gpio.BothEdges); err != nil {
+	// set as input, with the internal resistor of the profile
+	if err := p.in(); err != nil {
 		log.Fatal(err)
 	}
 
@@ -111,10 +201,10 @@ func (m *DispenserMachine) handleTouch() {
 		for {
 			p.WaitForEdge(-1)
 
-			if p.Read() == gpio.High {
+			if p.isActive() {
 				if notifyAfterThrottledTime.IsZero() {
 					// just save time for throttling
-					notifyAfterThrottledTime = time.Now().Add(2 * time.Millisecond)
+					notifyAfterThrottledTime = time.Now().Add(m.touchDebounce)
 				} else if !hasSentHigh && time.Now().After(notifyAfterThrottledTime) {
 					// send throttled touch start
 					edges <- true
@@ -149,37 +239,138 @@ func (m *DispenserMachine) handleTouch() {
 			return
 		}
 	}
+}
 
-	log.Debug("Leaving handleTouch goroutine")
+func (m *DispenserMachine) handleButton() {
+	if m.buttonPin == nil {
+		return
+	}
+
+	log.Info("Starting to handle button events")
+
+	m.waitGroup.Add(1)
+	defer m.waitGroup.Done()
+
+	p := m.buttonPin
+
+	// set as input, with the internal resistor of the profile
+	if err := p.in(); err != nil {
+		log.Errorf("Could not read service button: %v", err)
+		return
+	}
+
+	// Turn blocking WaitForEdge() func into channel
+	presses := make(chan ButtonPress)
+	go func() {
+		// TODO: Stop this goroutine on done signal
+
+		var pressed time.Time
+
+		for {
+			p.WaitForEdge(-1)
+
+			if p.isActive() {
+				if pressed.IsZero() {
+					pressed = time.Now()
+				}
+			} else if !pressed.IsZero() {
+				held := time.Since(pressed)
+				pressed = time.Time{}
+
+				// ignore bouncing contacts
+				if held >= buttonDebounce {
+					presses <- classifyPress(held)
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case press := <-presses:
+			log.WithField("pin", "button").WithField("press", press).Info("Received button press")
+			m.notifyButtonClients(press)
+		case <-m.done:
+			log.Info("Got done event in handleButton")
+
+			return
+		}
+	}
 }
 
-func (m *DispenserMachine) driveMotor() {
-	log.Info("Starting to handle motor events")
+func (m *DispenserMachine) driveMotor(compartment int, p *profilePin, motorEvents <-chan MotorCommand) {
+	log.Infof("Starting to handle motor events of compartment %d", compartment)
 
 	m.waitGroup.Add(1)
 	defer m.waitGroup.Done()
 
-	p := gpioreg.ByName(m.motorPin)
+	ticker := time.NewTicker(motorRampInterval)
+	defer ticker.Stop()
+
+	// ticks is only set while the motor ramps up or down
+	var ticks <-chan time.Time
+
+	speed := 0.0
+	target := 0.0
+	step := 0.0
 
 	for {
 		select {
-		case on := <-m.motorEvents:
-			log.WithField("pin", "motor").WithField("on", on).Info("Received motor event")
+		case command := <-motorEvents:
+			log.WithField("pin", "motor").WithField("compartment", compartment).WithField("on", command.On).Info("Received motor event")
 
-			if on {
-				p.Out(gpio.High)
+			var ramp time.Duration
+			target, ramp = command.targetSpeed()
+
+			if ramp < motorRampInterval {
+				speed = target
+				m.setMotorSpeed(p, speed)
+				ticks = nil
+				continue
+			}
+
+			step = math.Abs(target-speed) / float64(ramp/motorRampInterval)
+			ticks = ticker.C
+		case <-ticks:
+			if speed < target {
+				speed = math.Min(speed+step, target)
 			} else {
-				p.Out(gpio.Low)
+				speed = math.Max(speed-step, target)
+			}
+
+			m.setMotorSpeed(p, speed)
+
+			if speed == target {
+				ticks = nil
 			}
 		case <-m.done:
 			log.Info("Got done event in driveMotor")
 
-			p.Out(gpio.Low)
+			p.set(false)
 			return
 		}
 	}
+}
 
-	log.Debug("Leaving driveMotor goroutine")
+// setMotorSpeed drives the motor pin with the given duty cycle, and falls
+// back to full speed on pins that are not capable of PWM
+func (m *DispenserMachine) setMotorSpeed(p *profilePin, speed float64) {
+	if speed <= 0 {
+		p.set(false)
+		return
+	}
+
+	// pins without PWM run at full speed
+	if speed >= 1 || !p.profile.PWM {
+		p.set(true)
+		return
+	}
+
+	err := p.setDuty(speed)
+	if err != nil {
+		log.WithField("pin", "motor").Warnf("Could not set motor speed, running at full speed: %v", err)
+		p.set(true)
+	}
 }
 
 func (m *DispenserMachine) driveBuzzer() {
@@ -188,37 +379,108 @@ func (m *DispenserMachine) driveBuzzer() {
 	m.waitGroup.Add(1)
 	defer m.waitGroup.Done()
 
-	p := gpioreg.ByName(m.buzzerPin)
+	p := m.buzzerPin
 
 	for {
 		select {
 		case on := <-m.buzzerEvents:
 			log.WithField("pin", "buzzer").WithField("on", on).Info("Received buzzer event")
 
-			if on {
-				p.Out(gpio.High)
+			p.set(on)
+		case <-m.done:
+			log.Info("Got done event in driveBuzzer")
+
+			p.set(false)
+			return
+		}
+	}
+}
+
+// showColor lights up the configured status LED pins
+func showColor(single *profilePin, rgb [3]*profilePin, color Color) {
+	levels := [3]bool{color.Red, color.Green, color.Blue}
+
+	for i, p := range rgb {
+		if p != nil {
+			p.set(levels[i])
+		}
+	}
+
+	if single != nil {
+		single.set(color != ColorOff)
+	}
+}
+
+func (m *DispenserMachine) driveLed() {
+	log.Info("Starting to handle led events")
+
+	m.waitGroup.Add(1)
+	defer m.waitGroup.Done()
+
+	single := m.ledPin
+	rgb := [3]*profilePin{m.ledRedPin, m.ledGreenPin, m.ledBluePin}
+
+	var ticker *time.Ticker
+
+	// ticks is only set while the led blinks
+	var ticks <-chan time.Time
+
+	status := LedStatus{}
+	lit := false
+
+	for {
+		select {
+		case status = <-m.ledEvents:
+			log.WithField("pin", "led").WithField("status", status).Debug("Received led event")
+
+			if ticker != nil {
+				ticker.Stop()
+				ticker = nil
+				ticks = nil
+			}
+
+			if interval := status.Blink.interval(); interval > 0 {
+				ticker = time.NewTicker(interval)
+				ticks = ticker.C
+			}
+
+			lit = true
+			showColor(single, rgb, status.Color)
+		case <-ticks:
+			lit = !lit
+
+			if lit {
+				showColor(single, rgb, status.Color)
 			} else {
-				p.Out(gpio.Low)
+				showColor(single, rgb, ColorOff)
 			}
 		case <-m.done:
-			log.Info("Got done event in driveBuzzer")
+			log.Info("Got done event in driveLed")
 
-			p.Out(gpio.Low)
+			if ticker != nil {
+				ticker.Stop()
+			}
+
+			showColor(single, rgb, ColorOff)
 			return
 		}
 	}
+}
+
+func (m *DispenserMachine) SetLed(status LedStatus) {
+	m.ledMutex.Lock()
+	m.led = status
+	m.ledMutex.Unlock()
 
-	log.Debug("Leaving driveBuzzer goroutine")
+	m.ledEvents <- status
 }
 
 func (m *DispenserMachine) DiagnosticNoise() {
-	m.ToggleBuzzer(true)
-	time.Sleep(200 * time.Millisecond)
-	m.ToggleBuzzer(false)
-	time.Sleep(200 * time.Millisecond)
-	m.ToggleBuzzer(true)
-	time.Sleep(200 * time.Millisecond)
-	m.ToggleBuzzer(false)
+	m.PlayPattern(DiagnosticPattern, true)
+}
+
+func (m *DispenserMachine) PlayPattern(pattern Pattern, interrupt bool) {
+	m.player.play(pattern, interrupt)
 }
 
 func (m *DispenserMachine) SubscribeTouches() *TouchesClient {
@@ -248,3 +510,140 @@ func (m *DispenserMachine) unsubscribeTouches(client *TouchesClient) {
 	delete(m.touchesClients, client.Id)
 	close(client.cancelChan)
 }
+
+func (m *DispenserMachine) SubscribeButton() *ButtonClient {
+	client := &ButtonClient{
+		Presses:    make(chan ButtonPress),
+		cancelChan: make(chan struct{}),
+		machine:    m,
+	}
+
+	m.nextButtonClient.Lock()
+	client.Id = m.nextButtonClient.id
+	m.nextButtonClient.id++
+	m.nextButtonClient.Unlock()
+
+	m.buttonClients[client.Id] = client
+
+	return client
+}
+
+func (m *DispenserMachine) notifyButtonClients(press ButtonPress) {
+	for _, client := range m.buttonClients {
+		client.Presses <- press
+	}
+}
+
+func (m *DispenserMachine) unsubscribeButton(client *ButtonClient) {
+	delete(m.buttonClients, client.Id)
+	close(client.cancelChan)
+}
+
+// SelfTest pulses the motor and cycles the buzzer and status led while
+// reading their pins back, and checks that no input is stuck
+func (m *DispenserMachine) SelfTest() *SelfTestReport {
+	log.Info("Running self test")
+
+	report := newSelfTestReport()
+
+	touched := m.touchPin.isActive()
+	pressed := m.buttonPin != nil && m.buttonPin.isActive()
+
+	for _, compartment := range m.Compartments() {
+		compartment := compartment
+
+		testOutput(report, SelfTestMotor, m.motorPins[compartment], func(on bool) {
+			if on {
+				m.DriveMotor(MotorFullSpeed.forCompartment(compartment))
+			} else {
+				m.DriveMotor(MotorStop.forCompartment(compartment))
+			}
+		})
+	}
+
+	testOutput(report, SelfTestBuzzer, m.buzzerPin, m.ToggleBuzzer)
+
+	m.testLed(report)
+
+	if touched && m.touchPin.isActive() {
+		report.fail(SelfTestTouch, "touch sensor reported a touch throughout the test and may be stuck")
+	} else {
+		report.pass(SelfTestTouch, "touch sensor reads released")
+	}
+
+	if m.buttonPin != nil {
+		if pressed && m.buttonPin.isActive() {
+			report.fail(SelfTestButton, "service button was pressed throughout the test and may be stuck")
+		} else {
+			report.pass(SelfTestButton, "service button reads released")
+		}
+	}
+
+	return report.finish()
+}
+
+// testOutput turns an output on and off again and reads back its level.
+// Reading back only tells that the pin took the level, not that the part
+// behind it works, so passing outputs are not verified.
+func testOutput(report *SelfTestReport, name string, p *profilePin, toggle func(on bool)) {
+	toggle(true)
+	time.Sleep(selfTestSettle)
+	on := p.isActive()
+
+	time.Sleep(selfTestPulse - selfTestSettle)
+
+	toggle(false)
+	time.Sleep(selfTestSettle)
+	off := !p.isActive()
+
+	switch {
+	case !on:
+		report.fail(name, "pin %s did not turn on", p.profile.Name)
+	case !off:
+		report.fail(name, "pin %s did not turn off", p.profile.Name)
+	default:
+		report.unverified(name, "pin %s turned on and off, but has no feedback to verify the %s", p.profile.Name, name)
+	}
+}
+
+// testLed cycles through the colors of the status led and restores the
+// status it showed before
+func (m *DispenserMachine) testLed(report *SelfTestReport) {
+	pins := []*profilePin{m.ledRedPin, m.ledGreenPin, m.ledBluePin}
+	single := m.ledPin
+
+	if single == nil && pins[0] == nil && pins[1] == nil && pins[2] == nil {
+		return
+	}
+
+	m.ledMutex.Lock()
+	previous := m.led
+	m.ledMutex.Unlock()
+
+	passed := true
+
+	for i, color := range selfTestColors {
+		m.ledEvents <- LedStatus{Color: color}
+		time.Sleep(selfTestSettle)
+
+		if single != nil && !single.isActive() {
+			report.fail(SelfTestLed, "pin %s did not turn on", single.profile.Name)
+			passed = false
+			break
+		}
+
+		if p := pins[i]; p != nil && !p.isActive() {
+			report.fail(SelfTestLed, "pin %s did not turn on for %v", p.profile.Name, color)
+			passed = false
+			break
+		}
+
+		time.Sleep(selfTestPulse - selfTestSettle)
+	}
+
+	m.ledEvents <- previous
+
+	if passed {
+		report.unverified(SelfTestLed, "status led cycled through %d colors, but has no feedback to verify them", len(selfTestColors))
+	}
+}
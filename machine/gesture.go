@@ -0,0 +1,179 @@
+package machine
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// GestureType is a kind of gesture performed on the touch sensor
+type GestureType uint8
+
+const (
+	// GestureTap is a short touch that was not followed by another one
+	GestureTap GestureType = iota
+
+	// GestureDoubleTap is two short touches in quick succession
+	GestureDoubleTap
+
+	// GestureLongPress is emitted as soon as a touch is held long enough
+	GestureLongPress
+
+	// GestureHold is emitted when a long press is released and carries the
+	// duration of the whole touch
+	GestureHold
+)
+
+const (
+	// DefaultTouchDebounce is the least time the touch sensor has to be
+	// touched before a touch is reported
+	DefaultTouchDebounce = 2 * time.Millisecond
+
+	// gesturesBuffer is the number of gestures kept for slow consumers
+	gesturesBuffer = 8
+)
+
+func (t GestureType) String() string {
+	switch t {
+	case GestureTap:
+		return "tap"
+	case GestureDoubleTap:
+		return "doubleTap"
+	case GestureLongPress:
+		return "longPress"
+	case GestureHold:
+		return "hold"
+	default:
+		return "unknown"
+	}
+}
+
+// Gesture is recognized from a sequence of touches
+type Gesture struct {
+	Type GestureType
+
+	// Duration is how long the sensor was touched
+	Duration time.Duration
+}
+
+// GestureConfig holds the timings gestures are recognized with
+type GestureConfig struct {
+	// DoubleTapInterval is the longest time between two taps of a double tap
+	DoubleTapInterval time.Duration
+
+	// LongPressDuration is the least time a touch is held for a long press
+	LongPressDuration time.Duration
+}
+
+// DefaultGestureConfig is used as long as no gesture timings are configured
+var DefaultGestureConfig = GestureConfig{
+	DoubleTapInterval: 300 * time.Millisecond,
+	LongPressDuration: 1 * time.Second,
+}
+
+type GesturesClient struct {
+	Gestures chan Gesture
+	cancel   chan struct{}
+}
+
+func (c *GesturesClient) Cancel() {
+	close(c.cancel)
+}
+
+// SubscribeGestures recognizes gestures from the touches of a machine, so
+// consumers don't need to deal with touch timings themselves
+func SubscribeGestures(machine Machine, config GestureConfig) *GesturesClient {
+	client := &GesturesClient{
+		Gestures: make(chan Gesture, gesturesBuffer),
+		cancel:   make(chan struct{}),
+	}
+
+	go recognizeGestures(machine.SubscribeTouches(), client, config)
+
+	return client
+}
+
+// recognizeGestures is run as a goroutine and turns touches into gestures
+func recognizeGestures(touches *TouchesClient, client *GesturesClient, config GestureConfig) {
+	defer touches.Cancel()
+
+	var (
+		touched time.Time
+		// pendingTap is set while a tap awaits a possible second one
+		pendingTap *Gesture
+		// longPressed tells if the current touch was reported as long press
+		longPressed bool
+		longPress   <-chan time.Time
+		tapTimeout  <-chan time.Time
+	)
+
+	emit := func(gesture Gesture) {
+		select {
+		case client.Gestures <- gesture:
+		default:
+			log.Warnf("Dropping %v gesture of a slow consumer", gesture.Type)
+		}
+	}
+
+	for {
+		select {
+		case on := <-touches.Touches:
+			if on {
+				if !touched.IsZero() {
+					continue
+				}
+
+				touched = time.Now()
+				longPressed = false
+				longPress = time.After(config.LongPressDuration)
+
+				continue
+			}
+
+			if touched.IsZero() {
+				continue
+			}
+
+			held := time.Since(touched)
+			touched = time.Time{}
+			longPress = nil
+
+			if longPressed {
+				emit(Gesture{Type: GestureHold, Duration: held})
+				continue
+			}
+
+			if pendingTap != nil {
+				pendingTap = nil
+				tapTimeout = nil
+
+				emit(Gesture{Type: GestureDoubleTap, Duration: held})
+				continue
+			}
+
+			pendingTap = &Gesture{Type: GestureTap, Duration: held}
+			tapTimeout = time.After(config.DoubleTapInterval)
+		case <-longPress:
+			longPress = nil
+			longPressed = true
+
+			// a tap right before a long press stands on its own
+			if pendingTap != nil {
+				emit(*pendingTap)
+				pendingTap = nil
+				tapTimeout = nil
+			}
+
+			emit(Gesture{Type: GestureLongPress, Duration: time.Since(touched)})
+		case <-tapTimeout:
+			tapTimeout = nil
+
+			// the second touch of a double tap may still be in progress
+			if pendingTap != nil && touched.IsZero() {
+				emit(*pendingTap)
+				pendingTap = nil
+			}
+		case <-client.cancel:
+			return
+		}
+	}
+}
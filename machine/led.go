@@ -0,0 +1,78 @@
+package machine
+
+import (
+	"fmt"
+	"time"
+)
+
+// Color of a status LED, where single color LEDs light up for any color
+type Color struct {
+	Red   bool
+	Green bool
+	Blue  bool
+}
+
+var (
+	ColorOff    = Color{}
+	ColorRed    = Color{Red: true}
+	ColorGreen  = Color{Green: true}
+	ColorBlue   = Color{Blue: true}
+	ColorYellow = Color{Red: true, Green: true}
+)
+
+// Blink is how a status LED blinks
+type Blink uint8
+
+const (
+	BlinkNone Blink = iota
+	BlinkSlow
+	BlinkFast
+)
+
+// LedStatus is what a status LED shows
+type LedStatus struct {
+	Color Color
+	Blink Blink
+}
+
+// interval returns the time the LED stays on and off while blinking
+func (b Blink) interval() time.Duration {
+	switch b {
+	case BlinkSlow:
+		return 1 * time.Second
+	case BlinkFast:
+		return 200 * time.Millisecond
+	default:
+		return 0
+	}
+}
+
+func (c Color) String() string {
+	switch c {
+	case ColorOff:
+		return "off"
+	case ColorRed:
+		return "red"
+	case ColorGreen:
+		return "green"
+	case ColorBlue:
+		return "blue"
+	case ColorYellow:
+		return "yellow"
+	default:
+		return fmt.Sprintf("rgb(%v,%v,%v)", c.Red, c.Green, c.Blue)
+	}
+}
+
+func (b Blink) String() string {
+	switch b {
+	case BlinkNone:
+		return "none"
+	case BlinkSlow:
+		return "slow"
+	case BlinkFast:
+		return "fast"
+	default:
+		return "unknown"
+	}
+}
@@ -3,9 +3,15 @@ package machine
 type Machine interface {
 	Start() error
 	Stop() error
-	ToggleMotor(on bool)
+	Compartments() []int
+	DriveMotor(command MotorCommand)
 	ToggleBuzzer(on bool)
 	DiagnosticNoise()
+	SelfTest() *SelfTestReport
+	PlayPattern(pattern Pattern, interrupt bool)
+	SetLed(status LedStatus)
 	SubscribeTouches() *TouchesClient
 	unsubscribeTouches(client *TouchesClient)
-}
\ No newline at end of file
+	SubscribeButton() *ButtonClient
+	unsubscribeButton(client *ButtonClient)
+}
@@ -0,0 +1,44 @@
+package machine
+
+import "time"
+
+// DefaultCompartment is the compartment of machines with a single motor
+const DefaultCompartment = 0
+
+// MotorCommand starts or stops the motor of a compartment. The speed is the
+// duty cycle between 0 and 1 the motor runs at, and ramps change the speed
+// gradually.
+type MotorCommand struct {
+	Compartment int
+	On          bool
+	Speed       float64
+	RampUp      time.Duration
+	RampDown    time.Duration
+}
+
+// MotorStop stops the motor of the default compartment immediately
+var MotorStop = MotorCommand{On: false}
+
+// MotorFullSpeed runs the motor of the default compartment at full speed
+// immediately
+var MotorFullSpeed = MotorCommand{On: true, Speed: 1}
+
+// forCompartment addresses the command to the motor of another compartment
+func (c MotorCommand) forCompartment(compartment int) MotorCommand {
+	c.Compartment = compartment
+	return c
+}
+
+// targetSpeed returns the speed the motor should reach and the time it
+// takes to get there
+func (c MotorCommand) targetSpeed() (float64, time.Duration) {
+	if !c.On {
+		return 0, c.RampDown
+	}
+
+	if c.Speed <= 0 || c.Speed > 1 {
+		return 1, c.RampUp
+	}
+
+	return c.Speed, c.RampUp
+}
@@ -0,0 +1,91 @@
+package machine
+
+import (
+	"sync"
+	"time"
+)
+
+// Pattern is a sequence of alternating buzzer on and off durations,
+// starting with the buzzer on
+type Pattern []time.Duration
+
+// DiagnosticPattern is a pair of short beeps
+var DiagnosticPattern = Pattern{
+	200 * time.Millisecond,
+	200 * time.Millisecond,
+	200 * time.Millisecond,
+}
+
+// patternPlayer plays patterns one after another on a buzzer
+type patternPlayer struct {
+	toggle    func(on bool)
+	mu        sync.Mutex
+	queue     []Pattern
+	interrupt chan struct{}
+	playing   bool
+}
+
+func newPatternPlayer(toggle func(on bool)) *patternPlayer {
+	return &patternPlayer{
+		toggle:    toggle,
+		interrupt: make(chan struct{}),
+	}
+}
+
+// play queues a pattern. Interrupting stops the current pattern and drops
+// all queued patterns before playing the given one.
+func (p *patternPlayer) play(pattern Pattern, interrupt bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if interrupt {
+		p.queue = nil
+
+		if p.playing {
+			close(p.interrupt)
+			p.interrupt = make(chan struct{})
+		}
+	}
+
+	p.queue = append(p.queue, pattern)
+
+	if !p.playing {
+		p.playing = true
+		go p.run()
+	}
+}
+
+// run is run as a goroutine and plays queued patterns until none are left
+func (p *patternPlayer) run() {
+	for {
+		p.mu.Lock()
+
+		if len(p.queue) == 0 {
+			p.playing = false
+			p.mu.Unlock()
+			return
+		}
+
+		pattern := p.queue[0]
+		p.queue = p.queue[1:]
+		interrupt := p.interrupt
+
+		p.mu.Unlock()
+
+		p.playPattern(pattern, interrupt)
+	}
+}
+
+func (p *patternPlayer) playPattern(pattern Pattern, interrupt chan struct{}) {
+	defer p.toggle(false)
+
+	for i, duration := range pattern {
+		p.toggle(i%2 == 0)
+
+		select {
+		case <-time.After(duration):
+		case <-interrupt:
+			return
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package machine
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"io/ioutil"
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"sort"
+	"strings"
+)
+
+const (
+	RoleTouch    = "touch"
+	RoleButton   = "button"
+	RoleMotor    = "motor"
+	RoleBuzzer   = "buzzer"
+	RoleLed      = "led"
+	RoleLedRed   = "ledRed"
+	RoleLedGreen = "ledGreen"
+	RoleLedBlue  = "ledBlue"
+)
+
+const (
+	PullDown = "down"
+	PullUp   = "up"
+	PullNone = "none"
+)
+
+// pinRoles tell which roles are known and if they are inputs
+var pinRoles = map[string]bool{
+	RoleTouch:    true,
+	RoleButton:   true,
+	RoleMotor:    false,
+	RoleBuzzer:   false,
+	RoleLed:      false,
+	RoleLedRed:   false,
+	RoleLedGreen: false,
+	RoleLedBlue:  false,
+}
+
+// requiredRoles need to be wired on every machine
+var requiredRoles = []string{RoleTouch, RoleMotor, RoleBuzzer}
+
+// hardwarePwmPins are the BCM numbers of the Raspberry Pi pins that are
+// capable of hardware pulse width modulation
+var hardwarePwmPins = map[string]bool{
+	"12": true,
+	"13": true,
+	"18": true,
+	"19": true,
+}
+
+// isHardwarePwmPin tells if a pin name refers to a pin capable of hardware
+// pulse width modulation, accepting names like 18, GPIO18 or BCM18
+func isHardwarePwmPin(name string) bool {
+	number := strings.TrimPrefix(strings.TrimPrefix(strings.ToUpper(name), "GPIO"), "BCM")
+
+	return hardwarePwmPins[number]
+}
+
+// PinProfile describes how a single pin is wired
+type PinProfile struct {
+	// Name of the pin as known to the GPIO registry, e.g. the BCM number
+	Name string `json:"name"`
+
+	// Role is what the pin is used for
+	Role string `json:"role"`
+
+	// ActiveLow inverts the pin, so a low level means on
+	ActiveLow bool `json:"activeLow"`
+
+	// Pull is the internal resistor of an input, defaulting to pulling
+	// towards the inactive level
+	Pull string `json:"pull,omitempty"`
+
+	// PWM tells if an output is capable of pulse width modulation
+	PWM bool `json:"pwm"`
+
+	// Compartment is the hopper driven by a motor pin
+	Compartment int `json:"compartment,omitempty"`
+}
+
+// HardwareProfile describes the wiring of a board revision
+type HardwareProfile struct {
+	Name string       `json:"name"`
+	Pins []PinProfile `json:"pins"`
+}
+
+// PinFlags are the pins that were configured before hardware profiles
+type PinFlags struct {
+	TouchPin    string
+	ButtonPin   string
+	MotorPin    string
+	BuzzerPin   string
+	LedPin      string
+	LedRedPin   string
+	LedGreenPin string
+	LedBluePin  string
+}
+
+// NewHardwareProfile describes active high pins and a pull down touch input,
+// which is how the machine was wired before hardware profiles existed
+func NewHardwareProfile(flags PinFlags) *HardwareProfile {
+	profile := &HardwareProfile{Name: "flags"}
+
+	add := func(name string, role string, pwm bool) {
+		if name == "" {
+			return
+		}
+
+		profile.Pins = append(profile.Pins, PinProfile{Name: name, Role: role, PWM: pwm})
+	}
+
+	add(flags.TouchPin, RoleTouch, false)
+	add(flags.ButtonPin, RoleButton, false)
+	add(flags.MotorPin, RoleMotor, isHardwarePwmPin(flags.MotorPin))
+	add(flags.BuzzerPin, RoleBuzzer, false)
+	add(flags.LedPin, RoleLed, false)
+	add(flags.LedRedPin, RoleLedRed, false)
+	add(flags.LedGreenPin, RoleLedGreen, false)
+	add(flags.LedBluePin, RoleLedBlue, false)
+
+	return profile
+}
+
+// LoadHardwareProfile reads a hardware profile from a JSON file
+func LoadHardwareProfile(path string) (*HardwareProfile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("Could not read hardware profile: %v", err)
+	}
+
+	profile := &HardwareProfile{}
+
+	err = json.Unmarshal(data, profile)
+	if err != nil {
+		return nil, errors.Errorf("Could not parse hardware profile: %v", err)
+	}
+
+	return profile, nil
+}
+
+// Validate checks that the profile describes a working machine
+func (p *HardwareProfile) Validate() error {
+	names := make(map[string]bool)
+	roles := make(map[string]bool)
+	compartments := make(map[int]bool)
+
+	for _, pin := range p.Pins {
+		if pin.Name == "" {
+			return errors.Errorf("Pin with role %s has no name", pin.Role)
+		}
+
+		if names[pin.Name] {
+			return errors.Errorf("Pin %s is used more than once", pin.Name)
+		}
+
+		names[pin.Name] = true
+
+		input, ok := pinRoles[pin.Role]
+		if !ok {
+			return errors.Errorf("Pin %s has unknown role %s", pin.Name, pin.Role)
+		}
+
+		if pin.Role == RoleMotor {
+			if pin.Compartment < 0 {
+				return errors.Errorf("Motor pin %s has negative compartment %d", pin.Name, pin.Compartment)
+			}
+
+			if compartments[pin.Compartment] {
+				return errors.Errorf("Compartment %d has more than one motor", pin.Compartment)
+			}
+
+			compartments[pin.Compartment] = true
+		} else if pin.Compartment != 0 {
+			return errors.Errorf("Pin %s with role %s can not have a compartment", pin.Name, pin.Role)
+		} else if roles[pin.Role] {
+			return errors.Errorf("Role %s is assigned to more than one pin", pin.Role)
+		}
+
+		roles[pin.Role] = true
+
+		switch pin.Pull {
+		case "", PullDown, PullUp, PullNone:
+		default:
+			return errors.Errorf("Pin %s has unknown pull mode %s", pin.Name, pin.Pull)
+		}
+
+		if !input && pin.Pull != "" {
+			return errors.Errorf("Output pin %s can not have a pull mode", pin.Name)
+		}
+
+		if input && pin.PWM {
+			return errors.Errorf("Input pin %s can not be capable of PWM", pin.Name)
+		}
+	}
+
+	for _, role := range requiredRoles {
+		if !roles[role] {
+			return errors.Errorf("No pin has the required role %s", role)
+		}
+	}
+
+	return nil
+}
+
+// Pin returns the profile of the pin with the given role, or nil if no pin
+// has that role
+func (p *HardwareProfile) Pin(role string) *PinProfile {
+	for i := range p.Pins {
+		if p.Pins[i].Role == role {
+			return &p.Pins[i]
+		}
+	}
+
+	return nil
+}
+
+// Compartments returns the ids of all compartments that have a motor
+func (p *HardwareProfile) Compartments() []int {
+	compartments := []int{}
+
+	for _, pin := range p.Pins {
+		if pin.Role == RoleMotor {
+			compartments = append(compartments, pin.Compartment)
+		}
+	}
+
+	sort.Ints(compartments)
+
+	return compartments
+}
+
+// profilePin reads or drives a pin as described by its profile
+type profilePin struct {
+	gpio.PinIO
+	profile PinProfile
+}
+
+// openPin looks up a pin of the profile in the GPIO registry. It returns
+// nil without an error if the profile has no pin with the given role.
+func openPin(profile *HardwareProfile, role string) (*profilePin, error) {
+	pinProfile := profile.Pin(role)
+	if pinProfile == nil {
+		return nil, nil
+	}
+
+	p := gpioreg.ByName(pinProfile.Name)
+	if p == nil {
+		return nil, errors.Errorf("Pin %s for %s does not exist", pinProfile.Name, role)
+	}
+
+	return &profilePin{PinIO: p, profile: *pinProfile}, nil
+}
+
+// openMotorPins looks up the motor pins of all compartments in the GPIO
+// registry
+func openMotorPins(profile *HardwareProfile) (map[int]*profilePin, error) {
+	pins := make(map[int]*profilePin)
+
+	for _, pinProfile := range profile.Pins {
+		if pinProfile.Role != RoleMotor {
+			continue
+		}
+
+		p := gpioreg.ByName(pinProfile.Name)
+		if p == nil {
+			return nil, errors.Errorf("Pin %s for the motor of compartment %d does not exist",
+				pinProfile.Name, pinProfile.Compartment)
+		}
+
+		pins[pinProfile.Compartment] = &profilePin{PinIO: p, profile: pinProfile}
+	}
+
+	return pins, nil
+}
+
+// in sets up an input that detects both edges
+func (p *profilePin) in() error {
+	pull := gpio.PullDown
+
+	switch p.profile.Pull {
+	case PullDown:
+		pull = gpio.PullDown
+	case PullUp:
+		pull = gpio.PullUp
+	case PullNone:
+		pull = gpio.Float
+	default:
+		if p.profile.ActiveLow {
+			pull = gpio.PullUp
+		}
+	}
+
+	return p.In(pull, gpio.BothEdges)
+}
+
+// isActive tells if an input is on
+func (p *profilePin) isActive() bool {
+	return (p.Read() == gpio.High) != p.profile.ActiveLow
+}
+
+// set turns an output on or off
+func (p *profilePin) set(on bool) error {
+	return p.Out(gpio.Level(on != p.profile.ActiveLow))
+}
+
+// setDuty modulates an output with the given share of time it is on
+func (p *profilePin) setDuty(duty float64) error {
+	if !p.profile.PWM {
+		return errors.Errorf("pin %s is not capable of PWM", p.profile.Name)
+	}
+
+	if p.profile.ActiveLow {
+		duty = 1 - duty
+	}
+
+	return p.PWM(gpio.Duty(duty*float64(gpio.DutyMax)), motorPwmFrequency)
+}
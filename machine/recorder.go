@@ -0,0 +1,314 @@
+package machine
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	RecordTouch   = "touch"
+	RecordButton  = "button"
+	RecordMotor   = "motor"
+	RecordBuzzer  = "buzzer"
+	RecordPattern = "pattern"
+	RecordLed     = "led"
+	RecordPayment = "payment"
+)
+
+// RecordedEvent is a single entry of a hardware event recording
+type RecordedEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// On tells if a touch, motor or buzzer was turned on or off
+	On bool `json:"on"`
+
+	// Compartment is the compartment of a motor or payment
+	Compartment int `json:"compartment,omitempty"`
+
+	// Speed is the share of full speed a motor was started with
+	Speed float64 `json:"speed,omitempty"`
+
+	// Value is the gesture of a button press, the color of the led or the
+	// payment hash of a payment
+	Value string `json:"value,omitempty"`
+
+	// MSat is the amount of a payment
+	MSat int64 `json:"msat,omitempty"`
+}
+
+// Recorder appends hardware events to a file, one JSON object per line.
+// A nil recorder records nothing.
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder opens the given file for appending a recording
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Errorf("Could not open recording: %v", err)
+	}
+
+	return &Recorder{file: file}, nil
+}
+
+// Record appends an event to the recording, setting its time if unset
+func (r *Recorder) Record(event RecordedEvent) {
+	if r == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("Could not encode recorded event: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	_, err = r.file.Write(append(data, '\n'))
+	if err != nil {
+		log.Errorf("Could not write recorded event: %v", err)
+	}
+}
+
+// RecordPayment records a payment that led to a dispense
+func (r *Recorder) RecordPayment(rHash string, msat int64, compartment int) {
+	r.Record(RecordedEvent{
+		Type:        RecordPayment,
+		On:          true,
+		Compartment: compartment,
+		Value:       rHash,
+		MSat:        msat,
+	})
+}
+
+// Close stops recording
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// LoadRecording reads all events of a recording in the order they were
+// recorded
+func LoadRecording(path string) ([]RecordedEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Errorf("Could not open recording: %v", err)
+	}
+
+	defer file.Close()
+
+	return readRecording(file)
+}
+
+// readRecording parses a recording of one JSON object per line
+func readRecording(reader io.Reader) ([]RecordedEvent, error) {
+	recording := []RecordedEvent{}
+
+	scanner := bufio.NewScanner(reader)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event RecordedEvent
+
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, errors.Errorf("Could not parse line %d of recording: %v", line, err)
+		}
+
+		recording = append(recording, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Errorf("Could not read recording: %v", err)
+	}
+
+	return recording, nil
+}
+
+// NewReplayScenario turns the inputs of a recording into a scenario for the
+// simulator, keeping the time between them. Touches, button presses and
+// payments are replayed, while the outputs are left to the dispenser, so
+// they can be compared with the recording.
+func NewReplayScenario(name string, recording []RecordedEvent) *Scenario {
+	scenario := &Scenario{Name: name, Steps: []ScenarioStep{}}
+
+	var last time.Time
+
+	for _, event := range recording {
+		var step ScenarioStep
+
+		switch event.Type {
+		case RecordTouch:
+			step.Action = ScenarioActionRelease
+			if event.On {
+				step.Action = ScenarioActionTouch
+			}
+		case RecordButton:
+			step.Action = ScenarioActionButton
+			step.Value = event.Value
+		case RecordPayment:
+			step.Action = ScenarioActionPayment
+			step.Value = event.Value
+			step.MSat = event.MSat
+			step.Compartment = event.Compartment
+		default:
+			continue
+		}
+
+		if !last.IsZero() && event.Time.After(last) {
+			scenario.Steps = append(scenario.Steps, ScenarioStep{
+				Action:   ScenarioActionWait,
+				Duration: event.Time.Sub(last),
+			})
+		}
+
+		last = event.Time
+
+		scenario.Steps = append(scenario.Steps, step)
+	}
+
+	return scenario
+}
+
+// buttonPressValue names a button press the way scenarios do
+func buttonPressValue(press ButtonPress) string {
+	for value, p := range buttonPresses {
+		if p == press {
+			return value
+		}
+	}
+
+	return press.String()
+}
+
+// RecordingMachine wraps a machine and records the touches and button
+// presses it reports as well as everything it is told to do
+type RecordingMachine struct {
+	Machine
+	recorder      *Recorder
+	touchesClient *TouchesClient
+	buttonClient  *ButtonClient
+	done          chan struct{}
+}
+
+// Compile time check for protocol compatibility
+var _ Machine = (*RecordingMachine)(nil)
+
+func NewRecordingMachine(machine Machine, recorder *Recorder) *RecordingMachine {
+	return &RecordingMachine{
+		Machine:  machine,
+		recorder: recorder,
+	}
+}
+
+func (m *RecordingMachine) Start() error {
+	err := m.Machine.Start()
+	if err != nil {
+		return err
+	}
+
+	m.done = make(chan struct{})
+	m.touchesClient = m.Machine.SubscribeTouches()
+	m.buttonClient = m.Machine.SubscribeButton()
+
+	go m.recordInputs(m.touchesClient, m.buttonClient, m.done)
+
+	return nil
+}
+
+func (m *RecordingMachine) Stop() error {
+	if m.done != nil {
+		m.touchesClient.Cancel()
+		m.buttonClient.Cancel()
+		close(m.done)
+		m.done = nil
+	}
+
+	return m.Machine.Stop()
+}
+
+// recordInputs is run as a goroutine and records touches and button
+// presses until the machine is stopped
+func (m *RecordingMachine) recordInputs(touchesClient *TouchesClient, buttonClient *ButtonClient, done chan struct{}) {
+	for {
+		select {
+		case on := <-touchesClient.Touches:
+			m.recorder.Record(RecordedEvent{Type: RecordTouch, On: on})
+		case press := <-buttonClient.Presses:
+			m.recorder.Record(RecordedEvent{Type: RecordButton, On: true, Value: buttonPressValue(press)})
+		case <-done:
+			return
+		}
+	}
+}
+
+func (m *RecordingMachine) DriveMotor(command MotorCommand) {
+	m.recorder.Record(RecordedEvent{
+		Type:        RecordMotor,
+		On:          command.On,
+		Compartment: command.Compartment,
+		Speed:       command.Speed,
+	})
+
+	m.Machine.DriveMotor(command)
+}
+
+func (m *RecordingMachine) ToggleBuzzer(on bool) {
+	m.recorder.Record(RecordedEvent{Type: RecordBuzzer, On: on})
+
+	m.Machine.ToggleBuzzer(on)
+}
+
+func (m *RecordingMachine) PlayPattern(pattern Pattern, interrupt bool) {
+	m.recorder.Record(RecordedEvent{Type: RecordPattern, On: len(pattern) > 0})
+
+	m.Machine.PlayPattern(pattern, interrupt)
+}
+
+func (m *RecordingMachine) SetLed(status LedStatus) {
+	m.recorder.Record(RecordedEvent{
+		Type:  RecordLed,
+		On:    status.Color != ColorOff,
+		Value: status.Color.String() + " " + status.Blink.String(),
+	})
+
+	m.Machine.SetLed(status)
+}
@@ -0,0 +1,395 @@
+package machine
+
+import (
+	"github.com/go-errors/errors"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// FaultMaxRuntime is reported when the motor ran continuously for too long
+	FaultMaxRuntime = "maxRuntime"
+
+	// FaultDutyCycle is reported when the motor ran for too long within the
+	// duty cycle window
+	FaultDutyCycle = "dutyCycle"
+)
+
+// SafetyLimits protect the motor from overheating. Zero values disable
+// the respective limit.
+type SafetyLimits struct {
+	// MaxRuntime is the longest time the motor may run continuously
+	MaxRuntime time.Duration
+
+	// Cooldown is the least time the motor rests before starting again
+	Cooldown time.Duration
+
+	// DutyCycle is the share of the duty window the motor may run
+	DutyCycle float64
+
+	// DutyWindow is the rolling window the duty cycle applies to
+	DutyWindow time.Duration
+}
+
+// Fault describes why a motor was forcefully stopped
+type Fault struct {
+	Reason      string
+	Compartment int
+	Time        time.Time
+}
+
+type SafeMachineConfig struct {
+	Machine Machine
+	Limits  SafetyLimits
+	OnFault func(fault *Fault)
+}
+
+// motorRun is a period of time in which the motor was running
+type motorRun struct {
+	start time.Time
+	end   time.Time
+}
+
+// motorUsage tracks the runs of the motor of a single compartment
+type motorUsage struct {
+	started time.Time
+	stopped time.Time
+	runs    []motorRun
+	timer   *time.Timer
+}
+
+// SafeMachine wraps a machine and enforces safety limits on each of its
+// motors. When a limit is exceeded, the motor is stopped and a fault is
+// reported, which has to be reset before any motor runs again.
+type SafeMachine struct {
+	Machine
+	limits  SafetyLimits
+	onFault func(fault *Fault)
+	mu      sync.Mutex
+	motors  map[int]*motorUsage
+	fault   *Fault
+	testing bool
+}
+
+// Compile time check for protocol compatibility
+var _ Machine = (*SafeMachine)(nil)
+
+func NewSafeMachine(config *SafeMachineConfig) *SafeMachine {
+	m := &SafeMachine{
+		Machine: config.Machine,
+		limits:  config.Limits,
+		onFault: config.OnFault,
+		motors:  make(map[int]*motorUsage),
+	}
+
+	if m.onFault == nil {
+		m.onFault = func(*Fault) {}
+	}
+
+	return m
+}
+
+func (m *SafeMachine) SetLimits(limits SafetyLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limits = limits
+}
+
+func (m *SafeMachine) GetLimits() SafetyLimits {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.limits
+}
+
+// GetFault returns the current fault, or nil if the motor is not faulted
+func (m *SafeMachine) GetFault() *Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.fault
+}
+
+// ResetFault allows the motor to run again after a fault
+func (m *SafeMachine) ResetFault() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fault = nil
+}
+
+// motor returns the usage of the motor of a compartment, expecting the
+// lock to be held
+func (m *SafeMachine) motor(compartment int) *motorUsage {
+	motor, ok := m.motors[compartment]
+	if !ok {
+		motor = &motorUsage{}
+		m.motors[compartment] = motor
+	}
+
+	return motor
+}
+
+// CooldownRemaining returns how long the motor of a compartment still
+// rests before it may start again
+func (m *SafeMachine) CooldownRemaining(compartment int) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.cooldownRemaining(m.motor(compartment), time.Now())
+}
+
+// CanStartMotor checks if the motor of a compartment may be started
+// right now
+func (m *SafeMachine) CanStartMotor(compartment int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.canStart(m.motor(compartment), time.Now())
+}
+
+// StartMotor starts the motor unless a limit prevents it. The motor is
+// stopped with a fault as soon as it reaches a limit while running.
+func (m *SafeMachine) StartMotor(command MotorCommand) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	motor := m.motor(command.Compartment)
+
+	if !motor.started.IsZero() {
+		return nil
+	}
+
+	err := m.canStart(motor, now)
+	if err != nil {
+		return err
+	}
+
+	reason := FaultMaxRuntime
+	limit := m.limits.MaxRuntime
+
+	if budget := m.dutyBudget(motor, now); limit <= 0 || budget < limit {
+		reason = FaultDutyCycle
+		limit = budget
+	}
+
+	command.On = true
+
+	motor.started = now
+	m.Machine.DriveMotor(command)
+
+	motor.timer = time.AfterFunc(limit, func() {
+		m.trip(command.Compartment, reason, now)
+	})
+
+	return nil
+}
+
+// StopMotor stops the motor
+func (m *SafeMachine) StopMotor(command MotorCommand) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	command.On = false
+
+	m.stop(m.motor(command.Compartment), time.Now())
+	m.Machine.DriveMotor(command)
+}
+
+func (m *SafeMachine) DriveMotor(command MotorCommand) {
+	if !command.On {
+		m.StopMotor(command)
+		return
+	}
+
+	err := m.StartMotor(command)
+	if err != nil {
+		log.Warnf("Refusing to start motor: %v", err)
+	}
+}
+
+// trip stops a motor with a fault, unless the run it was scheduled for
+// has ended already
+func (m *SafeMachine) trip(compartment int, reason string, started time.Time) {
+	m.mu.Lock()
+
+	motor := m.motor(compartment)
+
+	if !motor.started.Equal(started) {
+		m.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+
+	m.stop(motor, now)
+	m.Machine.DriveMotor(MotorStop.forCompartment(compartment))
+
+	fault := &Fault{
+		Reason:      reason,
+		Compartment: compartment,
+		Time:        now,
+	}
+
+	m.fault = fault
+
+	m.mu.Unlock()
+
+	log.Errorf("Motor of compartment %d stopped due to exceeded %s limit", compartment, reason)
+
+	m.onFault(fault)
+}
+
+// stop records the end of the current run, expecting the lock to be held
+func (m *SafeMachine) stop(motor *motorUsage, now time.Time) {
+	if motor.started.IsZero() {
+		return
+	}
+
+	if motor.timer != nil {
+		motor.timer.Stop()
+		motor.timer = nil
+	}
+
+	motor.runs = append(motor.runs, motorRun{start: motor.started, end: now})
+	motor.started = time.Time{}
+	motor.stopped = now
+}
+
+// isRunning tells if any motor is running, expecting the lock to be held
+func (m *SafeMachine) isRunning() bool {
+	for _, motor := range m.motors {
+		if !motor.started.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SelfTest keeps the motor from being started by anything else while the
+// machine is tested, and refuses to test while any motor may not start.
+// The motor pulses of the test count towards the duty cycle and cooldown
+// of each motor like any other run.
+func (m *SafeMachine) SelfTest() *SelfTestReport {
+	m.mu.Lock()
+
+	if m.isRunning() || m.testing {
+		m.mu.Unlock()
+
+		report := newSelfTestReport()
+		report.fail(SelfTestMotor, "motor is busy")
+
+		return report.finish()
+	}
+
+	now := time.Now()
+
+	for _, compartment := range m.Machine.Compartments() {
+		err := m.canStart(m.motor(compartment), now)
+		if err != nil {
+			m.mu.Unlock()
+
+			report := newSelfTestReport()
+			report.fail(SelfTestMotor, "motor of compartment %d may not run: %v", compartment, err)
+
+			return report.finish()
+		}
+	}
+
+	m.testing = true
+	m.mu.Unlock()
+
+	report := m.Machine.SelfTest()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.testing = false
+
+	// each motor was pulsed once during the test
+	for _, compartment := range m.Machine.Compartments() {
+		motor := m.motor(compartment)
+		motor.runs = append(motor.runs, motorRun{
+			start: report.Finished.Add(-selfTestPulse),
+			end:   report.Finished,
+		})
+		motor.stopped = report.Finished
+	}
+
+	return report
+}
+
+// canStart expects the lock to be held
+func (m *SafeMachine) canStart(motor *motorUsage, now time.Time) error {
+	if m.testing {
+		return errors.Errorf("self test is running")
+	}
+
+	if m.fault != nil {
+		return errors.Errorf("motor is faulted due to exceeded %s limit", m.fault.Reason)
+	}
+
+	if remaining := m.cooldownRemaining(motor, now); remaining > 0 {
+		return errors.Errorf("motor is cooling down for another %v", remaining)
+	}
+
+	if m.dutyBudget(motor, now) <= 0 {
+		return errors.Errorf("motor reached its duty cycle of %v", m.limits.DutyCycle)
+	}
+
+	return nil
+}
+
+// cooldownRemaining expects the lock to be held
+func (m *SafeMachine) cooldownRemaining(motor *motorUsage, now time.Time) time.Duration {
+	if motor.stopped.IsZero() || m.limits.Cooldown <= 0 {
+		return 0
+	}
+
+	remaining := m.limits.Cooldown - now.Sub(motor.stopped)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// dutyBudget returns how long the motor may still run within the duty
+// window, expecting the lock to be held
+func (m *SafeMachine) dutyBudget(motor *motorUsage, now time.Time) time.Duration {
+	if m.limits.DutyCycle <= 0 || m.limits.DutyWindow <= 0 {
+		return math.MaxInt64
+	}
+
+	windowStart := now.Add(-m.limits.DutyWindow)
+
+	// forget about runs that ended before the window
+	runs := motor.runs[:0]
+	for _, run := range motor.runs {
+		if run.end.After(windowStart) {
+			runs = append(runs, run)
+		}
+	}
+	motor.runs = runs
+
+	var used time.Duration
+	for _, run := range motor.runs {
+		start := run.start
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+
+		used += run.end.Sub(start)
+	}
+
+	if !motor.started.IsZero() {
+		used += now.Sub(motor.started)
+	}
+
+	return time.Duration(m.limits.DutyCycle*float64(m.limits.DutyWindow)) - used
+}
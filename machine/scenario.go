@@ -0,0 +1,186 @@
+package machine
+
+import (
+	"github.com/go-errors/errors"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// ScenarioActionTouch touches the sensor, and releases it again after
+	// the duration of the step if one is given
+	ScenarioActionTouch = "touch"
+
+	// ScenarioActionRelease releases the touch sensor
+	ScenarioActionRelease = "release"
+
+	// ScenarioActionButton presses the service button, where the value is
+	// short, long or veryLong
+	ScenarioActionButton = "button"
+
+	// ScenarioActionFault injects the fault given as value
+	ScenarioActionFault = "fault"
+
+	// ScenarioActionClear clears the fault given as value
+	ScenarioActionClear = "clear"
+
+	// ScenarioActionWait waits for the duration of the step
+	ScenarioActionWait = "wait"
+
+	// ScenarioActionPayment simulates a payment of the amount of the step
+	// for its compartment, where the value is the payment hash that was
+	// recorded for it
+	ScenarioActionPayment = "payment"
+)
+
+// buttonPresses maps scenario values to service button presses
+var buttonPresses = map[string]ButtonPress{
+	"short":    ButtonPressShort,
+	"long":     ButtonPressLong,
+	"veryLong": ButtonPressVeryLong,
+}
+
+// ScenarioStep is a single action of a scenario
+type ScenarioStep struct {
+	Action      string
+	Value       string
+	Duration    time.Duration
+	MSat        int64
+	Compartment int
+}
+
+// Scenario is a script of steps the simulator runs one after another
+type Scenario struct {
+	Name  string
+	Steps []ScenarioStep
+}
+
+// Validate checks that the simulator is able to run all steps
+func (s *Scenario) Validate() error {
+	for i, step := range s.Steps {
+		if step.Duration < 0 {
+			return errors.Errorf("step %d has a negative duration", i)
+		}
+
+		switch step.Action {
+		case ScenarioActionTouch, ScenarioActionRelease, ScenarioActionWait:
+		case ScenarioActionButton:
+			if _, ok := buttonPresses[step.Value]; !ok {
+				return errors.Errorf("step %d presses unknown button gesture %s", i, step.Value)
+			}
+		case ScenarioActionPayment:
+			if step.MSat <= 0 {
+				return errors.Errorf("step %d pays no amount", i)
+			}
+		case ScenarioActionFault, ScenarioActionClear:
+			if !simulatorFaults[step.Value] {
+				return errors.Errorf("step %d uses unknown fault %s", i, step.Value)
+			}
+		default:
+			return errors.Errorf("step %d has unknown action %s", i, step.Action)
+		}
+	}
+
+	return nil
+}
+
+// RunScenario runs a scenario in the background, stopping any scenario
+// that is still running
+func (m *SimulatorMachine) RunScenario(scenario *Scenario) error {
+	err := scenario.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.stopScenario()
+
+	cancel := make(chan struct{})
+
+	m.update(func(state *SimulatorState) {
+		m.scenarioCancel = cancel
+		state.Scenario = scenario.Name
+	})
+
+	go m.runScenario(scenario, cancel)
+
+	return nil
+}
+
+// StopScenario stops a running scenario
+func (m *SimulatorMachine) StopScenario() {
+	m.stopScenario()
+}
+
+func (m *SimulatorMachine) stopScenario() {
+	m.update(func(state *SimulatorState) {
+		if m.scenarioCancel != nil {
+			close(m.scenarioCancel)
+			m.scenarioCancel = nil
+		}
+
+		state.Scenario = ""
+	})
+}
+
+// runScenario is run as a goroutine and performs the steps of a scenario
+// until it is done or cancelled
+func (m *SimulatorMachine) runScenario(scenario *Scenario, cancel chan struct{}) {
+	log.Infof("Running scenario %s", scenario.Name)
+
+	wait := func(duration time.Duration) bool {
+		select {
+		case <-time.After(duration):
+			return true
+		case <-cancel:
+			return false
+		}
+	}
+
+	for _, step := range scenario.Steps {
+		switch step.Action {
+		case ScenarioActionTouch:
+			m.Touch(true)
+
+			if step.Duration > 0 {
+				if !wait(step.Duration) {
+					return
+				}
+
+				m.Touch(false)
+			}
+		case ScenarioActionRelease:
+			m.Touch(false)
+		case ScenarioActionButton:
+			m.PressButton(buttonPresses[step.Value])
+		case ScenarioActionFault:
+			m.SetFault(step.Value, true)
+		case ScenarioActionClear:
+			m.SetFault(step.Value, false)
+		case ScenarioActionPayment:
+			m.Pay(SimulatedPayment{
+				RHash:       step.Value,
+				MSat:        step.MSat,
+				Compartment: step.Compartment,
+			})
+		case ScenarioActionWait:
+			if !wait(step.Duration) {
+				return
+			}
+		}
+
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+	}
+
+	log.Infof("Finished scenario %s", scenario.Name)
+
+	m.update(func(state *SimulatorState) {
+		if m.scenarioCancel == cancel {
+			m.scenarioCancel = nil
+			state.Scenario = ""
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package machine
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	SelfTestMotor  = "motor"
+	SelfTestBuzzer = "buzzer"
+	SelfTestLed    = "led"
+	SelfTestTouch  = "touch"
+	SelfTestButton = "button"
+
+	// selfTestPulse is how long outputs are turned on during a self test
+	selfTestPulse = 200 * time.Millisecond
+
+	// selfTestSettle is the time given to outputs before they are read back
+	selfTestSettle = 20 * time.Millisecond
+)
+
+// selfTestColors are cycled through on the status LED during a self test
+var selfTestColors = []Color{ColorRed, ColorGreen, ColorBlue}
+
+// SelfTestCheck is the outcome of testing a single part of the machine.
+// Checks of outputs without any feedback are not verified, and neither
+// pass nor fail the report.
+type SelfTestCheck struct {
+	Name     string
+	Passed   bool
+	Verified bool
+	Message  string
+}
+
+// SelfTestReport is the outcome of a self test of the whole machine
+type SelfTestReport struct {
+	Started  time.Time
+	Finished time.Time
+	Passed   bool
+	Checks   []SelfTestCheck
+}
+
+// newSelfTestReport starts a report for a self test that begins right now
+func newSelfTestReport() *SelfTestReport {
+	return &SelfTestReport{
+		Started: time.Now(),
+		Passed:  true,
+		Checks:  []SelfTestCheck{},
+	}
+}
+
+// pass records a passed check
+func (r *SelfTestReport) pass(name string, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, SelfTestCheck{
+		Name:     name,
+		Passed:   true,
+		Verified: true,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// unverified records a check that could not tell if the part works
+func (r *SelfTestReport) unverified(name string, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, SelfTestCheck{
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// fail records a failed check, which fails the whole report
+func (r *SelfTestReport) fail(name string, format string, args ...interface{}) {
+	r.Passed = false
+	r.Checks = append(r.Checks, SelfTestCheck{
+		Name:     name,
+		Passed:   false,
+		Verified: true,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// finish marks the end of the self test
+func (r *SelfTestReport) finish() *SelfTestReport {
+	r.Finished = time.Now()
+	return r
+}
@@ -0,0 +1,517 @@
+package machine
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// SimulatorFaultTouchDead makes the touch sensor ignore all touches
+	SimulatorFaultTouchDead = "touchDead"
+
+	// SimulatorFaultTouchStuck makes the touch sensor report a touch that
+	// is never released
+	SimulatorFaultTouchStuck = "touchStuck"
+
+	// SimulatorFaultMotorJammed keeps the motor from turning while it is on
+	SimulatorFaultMotorJammed = "motorJammed"
+
+	// SimulatorFaultBuzzerDead keeps the buzzer silent
+	SimulatorFaultBuzzerDead = "buzzerDead"
+)
+
+// simulatorFaults are all faults the simulator can inject
+var simulatorFaults = map[string]bool{
+	SimulatorFaultTouchDead:   true,
+	SimulatorFaultTouchStuck:  true,
+	SimulatorFaultMotorJammed: true,
+	SimulatorFaultBuzzerDead:  true,
+}
+
+// SimulatedPayment is a payment the simulator reports without a node
+// being involved
+type SimulatedPayment struct {
+	RHash       string
+	MSat        int64
+	Compartment int
+}
+
+type SimulatorMotorState struct {
+	Compartment int       `json:"compartment"`
+	On          bool      `json:"on"`
+	Running     bool      `json:"running"`
+	Speed       float64   `json:"speed"`
+	RampUp      int64     `json:"rampUp"`
+	RampDown    int64     `json:"rampDown"`
+	Changed     time.Time `json:"changed"`
+}
+
+type SimulatorBuzzerState struct {
+	On      bool      `json:"on"`
+	Changed time.Time `json:"changed"`
+}
+
+type SimulatorLedState struct {
+	Color   string    `json:"color"`
+	Blink   string    `json:"blink"`
+	Changed time.Time `json:"changed"`
+}
+
+type SimulatorTouchState struct {
+	On      bool      `json:"on"`
+	Changed time.Time `json:"changed"`
+}
+
+// SimulatorState is everything the simulator knows about its hardware
+type SimulatorState struct {
+	Motors   []SimulatorMotorState `json:"motors"`
+	Buzzer   SimulatorBuzzerState  `json:"buzzer"`
+	Led      SimulatorLedState     `json:"led"`
+	Touch    SimulatorTouchState   `json:"touch"`
+	Faults   []string              `json:"faults"`
+	Scenario string                `json:"scenario,omitempty"`
+}
+
+// SimulatorMachine simulates the hardware of a dispenser. It tracks the
+// state of the motor, buzzer and status led, and serves a panel to watch
+// that state and to touch the sensor, press the service button, inject
+// faults and run scenarios.
+type SimulatorMachine struct {
+	listen            string
+	server            *http.Server
+	mu                sync.Mutex
+	state             SimulatorState
+	faults            map[string]bool
+	scenarioCancel    chan struct{}
+	feedClients       map[uint32]chan SimulatorState
+	nextFeedClient    uint32
+	touchesClients    map[uint32]*TouchesClient
+	nextTouchesClient nextTouchesClient
+	buttonClients     map[uint32]*ButtonClient
+	nextButtonClient  nextTouchesClient
+	player            *patternPlayer
+	led               LedStatus // Last requested led status
+	onPayment         func(payment SimulatedPayment)
+}
+
+// Compile time check for protocol compatibility
+var _ Machine = (*SimulatorMachine)(nil)
+
+// NewSimulatorMachine creates a simulator with the given number of
+// compartments, each of which has a motor of its own
+func NewSimulatorMachine(listen string, compartments int) *SimulatorMachine {
+	m := &SimulatorMachine{
+		listen:            listen,
+		faults:            make(map[string]bool),
+		feedClients:       make(map[uint32]chan SimulatorState),
+		touchesClients:    make(map[uint32]*TouchesClient),
+		nextTouchesClient: nextTouchesClient{id: 0},
+		buttonClients:     make(map[uint32]*ButtonClient),
+		nextButtonClient:  nextTouchesClient{id: 0},
+	}
+
+	now := time.Now()
+
+	m.state = SimulatorState{
+		Motors: []SimulatorMotorState{},
+		Buzzer: SimulatorBuzzerState{Changed: now},
+		Led:    SimulatorLedState{Color: ColorOff.String(), Blink: BlinkNone.String(), Changed: now},
+		Touch:  SimulatorTouchState{Changed: now},
+		Faults: []string{},
+	}
+
+	for compartment := 0; compartment < compartments || compartment == 0; compartment++ {
+		m.state.Motors = append(m.state.Motors, SimulatorMotorState{
+			Compartment: compartment,
+			Changed:     now,
+		})
+	}
+
+	m.player = newPatternPlayer(m.ToggleBuzzer)
+
+	return m
+}
+
+func (m *SimulatorMachine) Start() error {
+	m.server = &http.Server{
+		Addr:    m.listen,
+		Handler: m.newRouter(),
+	}
+
+	go func() {
+		err := m.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("Simulator stopped serving: %v", err)
+		}
+	}()
+
+	log.Infof("Simulator listening on %s", m.listen)
+
+	return nil
+}
+
+func (m *SimulatorMachine) Stop() error {
+	m.stopScenario()
+
+	if m.server != nil {
+		return m.server.Close()
+	}
+
+	return nil
+}
+
+// Compartments returns the ids of all simulated compartments
+func (m *SimulatorMachine) Compartments() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	compartments := []int{}
+	for _, motor := range m.state.Motors {
+		compartments = append(compartments, motor.Compartment)
+	}
+
+	return compartments
+}
+
+func (m *SimulatorMachine) DriveMotor(command MotorCommand) {
+	m.update(func(state *SimulatorState) {
+		if command.Compartment < 0 || command.Compartment >= len(state.Motors) {
+			log.Errorf("Compartment %d has no motor", command.Compartment)
+			return
+		}
+
+		state.Motors[command.Compartment] = SimulatorMotorState{
+			Compartment: command.Compartment,
+			On:          command.On,
+			Running:     command.On && !m.faults[SimulatorFaultMotorJammed],
+			Speed:       command.Speed,
+			RampUp:      int64(command.RampUp / time.Millisecond),
+			RampDown:    int64(command.RampDown / time.Millisecond),
+			Changed:     time.Now(),
+		}
+	})
+}
+
+func (m *SimulatorMachine) ToggleBuzzer(on bool) {
+	m.update(func(state *SimulatorState) {
+		if m.faults[SimulatorFaultBuzzerDead] {
+			on = false
+		}
+
+		if state.Buzzer.On == on {
+			return
+		}
+
+		state.Buzzer = SimulatorBuzzerState{On: on, Changed: time.Now()}
+	})
+}
+
+func (m *SimulatorMachine) DiagnosticNoise() {
+	m.PlayPattern(DiagnosticPattern, true)
+}
+
+func (m *SimulatorMachine) PlayPattern(pattern Pattern, interrupt bool) {
+	m.player.play(pattern, interrupt)
+}
+
+func (m *SimulatorMachine) SetLed(status LedStatus) {
+	m.update(func(state *SimulatorState) {
+		m.led = status
+
+		state.Led = SimulatorLedState{
+			Color:   status.Color.String(),
+			Blink:   status.Blink.String(),
+			Changed: time.Now(),
+		}
+	})
+}
+
+// GetState returns a snapshot of the simulated hardware
+func (m *SimulatorMachine) GetState() SimulatorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.snapshot()
+}
+
+// Touch simulates touching or releasing the touch sensor, as far as the
+// injected faults allow
+func (m *SimulatorMachine) Touch(on bool) {
+	m.mu.Lock()
+
+	if m.faults[SimulatorFaultTouchDead] || (m.faults[SimulatorFaultTouchStuck] && !on) {
+		m.mu.Unlock()
+		return
+	}
+
+	changed := m.state.Touch.On != on
+
+	if changed {
+		m.state.Touch = SimulatorTouchState{On: on, Changed: time.Now()}
+		m.publish()
+	}
+
+	m.mu.Unlock()
+
+	if changed {
+		m.notifyTouchesClients(on)
+	}
+}
+
+// PressButton simulates a press of the service button
+func (m *SimulatorMachine) PressButton(press ButtonPress) {
+	m.notifyButtonClients(press)
+}
+
+// SetPaymentHandler sets the handler of simulated payments
+func (m *SimulatorMachine) SetPaymentHandler(handler func(payment SimulatedPayment)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onPayment = handler
+}
+
+// Pay simulates a payment, which is ignored as long as no payment handler
+// was set
+func (m *SimulatorMachine) Pay(payment SimulatedPayment) {
+	m.mu.Lock()
+	onPayment := m.onPayment
+	m.mu.Unlock()
+
+	if onPayment == nil {
+		log.Warnf("Ignoring simulated payment %s without a payment handler", payment.RHash)
+		return
+	}
+
+	onPayment(payment)
+}
+
+// SetFault injects or clears a simulated hardware fault
+func (m *SimulatorMachine) SetFault(fault string, active bool) bool {
+	if !simulatorFaults[fault] {
+		return false
+	}
+
+	m.update(func(state *SimulatorState) {
+		if active {
+			m.faults[fault] = true
+		} else {
+			delete(m.faults, fault)
+		}
+
+		for i, motor := range state.Motors {
+			state.Motors[i].Running = motor.On && !m.faults[SimulatorFaultMotorJammed]
+		}
+
+		if m.faults[SimulatorFaultBuzzerDead] && state.Buzzer.On {
+			state.Buzzer = SimulatorBuzzerState{On: false, Changed: time.Now()}
+		}
+	})
+
+	if fault == SimulatorFaultTouchStuck && active {
+		m.Touch(true)
+	}
+
+	return true
+}
+
+// update changes the state under lock and publishes it to the feed
+func (m *SimulatorMachine) update(change func(state *SimulatorState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	change(&m.state)
+	m.publish()
+}
+
+// snapshot copies the state, expecting the lock to be held
+func (m *SimulatorMachine) snapshot() SimulatorState {
+	state := m.state
+
+	state.Motors = make([]SimulatorMotorState, len(m.state.Motors))
+	copy(state.Motors, m.state.Motors)
+
+	state.Faults = []string{}
+	for fault := range m.faults {
+		state.Faults = append(state.Faults, fault)
+	}
+
+	sort.Strings(state.Faults)
+
+	return state
+}
+
+// publish sends the latest state to all feed clients, expecting the lock
+// to be held. Slow clients skip intermediate states.
+func (m *SimulatorMachine) publish() {
+	state := m.snapshot()
+
+	for _, feed := range m.feedClients {
+		select {
+		case <-feed:
+		default:
+		}
+
+		feed <- state
+	}
+}
+
+func (m *SimulatorMachine) subscribeFeed() (uint32, <-chan SimulatorState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextFeedClient
+	m.nextFeedClient++
+
+	feed := make(chan SimulatorState, 1)
+	feed <- m.snapshot()
+
+	m.feedClients[id] = feed
+
+	return id, feed
+}
+
+func (m *SimulatorMachine) unsubscribeFeed(id uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.feedClients, id)
+}
+
+func (m *SimulatorMachine) SubscribeTouches() *TouchesClient {
+	client := &TouchesClient{
+		Touches:    make(chan bool),
+		cancelChan: make(chan struct{}),
+		machine:    m,
+	}
+
+	m.nextTouchesClient.Lock()
+	client.Id = m.nextTouchesClient.id
+	m.nextTouchesClient.id++
+	m.touchesClients[client.Id] = client
+	m.nextTouchesClient.Unlock()
+
+	return client
+}
+
+func (m *SimulatorMachine) notifyTouchesClients(touch bool) {
+	m.nextTouchesClient.Lock()
+	clients := make([]*TouchesClient, 0, len(m.touchesClients))
+	for _, client := range m.touchesClients {
+		clients = append(clients, client)
+	}
+	m.nextTouchesClient.Unlock()
+
+	for _, client := range clients {
+		select {
+		case client.Touches <- touch:
+		case <-client.cancelChan:
+		}
+	}
+}
+
+func (m *SimulatorMachine) unsubscribeTouches(client *TouchesClient) {
+	m.nextTouchesClient.Lock()
+	delete(m.touchesClients, client.Id)
+	m.nextTouchesClient.Unlock()
+
+	close(client.cancelChan)
+}
+
+func (m *SimulatorMachine) SubscribeButton() *ButtonClient {
+	client := &ButtonClient{
+		Presses:    make(chan ButtonPress),
+		cancelChan: make(chan struct{}),
+		machine:    m,
+	}
+
+	m.nextButtonClient.Lock()
+	client.Id = m.nextButtonClient.id
+	m.nextButtonClient.id++
+	m.buttonClients[client.Id] = client
+	m.nextButtonClient.Unlock()
+
+	return client
+}
+
+func (m *SimulatorMachine) notifyButtonClients(press ButtonPress) {
+	m.nextButtonClient.Lock()
+	clients := make([]*ButtonClient, 0, len(m.buttonClients))
+	for _, client := range m.buttonClients {
+		clients = append(clients, client)
+	}
+	m.nextButtonClient.Unlock()
+
+	for _, client := range clients {
+		select {
+		case client.Presses <- press:
+		case <-client.cancelChan:
+		}
+	}
+}
+
+func (m *SimulatorMachine) unsubscribeButton(client *ButtonClient) {
+	m.nextButtonClient.Lock()
+	delete(m.buttonClients, client.Id)
+	m.nextButtonClient.Unlock()
+
+	close(client.cancelChan)
+}
+
+// SelfTest pulses the motor and cycles the buzzer and status led, which
+// fails as far as the injected faults affect them
+func (m *SimulatorMachine) SelfTest() *SelfTestReport {
+	report := newSelfTestReport()
+
+	touched := m.GetState().Touch.On
+
+	for _, compartment := range m.Compartments() {
+		m.DriveMotor(MotorFullSpeed.forCompartment(compartment))
+		running := m.GetState().Motors[compartment].Running
+		time.Sleep(selfTestPulse)
+		m.DriveMotor(MotorStop.forCompartment(compartment))
+
+		if running {
+			report.pass(SelfTestMotor, "motor of compartment %d turned", compartment)
+		} else {
+			report.fail(SelfTestMotor, "motor of compartment %d did not turn", compartment)
+		}
+	}
+
+	m.ToggleBuzzer(true)
+	buzzing := m.GetState().Buzzer.On
+	time.Sleep(selfTestPulse)
+	m.ToggleBuzzer(false)
+
+	if buzzing {
+		report.pass(SelfTestBuzzer, "buzzer turned on and off")
+	} else {
+		report.fail(SelfTestBuzzer, "buzzer did not turn on")
+	}
+
+	m.mu.Lock()
+	previous := m.led
+	m.mu.Unlock()
+
+	for _, color := range selfTestColors {
+		m.SetLed(LedStatus{Color: color})
+		time.Sleep(selfTestPulse)
+	}
+
+	m.SetLed(previous)
+
+	report.unverified(SelfTestLed, "status led cycled through %d colors, but has no feedback to verify them", len(selfTestColors))
+
+	if touched && m.GetState().Touch.On {
+		report.fail(SelfTestTouch, "touch sensor reported a touch throughout the test and may be stuck")
+	} else {
+		report.pass(SelfTestTouch, "touch sensor reads released")
+	}
+
+	report.pass(SelfTestButton, "service button reads released")
+
+	return report.finish()
+}
@@ -0,0 +1,245 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type scenarioStepRequest struct {
+	Action      string `json:"action"`
+	Value       string `json:"value"`
+	Duration    int64  `json:"duration"`
+	MSat        int64  `json:"msat"`
+	Compartment int    `json:"compartment"`
+}
+
+type scenarioRequest struct {
+	Name  string                `json:"name"`
+	Steps []scenarioStepRequest `json:"steps"`
+}
+
+type faultRequest struct {
+	Fault  string `json:"fault"`
+	Active bool   `json:"active"`
+}
+
+// newRouter serves the simulator panel and its controls on a mux of its
+// own, so it never collides with handlers of the default mux
+func (m *SimulatorMachine) newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", m.handlePanel)
+	mux.HandleFunc("/state", m.handleGetState)
+	mux.HandleFunc("/state/feed", m.handleStateFeed())
+	mux.HandleFunc("/touch/on", m.handleTouch(true))
+	mux.HandleFunc("/touch/off", m.handleTouch(false))
+	mux.HandleFunc("/button/short", m.handleButton(ButtonPressShort))
+	mux.HandleFunc("/button/long", m.handleButton(ButtonPressLong))
+	mux.HandleFunc("/button/verylong", m.handleButton(ButtonPressVeryLong))
+	mux.HandleFunc("/fault", m.handleFault)
+	mux.HandleFunc("/scenario", m.handleScenario)
+	mux.HandleFunc("/replay", m.handleReplay)
+
+	return mux
+}
+
+func (m *SimulatorMachine) jsonResponse(w http.ResponseWriter, res interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Errorf("Could not write simulator response: %v", err)
+	}
+}
+
+func (m *SimulatorMachine) textResponse(w http.ResponseWriter, text string, code int) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	w.Write([]byte(text))
+}
+
+func (m *SimulatorMachine) handlePanel(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(simulatorPanel))
+}
+
+func (m *SimulatorMachine) handleGetState(w http.ResponseWriter, r *http.Request) {
+	m.jsonResponse(w, m.GetState(), http.StatusOK)
+}
+
+// handleTouch is kept compatible with the former mock machine, which
+// accepted touches with any method
+func (m *SimulatorMachine) handleTouch(on bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.Touch(on)
+		m.textResponse(w, "OK", http.StatusOK)
+	}
+}
+
+func (m *SimulatorMachine) handleButton(press ButtonPress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.PressButton(press)
+		m.textResponse(w, "OK", http.StatusOK)
+	}
+}
+
+func (m *SimulatorMachine) handleFault(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		m.textResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req faultRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		m.textResponse(w, fmt.Sprintf("Could not parse fault: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !m.SetFault(req.Fault, req.Active) {
+		m.textResponse(w, fmt.Sprintf("Unknown fault %s", req.Fault), http.StatusBadRequest)
+		return
+	}
+
+	m.jsonResponse(w, m.GetState(), http.StatusOK)
+}
+
+func (m *SimulatorMachine) handleScenario(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req scenarioRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			m.textResponse(w, fmt.Sprintf("Could not parse scenario: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		scenario := &Scenario{Name: req.Name}
+
+		for _, step := range req.Steps {
+			scenario.Steps = append(scenario.Steps, ScenarioStep{
+				Action:      step.Action,
+				Value:       step.Value,
+				Duration:    time.Duration(step.Duration) * time.Millisecond,
+				MSat:        step.MSat,
+				Compartment: step.Compartment,
+			})
+		}
+
+		err = m.RunScenario(scenario)
+		if err != nil {
+			m.textResponse(w, fmt.Sprintf("Invalid scenario: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		m.jsonResponse(w, m.GetState(), http.StatusOK)
+	case http.MethodDelete:
+		m.StopScenario()
+
+		m.jsonResponse(w, m.GetState(), http.StatusOK)
+	default:
+		m.textResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleReplay runs a recording of hardware events that is posted one
+// JSON object per line
+func (m *SimulatorMachine) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		m.textResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	recording, err := readRecording(r.Body)
+	if err != nil {
+		m.textResponse(w, fmt.Sprintf("Could not parse recording: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = m.RunScenario(NewReplayScenario("replay", recording))
+	if err != nil {
+		m.textResponse(w, fmt.Sprintf("Invalid recording: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	m.jsonResponse(w, m.GetState(), http.StatusOK)
+}
+
+// handleStateFeed streams the simulator state over a websocket whenever
+// it changes
+func (m *SimulatorMachine) handleStateFeed() http.HandlerFunc {
+	upgrader := &websocket.Upgrader{}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Errorf("unable to upgrade: %v", err)
+			return
+		}
+
+		id, feed := m.subscribeFeed()
+		closed := make(chan struct{})
+
+		// read pump
+		go func() {
+			defer close(closed)
+
+			c.SetReadLimit(512)
+			c.SetReadDeadline(time.Now().Add(60 * time.Second))
+			c.SetPongHandler(func(string) error {
+				c.SetReadDeadline(time.Now().Add(60 * time.Second))
+				return nil
+			})
+
+			for {
+				_, _, err := c.ReadMessage()
+				if err != nil {
+					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+						log.Errorf("unexpected websocket closure: %v", err)
+					}
+					break
+				}
+			}
+		}()
+
+		// write pump
+		go func() {
+			defer c.Close()
+			defer m.unsubscribeFeed(id)
+
+			ticker := time.NewTicker(54 * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case state := <-feed:
+					c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+					err := c.WriteJSON(state)
+					if err != nil {
+						return
+					}
+				case <-ticker.C:
+					c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+					if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		}()
+	}
+}
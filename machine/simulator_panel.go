@@ -0,0 +1,128 @@
+package machine
+
+// simulatorPanel is a tiny page to watch and control the simulator
+const simulatorPanel = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sweetd simulator</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  .part { display: inline-block; width: 10em; margin: 0 1em 1em 0; padding: 1em; border: 1px solid #ccc; border-radius: 4px; }
+  .on { background: #cfc; }
+  .fault { background: #fcc; }
+  button { margin: 0 .5em .5em 0; }
+  textarea { width: 40em; height: 10em; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>sweetd simulator</h1>
+
+<div>
+  <span id="motors"></span>
+  <div class="part" id="buzzer">Buzzer</div>
+  <div class="part" id="led">LED</div>
+  <div class="part" id="touch">Touch</div>
+</div>
+
+<h2>Controls</h2>
+<div>
+  <button id="touchButton">Hold to touch</button>
+  <button onclick="post('/button/short')">Button short</button>
+  <button onclick="post('/button/long')">Button long</button>
+  <button onclick="post('/button/verylong')">Button very long</button>
+</div>
+
+<h2>Faults</h2>
+<div id="faults"></div>
+
+<h2>Scenario <span id="scenario"></span></h2>
+<textarea id="scenarioInput">{
+  "name": "double tap",
+  "steps": [
+    {"action": "touch", "duration": 100},
+    {"action": "wait", "duration": 100},
+    {"action": "touch", "duration": 100}
+  ]
+}</textarea>
+<div>
+  <button onclick="post('/scenario', document.getElementById('scenarioInput').value)">Run</button>
+  <button onclick="fetch('/scenario', {method: 'DELETE'})">Stop</button>
+</div>
+
+<h2>Replay</h2>
+<div>
+  <input type="file" id="replayInput">
+  <button onclick="replay()">Replay</button>
+</div>
+
+<script>
+  var faults = ['touchDead', 'touchStuck', 'motorJammed', 'buzzerDead'];
+
+  function post(path, body) {
+    return fetch(path, {method: 'POST', body: body});
+  }
+
+  function replay() {
+    var file = document.getElementById('replayInput').files[0];
+    if (file) {
+      post('/replay', file);
+    }
+  }
+
+  function since(time) {
+    return Math.round((Date.now() - new Date(time).getTime()) / 1000) + 's ago';
+  }
+
+  function part(id, on, text, changed) {
+    var el = document.getElementById(id);
+    if (!el) {
+      el = document.createElement('div');
+      el.id = id;
+      document.getElementById('motors').appendChild(el);
+    }
+    el.className = 'part' + (on ? ' on' : '');
+    el.innerHTML = '<b>' + id + '</b><br>' + text + '<br><small>' + since(changed) + '</small>';
+  }
+
+  function render(state) {
+    state.motors.forEach(function (motor) {
+      part('motor ' + motor.compartment, motor.on,
+        (motor.on ? (motor.running ? 'running' : 'jammed') + ' at ' + motor.speed : 'off'),
+        motor.changed);
+    });
+    part('buzzer', state.buzzer.on, state.buzzer.on ? 'buzzing' : 'silent', state.buzzer.changed);
+    part('led', state.led.color !== 'off', state.led.color + ', blink ' + state.led.blink, state.led.changed);
+    part('touch', state.touch.on, state.touch.on ? 'touched' : 'released', state.touch.changed);
+
+    var el = document.getElementById('faults');
+    el.innerHTML = '';
+    faults.forEach(function (fault) {
+      var active = state.faults.indexOf(fault) !== -1;
+      var button = document.createElement('button');
+      button.textContent = fault + (active ? ' (active)' : '');
+      button.className = active ? 'fault' : '';
+      button.onclick = function () {
+        post('/fault', JSON.stringify({fault: fault, active: !active}));
+      };
+      el.appendChild(button);
+    });
+
+    document.getElementById('scenario').textContent = state.scenario ? '(running ' + state.scenario + ')' : '';
+  }
+
+  var touchButton = document.getElementById('touchButton');
+  touchButton.onmousedown = function () { post('/touch/on'); };
+  touchButton.onmouseup = function () { post('/touch/off'); };
+
+  function connect() {
+    var ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/state/feed');
+    ws.onmessage = function (message) { render(JSON.parse(message.data)); };
+    ws.onclose = function () { setTimeout(connect, 1000); };
+  }
+
+  connect();
+</script>
+</body>
+</html>
+`
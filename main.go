@@ -10,6 +10,7 @@ import (
 	"github.com/the-lightning-land/sweetd/network"
 	"github.com/the-lightning-land/sweetd/nodeman"
 	"github.com/the-lightning-land/sweetd/pairing"
+	"github.com/the-lightning-land/sweetd/state"
 	"github.com/the-lightning-land/sweetd/sweetdb"
 	"github.com/the-lightning-land/sweetd/sweetlog"
 	"github.com/the-lightning-land/sweetd/updater"
@@ -17,6 +18,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"time"
 
 	// Blank import to set up profiling HTTP handlers.
 	_ "net/http/pprof"
@@ -151,24 +153,79 @@ func sweetdMain() error {
 	// hardware machine controller
 	var m machine.Machine
 
+	// simulator is set if the machine is simulated
+	var simulator *machine.SimulatorMachine
+
+	// replay is the path of a recording to replay into the simulator
+	replay := ""
+
 	switch cfg.Machine {
 	case "raspberry":
+		var profile *machine.HardwareProfile
+
+		if cfg.Raspberry.Profile != "" {
+			profile, err = machine.LoadHardwareProfile(cfg.Raspberry.Profile)
+			if err != nil {
+				return err
+			}
+		} else {
+			// without a profile file, the pin flags describe the wiring
+			profile = machine.NewHardwareProfile(machine.PinFlags{
+				TouchPin:    cfg.Raspberry.TouchPin,
+				ButtonPin:   cfg.Raspberry.ButtonPin,
+				MotorPin:    cfg.Raspberry.MotorPin,
+				BuzzerPin:   cfg.Raspberry.BuzzerPin,
+				LedPin:      cfg.Raspberry.LedPin,
+				LedRedPin:   cfg.Raspberry.LedRedPin,
+				LedGreenPin: cfg.Raspberry.LedGreenPin,
+				LedBluePin:  cfg.Raspberry.LedBluePin,
+			})
+		}
+
+		err = profile.Validate()
+		if err != nil {
+			return errors.Errorf("Invalid hardware profile %s: %v", profile.Name, err)
+		}
+
 		m = machine.NewDispenserMachine(&machine.DispenserMachineConfig{
-			TouchPin:  cfg.Raspberry.TouchPin,
-			MotorPin:  cfg.Raspberry.MotorPin,
-			BuzzerPin: cfg.Raspberry.BuzzerPin,
+			Profile:       profile,
+			TouchDebounce: cfg.Raspberry.TouchDebounce,
 		})
 
-		log.Infof("Created Raspberry Pi machine on touch pin %v, motor pin %v and buzzer pin %v.",
-			cfg.Raspberry.TouchPin, cfg.Raspberry.MotorPin, cfg.Raspberry.BuzzerPin)
+		log.Infof("Created Raspberry Pi machine with hardware profile %s.", profile.Name)
+	case "simulator":
+		simulator = machine.NewSimulatorMachine(cfg.Simulator.Listen, cfg.Simulator.Compartments)
+		replay = cfg.Simulator.Replay
+		m = simulator
+
+		log.Info("Created a simulator machine.")
 	case "mock":
-		m = machine.NewMockMachine(cfg.Mock.Listen)
+		// the mock machine was superseded by the simulator
+		simulator = machine.NewSimulatorMachine(cfg.Mock.Listen, 1)
+		replay = cfg.Mock.Replay
+		m = simulator
 
-		log.Info("Created a mock machine.")
+		log.Warn("The mock machine is deprecated, created a simulator machine instead.")
 	default:
 		return errors.Errorf("Unknown machine type %v", cfg.Machine)
 	}
 
+	// recorder writes hardware events to a file for later replay
+	var recorder *machine.Recorder
+
+	if cfg.Record != "" {
+		recorder, err = machine.NewRecorder(cfg.Record)
+		if err != nil {
+			return err
+		}
+
+		defer recorder.Close()
+
+		m = machine.NewRecordingMachine(m, recorder)
+
+		log.Infof("Recording hardware events to %s.", cfg.Record)
+	}
+
 	if err := m.Start(); err != nil {
 		return errors.Errorf("Could not start machine: %v", err)
 	}
@@ -243,19 +300,34 @@ func sweetdMain() error {
 
 	// central controller for everything the dispenser does
 	dispenser := dispenser.NewDispenser(&dispenser.Config{
-		Nodeman:  nodeman,
-		Machine:  m,
-		DB:       sweetDB,
-		Updater:  u,
-		SweetLog: sweetLog,
-		Logger:   log.WithField("system", "dispenser"),
-		Tor:      t,
-		Network:  net,
-		Pairing:  pairingAdapter.Pairing,
+		Nodeman:        nodeman,
+		Machine:        m,
+		DB:             sweetDB,
+		Updater:        u,
+		SweetLog:       sweetLog,
+		Logger:         log.WithField("system", "dispenser"),
+		Tor:            t,
+		Network:        net,
+		Pairing:        pairingAdapter.Pairing,
+		SelfTestOnBoot: cfg.SelfTest,
+		Recorder:       recorder,
 	})
 
 	pairingAdapter.Dispenser = dispenser
 
+	if simulator != nil {
+		simulator.SetPaymentHandler(dispenser.SimulatePayment)
+	}
+
+	if replay != "" {
+		recording, err := machine.LoadRecording(replay)
+		if err != nil {
+			return err
+		}
+
+		go replayWhenStarted(dispenser, simulator, machine.NewReplayScenario(replay, recording))
+	}
+
 	log.Infof("created dispenser")
 
 	err = pairingAdapter.Pairing.Start()
@@ -294,6 +366,21 @@ func sweetdMain() error {
 	return nil
 }
 
+// replayWhenStarted is run as a goroutine and replays a recording into the
+// simulator as soon as the dispenser listens to its touches
+func replayWhenStarted(d *dispenser.Dispenser, simulator *machine.SimulatorMachine, scenario *machine.Scenario) {
+	for d.GetState() != state.StateStarted {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	log.Infof("Replaying recording %s.", scenario.Name)
+
+	err := simulator.RunScenario(scenario)
+	if err != nil {
+		log.Errorf("Could not replay recording %s: %v", scenario.Name, err)
+	}
+}
+
 func main() {
 	// Call the "real" main in a nested manner so the defers will properly
 	// be executed in the case of a graceful shutdown.
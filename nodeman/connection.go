@@ -0,0 +1,67 @@
+package nodeman
+
+import (
+	"github.com/the-lightning-land/sweetd/lightning"
+	"github.com/the-lightning-land/sweetd/sweetdb"
+)
+
+// invoiceIndexStore persists how far the invoices of a node were seen
+type invoiceIndexStore struct {
+	db     *sweetdb.DB
+	nodeID string
+}
+
+// Compile time check for protocol compatibility
+var _ lightning.InvoiceIndexStore = (*invoiceIndexStore)(nil)
+
+func (n *Nodeman) newInvoiceIndexStore(nodeID string) *invoiceIndexStore {
+	return &invoiceIndexStore{
+		db:     n.db,
+		nodeID: nodeID,
+	}
+}
+
+func (s *invoiceIndexStore) GetInvoiceIndex() (lightning.InvoiceIndex, error) {
+	index, err := s.db.GetInvoiceIndex(s.nodeID)
+	if err != nil {
+		return lightning.InvoiceIndex{}, err
+	}
+
+	return lightning.InvoiceIndex{
+		AddIndex:    index.AddIndex,
+		SettleIndex: index.SettleIndex,
+	}, nil
+}
+
+func (s *invoiceIndexStore) SetInvoiceIndex(index lightning.InvoiceIndex) error {
+	return s.db.SetInvoiceIndex(s.nodeID, &sweetdb.InvoiceIndex{
+		AddIndex:    index.AddIndex,
+		SettleIndex: index.SettleIndex,
+	})
+}
+
+// connectionStateReporter returns the callback a node reports changes of
+// its connection state to
+func (n *Nodeman) connectionStateReporter(nodeID string) func(state string) {
+	return func(state string) {
+		n.connectionStatesMutex.Lock()
+		n.connectionStates[nodeID] = state
+		n.connectionStatesMutex.Unlock()
+
+		n.log.Infof("node %s is %s", nodeID, state)
+	}
+}
+
+// GetConnectionState tells if the invoice subscription of a node is
+// connected. Nodes that never reported a state are disconnected.
+func (n *Nodeman) GetConnectionState(nodeID string) string {
+	n.connectionStatesMutex.Lock()
+	defer n.connectionStatesMutex.Unlock()
+
+	state, ok := n.connectionStates[nodeID]
+	if !ok {
+		return lightning.ConnectionStateDisconnected
+	}
+
+	return state
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/the-lightning-land/sweetd/lightning"
 	"github.com/the-lightning-land/sweetd/sweetdb"
 	"path/filepath"
+	"sync"
 )
 
 type Nodeman struct {
@@ -24,6 +25,19 @@ type Nodeman struct {
 
 	// log
 	log Logger
+
+	// connectionStates tell if the invoice subscription of each node is
+	// connected, as reported by the nodes
+	connectionStates map[string]string
+
+	// connectionStatesMutex guards the connection states
+	connectionStatesMutex sync.Mutex
+
+	// statuses are the results of the last status check of each node
+	statuses map[string]*lightning.NodeStatus
+
+	// statusesMutex guards the statuses
+	statusesMutex sync.Mutex
 }
 
 type Config struct {
@@ -41,10 +55,12 @@ type LogCreator func(node string) Logger
 
 func New(config *Config) *Nodeman {
 	nodeman := &Nodeman{
-		nodes:        nil,
-		nodesDataDir: config.NodesDataDir,
-		db:           config.DB,
-		logCreator:   config.LogCreator,
+		nodes:            nil,
+		nodesDataDir:     config.NodesDataDir,
+		db:               config.DB,
+		logCreator:       config.LogCreator,
+		connectionStates: make(map[string]string),
+		statuses:         make(map[string]*lightning.NodeStatus),
 	}
 
 	if config.LogCreator != nil {
@@ -65,11 +81,38 @@ func (n *Nodeman) Load() {
 	for _, node := range nodes {
 		switch node := node.(type) {
 		case *sweetdb.RemoteLndNode:
+			if node.Rest {
+				restNode, err := lightning.NewLndRestNode(&lightning.LndRestNodeConfig{
+					Uri:               node.Url,
+					CertBytes:         node.Cert,
+					MacaroonBytes:     node.Macaroon,
+					Logger:            n.logCreator(node.Id),
+					IndexStore:        n.newInvoiceIndexStore(node.Id),
+					OnConnectionState: n.connectionStateReporter(node.Id),
+				})
+				if err != nil {
+					n.log.Errorf("unable to create node: %v", err)
+					continue
+				}
+
+				n.nodes = append(n.nodes, &RemoteLndRestNode{
+					LndRestNode: restNode,
+					id:          node.Id,
+					name:        node.Name,
+					enabled:     node.Enabled,
+					Uri:         node.Url,
+				})
+
+				continue
+			}
+
 			lndNode, err := lightning.NewLndNode(&lightning.LndNodeConfig{
-				Uri:           node.Url,
-				CertBytes:     node.Cert,
-				MacaroonBytes: node.Macaroon,
-				Logger:        n.log,
+				Uri:               node.Url,
+				CertBytes:         node.Cert,
+				MacaroonBytes:     node.Macaroon,
+				Logger:            n.log,
+				IndexStore:        n.newInvoiceIndexStore(node.Id),
+				OnConnectionState: n.connectionStateReporter(node.Id),
 			})
 			if err != nil {
 				n.log.Errorf("unable to create node: %v", err)
@@ -84,8 +127,10 @@ func (n *Nodeman) Load() {
 			})
 		case *sweetdb.LocalNode:
 			localNode, err := lightning.NewLocalNode(&lightning.LocalNodeConfig{
-				DataDir: filepath.Join(n.nodesDataDir, node.Id),
-				Logger:  n.logCreator(node.Id),
+				DataDir:           filepath.Join(n.nodesDataDir, node.Id),
+				Logger:            n.logCreator(node.Id),
+				IndexStore:        n.newInvoiceIndexStore(node.Id),
+				OnConnectionState: n.connectionStateReporter(node.Id),
 			})
 			if err != nil {
 				n.log.Errorf("unable to create node: %v", err)
@@ -97,6 +142,25 @@ func (n *Nodeman) Load() {
 				name:      node.Name,
 				enabled:   node.Enabled,
 			})
+		case *sweetdb.ClnNode:
+			clnNode, err := lightning.NewClnNode(&lightning.ClnNodeConfig{
+				SocketPath:        node.SocketPath,
+				Logger:            n.logCreator(node.Id),
+				IndexStore:        n.newInvoiceIndexStore(node.Id),
+				OnConnectionState: n.connectionStateReporter(node.Id),
+			})
+			if err != nil {
+				n.log.Errorf("unable to create node: %v", err)
+				continue
+			}
+
+			n.nodes = append(n.nodes, &ClnNode{
+				ClnNode:    clnNode,
+				id:         node.Id,
+				name:       node.Name,
+				enabled:    node.Enabled,
+				SocketPath: node.SocketPath,
+			})
 		default:
 			n.log.Errorf("unknown node type %T", node)
 		}
@@ -127,6 +191,51 @@ func (n *Nodeman) AddNode(config NodeConfig) (LightningNode, error) {
 	case *RemoteLndNodeConfig:
 		n.log.Infof("adding remote lnd node with id %s", id)
 
+		var node LightningNode
+
+		if config.Rest {
+			restNode, err := lightning.NewLndRestNode(&lightning.LndRestNodeConfig{
+				Uri:               config.Uri,
+				CertBytes:         config.Cert,
+				MacaroonBytes:     config.Macaroon,
+				Logger:            n.logCreator(id.String()),
+				IndexStore:        n.newInvoiceIndexStore(id.String()),
+				OnConnectionState: n.connectionStateReporter(id.String()),
+			})
+			if err != nil {
+				return nil, errors.Errorf("unable to create: %v", err)
+			}
+
+			node = &RemoteLndRestNode{
+				LndRestNode: restNode,
+				id:          id.String(),
+				name:        config.Name,
+				enabled:     false,
+				Uri:         config.Uri,
+			}
+		} else {
+			lndNode, err := lightning.NewLndNode(&lightning.LndNodeConfig{
+				Uri:               config.Uri,
+				CertBytes:         config.Cert,
+				MacaroonBytes:     config.Macaroon,
+				Logger:            n.logCreator(id.String()),
+				IndexStore:        n.newInvoiceIndexStore(id.String()),
+				OnConnectionState: n.connectionStateReporter(id.String()),
+			})
+			if err != nil {
+				return nil, errors.Errorf("unable to create: %v", err)
+			}
+
+			node = &RemoteLndNode{
+				LndNode: lndNode,
+				id:      id.String(),
+				name:    config.Name,
+				enabled: false,
+				Uri:     config.Uri,
+			}
+		}
+
+		// only nodes that could be created are saved
 		err := n.db.SaveNode(&sweetdb.RemoteLndNode{
 			Id:       id.String(),
 			Name:     config.Name,
@@ -134,29 +243,12 @@ func (n *Nodeman) AddNode(config NodeConfig) (LightningNode, error) {
 			Cert:     config.Cert,
 			Macaroon: config.Macaroon,
 			Enabled:  false,
+			Rest:     config.Rest,
 		})
 		if err != nil {
 			return nil, errors.Errorf("unable to save: %v", err)
 		}
 
-		lndNode, err := lightning.NewLndNode(&lightning.LndNodeConfig{
-			Uri:           config.Uri,
-			CertBytes:     config.Cert,
-			MacaroonBytes: config.Macaroon,
-			Logger:        n.logCreator(id.String()),
-		})
-		if err != nil {
-			return nil, errors.Errorf("unable to create: %v", err)
-		}
-
-		node := &RemoteLndNode{
-			LndNode: lndNode,
-			id:      id.String(),
-			name:    config.Name,
-			enabled: false,
-			Uri:     config.Uri,
-		}
-
 		n.nodes = append(n.nodes, node)
 
 		return node, nil
@@ -173,8 +265,10 @@ func (n *Nodeman) AddNode(config NodeConfig) (LightningNode, error) {
 		}
 
 		localNode, err := lightning.NewLocalNode(&lightning.LocalNodeConfig{
-			DataDir: filepath.Join(n.nodesDataDir, id.String()),
-			Logger:  n.logCreator(id.String()),
+			DataDir:           filepath.Join(n.nodesDataDir, id.String()),
+			Logger:            n.logCreator(id.String()),
+			IndexStore:        n.newInvoiceIndexStore(id.String()),
+			OnConnectionState: n.connectionStateReporter(id.String()),
 		})
 		if err != nil {
 			return nil, errors.Errorf("unable to create: %v", err)
@@ -189,6 +283,40 @@ func (n *Nodeman) AddNode(config NodeConfig) (LightningNode, error) {
 
 		n.nodes = append(n.nodes, node)
 
+		return node, nil
+	case *ClnNodeConfig:
+		n.log.Infof("adding core lightning node with id %s", id)
+
+		clnNode, err := lightning.NewClnNode(&lightning.ClnNodeConfig{
+			SocketPath:        config.SocketPath,
+			Logger:            n.logCreator(id.String()),
+			IndexStore:        n.newInvoiceIndexStore(id.String()),
+			OnConnectionState: n.connectionStateReporter(id.String()),
+		})
+		if err != nil {
+			return nil, errors.Errorf("unable to create: %v", err)
+		}
+
+		err = n.db.SaveNode(&sweetdb.ClnNode{
+			Id:         id.String(),
+			Name:       config.Name,
+			SocketPath: config.SocketPath,
+			Enabled:    false,
+		})
+		if err != nil {
+			return nil, errors.Errorf("unable to save: %v", err)
+		}
+
+		node := &ClnNode{
+			ClnNode:    clnNode,
+			id:         id.String(),
+			name:       config.Name,
+			enabled:    false,
+			SocketPath: config.SocketPath,
+		}
+
+		n.nodes = append(n.nodes, node)
+
 		return node, nil
 	default:
 		return nil, errors.Errorf("unknown config type %T", config)
@@ -212,6 +340,14 @@ func (n *Nodeman) RemoveNode(id string) error {
 		return errors.Errorf("unavailable")
 	}
 
+	n.connectionStatesMutex.Lock()
+	delete(n.connectionStates, id)
+	n.connectionStatesMutex.Unlock()
+
+	n.statusesMutex.Lock()
+	delete(n.statuses, id)
+	n.statusesMutex.Unlock()
+
 	copy(n.nodes[index:], n.nodes[index+1:]) // shift a[i+1:] left one index
 	n.nodes[len(n.nodes)-1] = nil            // erase last element
 	n.nodes = n.nodes[:len(n.nodes)-1]       // truncate slice
@@ -226,9 +362,11 @@ func (n *Nodeman) EnableNode(id string) error {
 	}
 
 	switch node := node.(type) {
-	case sweetdb.RemoteLndNode:
+	case *sweetdb.RemoteLndNode:
+		node.Enabled = true
+	case *sweetdb.LocalNode:
 		node.Enabled = true
-	case sweetdb.LocalNode:
+	case *sweetdb.ClnNode:
 		node.Enabled = true
 	}
 
@@ -255,9 +393,11 @@ func (n *Nodeman) DisableNode(id string) error {
 	}
 
 	switch node := node.(type) {
-	case sweetdb.RemoteLndNode:
+	case *sweetdb.RemoteLndNode:
 		node.Enabled = false
-	case sweetdb.LocalNode:
+	case *sweetdb.LocalNode:
+		node.Enabled = false
+	case *sweetdb.ClnNode:
 		node.Enabled = false
 	}
 
@@ -270,6 +410,11 @@ func (n *Nodeman) DisableNode(id string) error {
 		if node.ID() == id {
 			node.setEnabled(false)
 
+			// a disabled node is not checked anymore
+			n.statusesMutex.Lock()
+			delete(n.statuses, id)
+			n.statusesMutex.Unlock()
+
 			return nil
 		}
 	}
@@ -284,9 +429,11 @@ func (n *Nodeman) RenameNode(id string, name string) error {
 	}
 
 	switch node := node.(type) {
-	case sweetdb.RemoteLndNode:
+	case *sweetdb.RemoteLndNode:
 		node.Name = name
-	case sweetdb.LocalNode:
+	case *sweetdb.LocalNode:
+		node.Name = name
+	case *sweetdb.ClnNode:
 		node.Name = name
 	}
 
@@ -298,6 +445,8 @@ func (n *Nodeman) RenameNode(id string, name string) error {
 	for _, node := range n.nodes {
 		if node.ID() == id {
 			node.setName(name)
+
+			return nil
 		}
 	}
 
@@ -0,0 +1,84 @@
+package nodeman
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/the-lightning-land/sweetd/lightning"
+	"time"
+)
+
+// statusPollInterval is how often the status of every enabled node is
+// checked
+const statusPollInterval = 30 * time.Second
+
+// PollStatuses checks the status of all enabled nodes periodically, until
+// the done channel is closed
+func (n *Nodeman) PollStatuses(done <-chan struct{}) {
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, node := range n.GetNodes() {
+			if node.Enabled() {
+				n.RefreshStatus(node)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// RefreshStatus checks the status of a node right away and remembers it.
+// A failed check keeps the node marked unreachable along with the error.
+func (n *Nodeman) RefreshStatus(node LightningNode) *lightning.NodeStatus {
+	previous := n.GetStatus(node.ID())
+
+	var status *lightning.NodeStatus
+	var err error
+
+	if statusNode, ok := node.(lightning.StatusNode); ok {
+		status, err = statusNode.GetStatus()
+	} else {
+		err = errors.Errorf("node of type %T can not be checked", node)
+	}
+
+	if err != nil {
+		n.log.Errorf("could not check status of node %s: %v", node.ID(), err)
+
+		status = &lightning.NodeStatus{
+			Reachable:   false,
+			LastError:   err.Error(),
+			LastErrorAt: time.Now(),
+			Checked:     time.Now(),
+		}
+	} else {
+		status.LastError = previous.LastError
+		status.LastErrorAt = previous.LastErrorAt
+	}
+
+	n.statusesMutex.Lock()
+	n.statuses[node.ID()] = status
+	n.statusesMutex.Unlock()
+
+	return status
+}
+
+// GetStatus returns the last known status of a node along with the current
+// state of its invoice subscription. Nodes that were never checked are
+// unreachable.
+func (n *Nodeman) GetStatus(id string) lightning.NodeStatus {
+	status := lightning.NodeStatus{}
+
+	n.statusesMutex.Lock()
+	if checked, ok := n.statuses[id]; ok {
+		status = *checked
+	}
+	n.statusesMutex.Unlock()
+
+	status.ConnectionState = n.GetConnectionState(id)
+
+	return status
+}
@@ -9,12 +9,20 @@ type RemoteLndNodeConfig struct {
 	Uri      string
 	Cert     []byte
 	Macaroon []byte
+
+	// Rest connects through the REST proxy instead of gRPC
+	Rest bool
 }
 
 type LocalNodeConfig struct {
 	Name string
 }
 
+type ClnNodeConfig struct {
+	Name       string
+	SocketPath string
+}
+
 type LightningNode interface {
 	lightning.Node
 	ID() string
@@ -38,6 +46,20 @@ func (n *RemoteLndNode) setName(name string)     { n.name = name }
 func (n *RemoteLndNode) Enabled() bool           { return n.enabled }
 func (n *RemoteLndNode) setEnabled(enabled bool) { n.enabled = enabled }
 
+type RemoteLndRestNode struct {
+	*lightning.LndRestNode
+	id      string
+	name    string
+	enabled bool
+	Uri     string
+}
+
+func (n *RemoteLndRestNode) ID() string              { return n.id }
+func (n *RemoteLndRestNode) Name() string            { return n.name }
+func (n *RemoteLndRestNode) setName(name string)     { n.name = name }
+func (n *RemoteLndRestNode) Enabled() bool           { return n.enabled }
+func (n *RemoteLndRestNode) setEnabled(enabled bool) { n.enabled = enabled }
+
 type LocalNode struct {
 	*lightning.LocalNode
 	id      string
@@ -50,3 +72,17 @@ func (n *LocalNode) Name() string            { return n.name }
 func (n *LocalNode) setName(name string)     { n.name = name }
 func (n *LocalNode) Enabled() bool           { return n.enabled }
 func (n *LocalNode) setEnabled(enabled bool) { n.enabled = enabled }
+
+type ClnNode struct {
+	*lightning.ClnNode
+	id         string
+	name       string
+	enabled    bool
+	SocketPath string
+}
+
+func (n *ClnNode) ID() string              { return n.id }
+func (n *ClnNode) Name() string            { return n.name }
+func (n *ClnNode) setName(name string)     { n.name = name }
+func (n *ClnNode) Enabled() bool           { return n.enabled }
+func (n *ClnNode) setEnabled(enabled bool) { n.enabled = enabled }
@@ -6,14 +6,20 @@ import (
 )
 
 type errorMessage struct {
-	Error string `json:"error"`
+	Error  string `json:"error"`
+	Reason string `json:"reason,omitempty"`
 }
 
 func (p *Handler) jsonError(w http.ResponseWriter, error string, code int) {
+	p.jsonErrorWithReason(w, error, "", code)
+}
+
+func (p *Handler) jsonErrorWithReason(w http.ResponseWriter, error string, reason string, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	err := json.NewEncoder(w).Encode(&errorMessage{
-		Error: error,
+		Error:  error,
+		Reason: reason,
 	})
 	if err != nil {
 		p.log.Errorf("Could not respond with error: %v", err)
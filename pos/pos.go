@@ -2,11 +2,13 @@ package pos
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/gobuffalo/packr/v2"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/the-lightning-land/sweetd/lightning"
 	"github.com/the-lightning-land/sweetd/nodeman"
+	"io"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -14,11 +16,27 @@ import (
 	"time"
 )
 
+const (
+	reasonUnavailable = "unavailable"
+	reasonClosed      = "closed"
+	reasonSoldOut     = "soldOut"
+	reasonMaintenance = "maintenance"
+)
+
 var localhostOriginPattern = regexp.MustCompile(`^https?://localhost(:\d+)?$`)
 
 type Dispenser interface {
 	GetNodes() []nodeman.LightningNode
 	GetNode(id string) nodeman.LightningNode
+	GetInvoiceMemo(price int64) string
+	GetCompartmentPrice(compartment int) int64
+	GetDispenseDurationForCompartment(compartment int, sat int64) time.Duration
+	ResolveCompartment(product string, compartment *int) (int, error)
+	AddInvoice(node nodeman.LightningNode, request *lightning.InvoiceRequest, compartment int) (*lightning.Invoice, error)
+	IsOpen() bool
+	IsEmpty() bool
+	IsCompartmentEmpty(compartment int) bool
+	IsInMaintenance() bool
 }
 
 type Config struct {
@@ -106,7 +124,26 @@ func (p *Handler) availabilityMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if p.getActiveNode() == nil {
 			p.log.Errorf("PoS request failed due to unavailable node")
-			p.jsonError(w, "No node is available at the moment", http.StatusServiceUnavailable)
+			p.jsonErrorWithReason(w, "No node is available at the moment", reasonUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+
+		// existing invoices can still be looked up while closed
+		if r.Method == http.MethodPost && p.dispenser.IsInMaintenance() {
+			p.log.Infof("PoS request refused during maintenance")
+			p.jsonErrorWithReason(w, "Under maintenance at the moment", reasonMaintenance, http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Method == http.MethodPost && !p.dispenser.IsOpen() {
+			p.log.Infof("PoS request refused outside of opening hours")
+			p.jsonErrorWithReason(w, "Closed at the moment", reasonClosed, http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Method == http.MethodPost && p.dispenser.IsEmpty() {
+			p.log.Infof("PoS request refused while the hopper is empty")
+			p.jsonErrorWithReason(w, "Sold out at the moment", reasonSoldOut, http.StatusServiceUnavailable)
 			return
 		}
 
@@ -245,8 +282,42 @@ func (p *Handler) handleGetInvoice() http.HandlerFunc {
 
 func (p *Handler) handleAddInvoice() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		invoice, err := p.getActiveNode().AddInvoice(&lightning.InvoiceRequest{
-		})
+		req := addInvoiceRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil && err != io.EOF {
+			p.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// a product is dispensed from any compartment that holds it
+		compartment, err := p.dispenser.ResolveCompartment(req.Product, req.Compartment)
+		if err != nil {
+			p.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if p.dispenser.IsCompartmentEmpty(compartment) {
+			p.log.Infof("PoS request refused while compartment %d is empty", compartment)
+			p.jsonErrorWithReason(w, "Sold out at the moment", reasonSoldOut, http.StatusServiceUnavailable)
+			return
+		}
+
+		// fall back to the price of the compartment if the customer chose no amount
+		amount := req.Amount
+		if amount == 0 {
+			amount = p.dispenser.GetCompartmentPrice(compartment)
+		}
+
+		if p.dispenser.GetDispenseDurationForCompartment(compartment, amount) == 0 {
+			p.jsonError(w, fmt.Sprintf("An amount of %d satoshis is too low", amount), http.StatusBadRequest)
+			return
+		}
+
+		// payments are only dispensed for invoices added by the dispenser
+		invoice, err := p.dispenser.AddInvoice(p.getActiveNode(), &lightning.InvoiceRequest{
+			MSat: amount * 1000,
+			Memo: p.dispenser.GetInvoiceMemo(amount),
+		}, compartment)
 		if err != nil {
 			p.jsonError(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -265,6 +336,12 @@ func (p *Handler) handleAddInvoice() http.HandlerFunc {
 	}
 }
 
+type addInvoiceRequest struct {
+	Amount      int64  `json:"amount"`
+	Product     string `json:"product"`
+	Compartment *int   `json:"compartment"`
+}
+
 type invoiceMessage struct {
 	RHash          string `json:"r_hash"`
 	PaymentRequest string `json:"payment_request"`
@@ -0,0 +1,27 @@
+package sweetdb
+
+var (
+	compartmentsKey = []byte("compartments")
+)
+
+// Compartment maps a hopper with a motor of its own to the product it holds.
+// A price of zero sells the product at the price of the dispenser.
+type Compartment struct {
+	ID      int    `json:"id"`
+	Product string `json:"product"`
+	Price   int64  `json:"price"`
+}
+
+func (db *DB) SetCompartments(compartments []Compartment) error {
+	return db.setJSON(settingsBucket, compartmentsKey, compartments)
+}
+
+func (db *DB) GetCompartments() ([]Compartment, error) {
+	var compartments []Compartment
+
+	if err := db.getJSON(settingsBucket, compartmentsKey, &compartments); err != nil {
+		return nil, err
+	}
+
+	return compartments, nil
+}
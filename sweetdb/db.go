@@ -54,13 +54,30 @@ func (d *DB) Path() string {
 	return d.dbPath
 }
 
-// Wipe completely deletes all saved state within all used buckets within the
-// database. The deletion is done in a single transaction, therefore this
-// operation is fully atomic.
+// Wipe deletes all configuration of the dispenser within the database, as
+// for a factory reset. Sales, dispenses, invoices and invoice indexes are
+// records of payments and are kept. The deletion is done in a single
+// transaction, therefore this operation is fully atomic.
 func (d *DB) Wipe() error {
+	buckets := [][]byte{
+		settingsBucket,
+		nodesBucket,
+		wifiBucket,
+		updatesBucket,
+		schedulesBucket,
+		inventoryBucket,
+	}
+
 	return d.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket(settingsBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
+		for _, bucket := range buckets {
+			err := tx.DeleteBucket(bucket)
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+
+		// the settings bucket is expected to exist like in a fresh database
+		if _, err := tx.CreateBucket(settingsBucket); err != nil {
 			return err
 		}
 
@@ -111,4 +128,4 @@ func fileExists(path string) bool {
 	}
 
 	return true
-}
\ No newline at end of file
+}
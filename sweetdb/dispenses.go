@@ -0,0 +1,165 @@
+package sweetdb
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+var (
+	dispensesBucket = []byte("dispenses")
+
+	// openDispensesBucket indexes the payment hashes of dispenses that are
+	// pending or dispensing, so the queue never decodes finished entries
+	openDispensesBucket = []byte("openDispenses")
+)
+
+const (
+	DispenseStatePending     = "pending"
+	DispenseStateDispensing  = "dispensing"
+	DispenseStateDone        = "done"
+	DispenseStateInterrupted = "interrupted"
+	DispenseStateCanceled    = "canceled"
+)
+
+// Dispense is an entry of the dispense queue, keyed by the payment hash
+// of the invoice that was paid for it
+type Dispense struct {
+	RHash       string        `json:"rHash"`
+	AmtPaidMSat int64         `json:"amtPaidMsat"`
+	Duration    time.Duration `json:"duration"`
+	State       string        `json:"state"`
+	Enqueued    time.Time     `json:"enqueued"`
+	Completed   time.Time     `json:"completed"`
+	Hold        bool          `json:"hold"`
+	Compartment int           `json:"compartment"`
+
+	// Simulated dispenses were not paid and are kept out of the sales ledger
+	Simulated bool `json:"simulated,omitempty"`
+}
+
+// isOpen tells if a dispense is yet to be finished
+func (d *Dispense) isOpen() bool {
+	return d.State == DispenseStatePending || d.State == DispenseStateDispensing
+}
+
+// putDispense saves a dispense and keeps the index of open dispenses up to
+// date within the given transaction
+func putDispense(tx *bbolt.Tx, dispense *Dispense) error {
+	payload, err := json.Marshal(dispense)
+	if err != nil {
+		return err
+	}
+
+	return putIndexed(tx, dispensesBucket, openDispensesBucket, []byte(dispense.RHash), payload, dispense.isOpen())
+}
+
+// EnqueueDispense saves a new dispense, unless a dispense for the same payment
+// hash has been enqueued before. It returns whether the dispense was added.
+func (db *DB) EnqueueDispense(dispense *Dispense) (bool, error) {
+	added := false
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(dispensesBucket); bucket != nil && bucket.Get([]byte(dispense.RHash)) != nil {
+			return nil
+		}
+
+		if err := putDispense(tx, dispense); err != nil {
+			return err
+		}
+
+		added = true
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return added, nil
+}
+
+func (db *DB) SaveDispense(dispense *Dispense) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		return putDispense(tx, dispense)
+	})
+}
+
+func (db *DB) GetDispense(rHash string) (*Dispense, error) {
+	var dispense *Dispense
+
+	if err := db.getJSON(dispensesBucket, []byte(rHash), &dispense); err != nil {
+		return nil, err
+	}
+
+	return dispense, nil
+}
+
+// GetDispenses returns all dispenses in the order they were enqueued
+func (db *DB) GetDispenses() ([]*Dispense, error) {
+	keys, err := db.getKeys(dispensesBucket)
+	if err != nil {
+		return nil, errors.Errorf("unable to get keys: %v", err)
+	}
+
+	dispenses := []*Dispense{}
+
+	for _, k := range keys {
+		dispense, err := db.GetDispense(string(k))
+		if err != nil {
+			return nil, errors.Errorf("unable to get dispense %s: %v", k, err)
+		}
+
+		if dispense == nil {
+			return nil, errors.Errorf("unable to find dispense %s", k)
+		}
+
+		dispenses = append(dispenses, dispense)
+	}
+
+	sort.SliceStable(dispenses, func(i, j int) bool {
+		return dispenses[i].Enqueued.Before(dispenses[j].Enqueued)
+	})
+
+	return dispenses, nil
+}
+
+// GetOpenDispenses returns all pending or dispensing dispenses in the order
+// they were enqueued
+func (db *DB) GetOpenDispenses() ([]*Dispense, error) {
+	keys, err := db.getIndexedKeys(dispensesBucket, openDispensesBucket, func(payload []byte) (bool, error) {
+		dispense := &Dispense{}
+
+		if err := json.Unmarshal(payload, dispense); err != nil {
+			return false, err
+		}
+
+		return dispense.isOpen(), nil
+	})
+	if err != nil {
+		return nil, errors.Errorf("unable to get keys: %v", err)
+	}
+
+	dispenses := []*Dispense{}
+
+	for _, k := range keys {
+		dispense, err := db.GetDispense(string(k))
+		if err != nil {
+			return nil, errors.Errorf("unable to get dispense %s: %v", k, err)
+		}
+
+		if dispense == nil {
+			return nil, errors.Errorf("unable to find dispense %s", k)
+		}
+
+		dispenses = append(dispenses, dispense)
+	}
+
+	sort.SliceStable(dispenses, func(i, j int) bool {
+		return dispenses[i].Enqueued.Before(dispenses[j].Enqueued)
+	})
+
+	return dispenses, nil
+}
@@ -0,0 +1,80 @@
+package sweetdb
+
+import (
+	"github.com/go-errors/errors"
+	"go.etcd.io/bbolt"
+)
+
+// putIndexed saves an entry and adds its key to or removes it from an
+// index bucket within the given transaction
+func putIndexed(tx *bbolt.Tx, bucketName []byte, indexName []byte, key []byte, payload []byte, indexed bool) error {
+	bucket, err := tx.CreateBucketIfNotExists(bucketName)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Put(key, payload); err != nil {
+		return err
+	}
+
+	index, err := tx.CreateBucketIfNotExists(indexName)
+	if err != nil {
+		return err
+	}
+
+	if indexed {
+		return index.Put(key, []byte{})
+	}
+
+	return index.Delete(key)
+}
+
+// getIndexedKeys returns the keys of an index bucket. Databases without the
+// index get it built first from all entries that match.
+func (db *DB) getIndexedKeys(bucketName []byte, indexName []byte, matches func(payload []byte) (bool, error)) ([][]byte, error) {
+	indexed := false
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		indexed = tx.Bucket(indexName) != nil
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Errorf("unable to view: %v", err)
+	}
+
+	if !indexed {
+		err := db.Update(func(tx *bbolt.Tx) error {
+			if tx.Bucket(indexName) != nil {
+				return nil
+			}
+
+			index, err := tx.CreateBucket(indexName)
+			if err != nil {
+				return err
+			}
+
+			bucket := tx.Bucket(bucketName)
+			if bucket == nil {
+				return nil
+			}
+
+			return bucket.ForEach(func(k, v []byte) error {
+				match, err := matches(v)
+				if err != nil {
+					return errors.Errorf("unable to decode %s: %v", k, err)
+				}
+
+				if !match {
+					return nil
+				}
+
+				return index.Put(k, []byte{})
+			})
+		})
+		if err != nil {
+			return nil, errors.Errorf("unable to build index %s: %v", indexName, err)
+		}
+	}
+
+	return db.getKeys(indexName)
+}
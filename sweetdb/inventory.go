@@ -0,0 +1,42 @@
+package sweetdb
+
+import (
+	"strconv"
+	"time"
+)
+
+var (
+	inventoryBucket = []byte("inventory")
+	inventoryKey    = []byte("inventory")
+)
+
+// Inventory tracks how long the motor of a compartment has been running
+// since its hopper was last refilled
+type Inventory struct {
+	MotorRuntime time.Duration `json:"motorRuntime"`
+	Refilled     time.Time     `json:"refilled"`
+}
+
+// compartmentInventoryKey keeps the first compartment at the key that was
+// used before machines had multiple compartments
+func compartmentInventoryKey(compartment int) []byte {
+	if compartment == 0 {
+		return inventoryKey
+	}
+
+	return []byte(string(inventoryKey) + "-" + strconv.Itoa(compartment))
+}
+
+func (db *DB) SetInventory(compartment int, inventory *Inventory) error {
+	return db.setJSON(inventoryBucket, compartmentInventoryKey(compartment), inventory)
+}
+
+func (db *DB) GetInventory(compartment int) (*Inventory, error) {
+	inventory := &Inventory{}
+
+	if err := db.getJSON(inventoryBucket, compartmentInventoryKey(compartment), inventory); err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
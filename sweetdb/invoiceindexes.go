@@ -0,0 +1,41 @@
+package sweetdb
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+var (
+	invoiceIndexesBucket = []byte("invoiceIndexes")
+)
+
+// InvoiceIndex is how far the invoices of a node were seen, so a
+// subscription can be resumed without missing any payments
+type InvoiceIndex struct {
+	AddIndex    uint64 `json:"addIndex"`
+	SettleIndex uint64 `json:"settleIndex"`
+}
+
+func (db *DB) SetInvoiceIndex(nodeID string, index *InvoiceIndex) error {
+	return db.setJSON(invoiceIndexesBucket, []byte(nodeID), index)
+}
+
+func (db *DB) GetInvoiceIndex(nodeID string) (*InvoiceIndex, error) {
+	index := &InvoiceIndex{}
+
+	if err := db.getJSON(invoiceIndexesBucket, []byte(nodeID), index); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// deleteInvoiceIndex forgets how far the invoices of a removed node were
+// seen, so a node added under the same id starts over
+func deleteInvoiceIndex(tx *bbolt.Tx, nodeID string) error {
+	bucket := tx.Bucket(invoiceIndexesBucket)
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.Delete([]byte(nodeID))
+}
@@ -0,0 +1,94 @@
+package sweetdb
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	invoicesBucket = []byte("invoices")
+
+	// openHoldInvoicesBucket indexes the payment hashes of hold invoices
+	// that were neither settled nor cancelled yet
+	openHoldInvoicesBucket = []byte("openHoldInvoices")
+)
+
+// Invoice is an invoice that was created by the dispenser itself. Hold
+// invoices keep their preimage until the payment is settled.
+type Invoice struct {
+	RHash    string    `json:"rHash"`
+	NodeId   string    `json:"nodeId"`
+	MSat     int64     `json:"msat"`
+	Memo     string    `json:"memo"`
+	Created  time.Time `json:"created"`
+	Hold     bool      `json:"hold"`
+	Preimage string    `json:"preimage,omitempty"`
+
+	// Compartment is dispensed from once the invoice is paid
+	Compartment int `json:"compartment"`
+
+	// Resolved is set once a hold invoice was settled or cancelled
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// isOpenHold tells if a hold invoice is yet to be settled or cancelled
+func (i *Invoice) isOpenHold() bool {
+	return i.Hold && !i.Resolved
+}
+
+func (db *DB) SaveInvoice(invoice *Invoice) error {
+	payload, err := json.Marshal(invoice)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		return putIndexed(tx, invoicesBucket, openHoldInvoicesBucket, []byte(invoice.RHash), payload, invoice.isOpenHold())
+	})
+}
+
+func (db *DB) GetInvoice(rHash string) (*Invoice, error) {
+	var invoice *Invoice
+
+	if err := db.getJSON(invoicesBucket, []byte(rHash), &invoice); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// GetOpenHoldInvoices returns all hold invoices that were neither settled
+// nor cancelled yet
+func (db *DB) GetOpenHoldInvoices() ([]*Invoice, error) {
+	keys, err := db.getIndexedKeys(invoicesBucket, openHoldInvoicesBucket, func(payload []byte) (bool, error) {
+		invoice := &Invoice{}
+
+		if err := json.Unmarshal(payload, invoice); err != nil {
+			return false, err
+		}
+
+		return invoice.isOpenHold(), nil
+	})
+	if err != nil {
+		return nil, errors.Errorf("unable to get keys: %v", err)
+	}
+
+	invoices := []*Invoice{}
+
+	for _, k := range keys {
+		invoice, err := db.GetInvoice(string(k))
+		if err != nil {
+			return nil, errors.Errorf("unable to get invoice %s: %v", k, err)
+		}
+
+		if invoice == nil {
+			return nil, errors.Errorf("unable to find invoice %s", k)
+		}
+
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, nil
+}
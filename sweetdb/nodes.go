@@ -14,6 +14,7 @@ type lightningNodeKind string
 const (
 	lightningNodeKindLocal  lightningNodeKind = "local"
 	lightningNodeKindRemote                   = "remote"
+	lightningNodeKindCln                      = "cln"
 )
 
 type lightningNode struct {
@@ -31,6 +32,17 @@ type RemoteLndNode struct {
 	Url      string `json:"url"`
 	Cert     []byte `json:"cert"`
 	Macaroon []byte `json:"macaroon"`
+
+	// Rest connects through the REST proxy instead of gRPC
+	Rest bool `json:"rest"`
+}
+
+type ClnNode struct {
+	lightningNode
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	SocketPath string `json:"socketPath"`
 }
 
 type LocalNode struct {
@@ -74,6 +86,9 @@ func (db *DB) SaveNode(node LightningNode) error {
 	case *LocalNode:
 		n.Kind = lightningNodeKindLocal
 		return db.setJSON(nodesBucket, []byte(n.Id), n)
+	case *ClnNode:
+		n.Kind = lightningNodeKindCln
+		return db.setJSON(nodesBucket, []byte(n.Id), n)
 	default:
 		return errors.Errorf("Can only save nodes, got %T", node)
 	}
@@ -90,7 +105,7 @@ func (db *DB) RemoveNode(id string) error {
 			return err
 		}
 
-		return nil
+		return deleteInvoiceIndex(tx, id)
 	})
 }
 
@@ -118,6 +133,12 @@ func (db *DB) GetNode(id string) (LightningNode, error) {
 			return nil, err
 		}
 		return node, nil
+	case lightningNodeKindCln:
+		var node *ClnNode
+		if err := db.getJSON(nodesBucket, []byte(id), &node); err != nil {
+			return nil, err
+		}
+		return node, nil
 	default:
 		return nil, errors.Errorf("unknown node type %s", node.Kind)
 	}
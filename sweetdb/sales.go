@@ -0,0 +1,96 @@
+package sweetdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+var (
+	salesBucket = []byte("sales")
+)
+
+const (
+	SaleOutcomeQueued      = "queued"
+	SaleOutcomeDispensed   = "dispensed"
+	SaleOutcomeInterrupted = "interrupted"
+	SaleOutcomeUnderpaid   = "underpaid"
+	SaleOutcomeCanceled    = "canceled"
+)
+
+// Sale is an entry of the sales ledger for a paid invoice, keyed by its
+// payment hash
+type Sale struct {
+	RHash       string        `json:"rHash"`
+	AmtPaidMSat int64         `json:"amtPaidMsat"`
+	NodeId      string        `json:"nodeId"`
+	Settled     time.Time     `json:"settled"`
+	Duration    time.Duration `json:"duration"`
+	Outcome     string        `json:"outcome"`
+	Compartment int           `json:"compartment"`
+	Product     string        `json:"product,omitempty"`
+}
+
+func (db *DB) SaveSale(sale *Sale) error {
+	return db.setJSON(salesBucket, []byte(sale.RHash), sale)
+}
+
+func (db *DB) GetSale(rHash string) (*Sale, error) {
+	var sale *Sale
+
+	if err := db.getJSON(salesBucket, []byte(rHash), &sale); err != nil {
+		return nil, err
+	}
+
+	return sale, nil
+}
+
+// GetSales returns all sales settled within the given time range ordered by
+// their settle time. A zero time leaves the range open on that side. The
+// sales are read within a single transaction.
+func (db *DB) GetSales(from time.Time, to time.Time) ([]*Sale, error) {
+	sales := []*Sale{}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(salesBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if bytes.Equal(v, []byte("null")) {
+				return nil
+			}
+
+			sale := &Sale{}
+
+			if err := json.Unmarshal(v, sale); err != nil {
+				return errors.Errorf("unable to decode sale %s: %v", k, err)
+			}
+
+			if !from.IsZero() && sale.Settled.Before(from) {
+				return nil
+			}
+
+			if !to.IsZero() && !sale.Settled.Before(to) {
+				return nil
+			}
+
+			sales = append(sales, sale)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Errorf("unable to get sales: %v", err)
+	}
+
+	sort.SliceStable(sales, func(i, j int) bool {
+		return sales[i].Settled.Before(sales[j].Settled)
+	})
+
+	return sales, nil
+}
@@ -0,0 +1,41 @@
+package sweetdb
+
+import "time"
+
+var (
+	schedulesBucket = []byte("schedules")
+)
+
+const (
+	// ScheduleOpeningHours defines when the point of sales accepts orders
+	ScheduleOpeningHours = "openingHours"
+
+	// ScheduleQuietHours defines when the buzzer is silenced
+	ScheduleQuietHours = "quietHours"
+
+	// SchedulePromoHours defines when dispensing on touch is active
+	SchedulePromoHours = "promoHours"
+)
+
+// ScheduleWindow is a recurring time window on the given days of the week.
+// Start and end are minutes after midnight, and windows with an end before
+// their start continue into the next day.
+type ScheduleWindow struct {
+	Days  []time.Weekday `json:"days"`
+	Start int            `json:"start"`
+	End   int            `json:"end"`
+}
+
+func (db *DB) SetSchedule(name string, windows []ScheduleWindow) error {
+	return db.setJSON(schedulesBucket, []byte(name), windows)
+}
+
+func (db *DB) GetSchedule(name string) ([]ScheduleWindow, error) {
+	var windows []ScheduleWindow
+
+	if err := db.getJSON(schedulesBucket, []byte(name), &windows); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
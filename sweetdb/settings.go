@@ -3,18 +3,54 @@ package sweetdb
 import (
 	"crypto/rsa"
 	bolt "go.etcd.io/bbolt"
+	"time"
 )
 
 var (
-	settingsBucket     = []byte("settings")
-	lightningNodeKey   = []byte("lightningNode")
-	nameKey            = []byte("name")
-	dispenseOnTouchKey = []byte("dispenseOnTouch")
-	buzzOnDispenseKey  = []byte("buzzOnDispense")
-	posPrivateKeyKey   = []byte("posPrivateKey")
-	apiPrivateKeyKey   = []byte("apiPrivateKey")
+	settingsBucket         = []byte("settings")
+	lightningNodeKey       = []byte("lightningNode")
+	nameKey                = []byte("name")
+	dispenseOnTouchKey     = []byte("dispenseOnTouch")
+	buzzOnDispenseKey      = []byte("buzzOnDispense")
+	priceKey               = []byte("price")
+	memoKey                = []byte("memo")
+	dispenseDurationKey    = []byte("dispenseDuration")
+	priceTiersKey          = []byte("priceTiers")
+	maxDispenseDurationKey = []byte("maxDispenseDuration")
+	gramsPerSecondKey      = []byte("gramsPerSecond")
+	hopperCapacityKey      = []byte("hopperCapacity")
+	lowStockThresholdKey   = []byte("lowStockThreshold")
+	motorLimitsKey         = []byte("motorLimits")
+	holdInvoicesKey        = []byte("holdInvoices")
+	demoModeKey            = []byte("demoMode")
+	buzzerPatternsKey      = []byte("buzzerPatterns")
+	motorDriveKey          = []byte("motorDrive")
+	posPrivateKeyKey       = []byte("posPrivateKey")
+	apiPrivateKeyKey       = []byte("apiPrivateKey")
 )
 
+// PriceTier maps a paid amount of satoshis to the time the motor runs for it
+type PriceTier struct {
+	Price    int64         `json:"price"`
+	Duration time.Duration `json:"duration"`
+}
+
+// MotorLimits protect the motor from running for too long
+type MotorLimits struct {
+	MaxRuntime time.Duration `json:"maxRuntime"`
+	Cooldown   time.Duration `json:"cooldown"`
+	DutyCycle  float64       `json:"dutyCycle"`
+	DutyWindow time.Duration `json:"dutyWindow"`
+}
+
+// MotorDrive sets the speed of the motor between 0 and 1, and how long it
+// takes to speed up and slow down
+type MotorDrive struct {
+	Speed    float64       `json:"speed"`
+	RampUp   time.Duration `json:"rampUp"`
+	RampDown time.Duration `json:"rampDown"`
+}
+
 func (db *DB) SetPosPrivateKey(key *rsa.PrivateKey) error {
 	return db.setPrivateKey(settingsBucket, posPrivateKeyKey, key)
 }
@@ -95,3 +131,186 @@ func (db *DB) GetBuzzOnDispense() (bool, error) {
 
 	return buzzOnDispense, nil
 }
+
+func (db *DB) SetPrice(price int64) error {
+	return db.setJSON(settingsBucket, priceKey, price)
+}
+
+func (db *DB) GetPrice() (int64, error) {
+	var price int64
+
+	if err := db.getJSON(settingsBucket, priceKey, &price); err != nil {
+		return 0, err
+	}
+
+	return price, nil
+}
+
+func (db *DB) SetMemo(memo string) error {
+	return db.setJSON(settingsBucket, memoKey, memo)
+}
+
+func (db *DB) GetMemo() (string, error) {
+	var memo string
+
+	if err := db.getJSON(settingsBucket, memoKey, &memo); err != nil {
+		return "", err
+	}
+
+	return memo, nil
+}
+
+func (db *DB) SetDispenseDuration(duration time.Duration) error {
+	return db.setJSON(settingsBucket, dispenseDurationKey, duration)
+}
+
+func (db *DB) GetDispenseDuration() (time.Duration, error) {
+	var duration time.Duration
+
+	if err := db.getJSON(settingsBucket, dispenseDurationKey, &duration); err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
+
+func (db *DB) SetPriceTiers(tiers []PriceTier) error {
+	return db.setJSON(settingsBucket, priceTiersKey, tiers)
+}
+
+func (db *DB) GetPriceTiers() ([]PriceTier, error) {
+	var tiers []PriceTier
+
+	if err := db.getJSON(settingsBucket, priceTiersKey, &tiers); err != nil {
+		return nil, err
+	}
+
+	return tiers, nil
+}
+
+func (db *DB) SetMaxDispenseDuration(duration time.Duration) error {
+	return db.setJSON(settingsBucket, maxDispenseDurationKey, duration)
+}
+
+func (db *DB) GetMaxDispenseDuration() (time.Duration, error) {
+	var duration time.Duration
+
+	if err := db.getJSON(settingsBucket, maxDispenseDurationKey, &duration); err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
+
+func (db *DB) SetGramsPerSecond(gramsPerSecond float64) error {
+	return db.setJSON(settingsBucket, gramsPerSecondKey, gramsPerSecond)
+}
+
+func (db *DB) GetGramsPerSecond() (float64, error) {
+	var gramsPerSecond float64
+
+	if err := db.getJSON(settingsBucket, gramsPerSecondKey, &gramsPerSecond); err != nil {
+		return 0, err
+	}
+
+	return gramsPerSecond, nil
+}
+
+func (db *DB) SetHopperCapacity(grams float64) error {
+	return db.setJSON(settingsBucket, hopperCapacityKey, grams)
+}
+
+func (db *DB) GetHopperCapacity() (float64, error) {
+	var grams float64
+
+	if err := db.getJSON(settingsBucket, hopperCapacityKey, &grams); err != nil {
+		return 0, err
+	}
+
+	return grams, nil
+}
+
+func (db *DB) SetLowStockThreshold(grams float64) error {
+	return db.setJSON(settingsBucket, lowStockThresholdKey, grams)
+}
+
+func (db *DB) GetLowStockThreshold() (float64, error) {
+	var grams float64
+
+	if err := db.getJSON(settingsBucket, lowStockThresholdKey, &grams); err != nil {
+		return 0, err
+	}
+
+	return grams, nil
+}
+
+func (db *DB) SetMotorLimits(limits *MotorLimits) error {
+	return db.setJSON(settingsBucket, motorLimitsKey, limits)
+}
+
+func (db *DB) GetMotorLimits() (*MotorLimits, error) {
+	var limits *MotorLimits
+
+	if err := db.getJSON(settingsBucket, motorLimitsKey, &limits); err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
+
+func (db *DB) SetHoldInvoices(holdInvoices bool) error {
+	return db.setJSON(settingsBucket, holdInvoicesKey, holdInvoices)
+}
+
+func (db *DB) GetHoldInvoices() (bool, error) {
+	var holdInvoices bool
+
+	if err := db.getJSON(settingsBucket, holdInvoicesKey, &holdInvoices); err != nil {
+		return false, err
+	}
+
+	return holdInvoices, nil
+}
+
+func (db *DB) SetDemoMode(demoMode bool) error {
+	return db.setJSON(settingsBucket, demoModeKey, demoMode)
+}
+
+func (db *DB) GetDemoMode() (bool, error) {
+	var demoMode bool
+
+	if err := db.getJSON(settingsBucket, demoModeKey, &demoMode); err != nil {
+		return false, err
+	}
+
+	return demoMode, nil
+}
+
+// SetBuzzerPatterns saves buzzer patterns by the event they are played for
+func (db *DB) SetBuzzerPatterns(patterns map[string][]time.Duration) error {
+	return db.setJSON(settingsBucket, buzzerPatternsKey, patterns)
+}
+
+func (db *DB) GetBuzzerPatterns() (map[string][]time.Duration, error) {
+	var patterns map[string][]time.Duration
+
+	if err := db.getJSON(settingsBucket, buzzerPatternsKey, &patterns); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+func (db *DB) SetMotorDrive(drive *MotorDrive) error {
+	return db.setJSON(settingsBucket, motorDriveKey, drive)
+}
+
+func (db *DB) GetMotorDrive() (*MotorDrive, error) {
+	var drive *MotorDrive
+
+	if err := db.getJSON(settingsBucket, motorDriveKey, &drive); err != nil {
+		return nil, err
+	}
+
+	return drive, nil
+}